@@ -1,20 +1,41 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	auditbusiness "github.com/khoaphungnguyen/learning-tracker/internal/audit/business"
+	auditstorage "github.com/khoaphungnguyen/learning-tracker/internal/audit/storage"
+	audittransport "github.com/khoaphungnguyen/learning-tracker/internal/audit/transport"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
 	learningbusiness "github.com/khoaphungnguyen/learning-tracker/internal/learning/business"
 	learningstorage "github.com/khoaphungnguyen/learning-tracker/internal/learning/storage"
 	learningtransport "github.com/khoaphungnguyen/learning-tracker/internal/learning/transport"
+	"github.com/khoaphungnguyen/learning-tracker/internal/mailer"
 	middleware "github.com/khoaphungnguyen/learning-tracker/internal/middlewares"
+	"github.com/khoaphungnguyen/learning-tracker/internal/oidc"
+	privacybusiness "github.com/khoaphungnguyen/learning-tracker/internal/privacy/business"
+	privacytransport "github.com/khoaphungnguyen/learning-tracker/internal/privacy/transport"
+	"github.com/khoaphungnguyen/learning-tracker/internal/scanner"
 	userbusiness "github.com/khoaphungnguyen/learning-tracker/internal/users/business"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
 	userstorage "github.com/khoaphungnguyen/learning-tracker/internal/users/storage"
 	usertransport "github.com/khoaphungnguyen/learning-tracker/internal/users/transport"
 )
 
+// legacyTokensUntil is when tokens in the format used before the JWT library migration stop
+// being accepted, 12 hours after the release that migrated. It is fixed rather than counted
+// from startup, so restarts do not keep extending it. JWT_LEGACY_UNTIL overrides it.
+var legacyTokensUntil = time.Date(2026, time.October, 20, 12, 0, 0, 0, time.UTC)
+
 func main() {
 	// Load .env file
 	err := godotenv.Load()
@@ -27,6 +48,27 @@ func main() {
 	if jwtKey == "" {
 		log.Fatal("JWT_SECRET_KEY not set in .env file")
 	}
+	jwtWrapper := auth.JwtWrapper{
+		SecretKey:         jwtKey,
+		Issuer:            "AuthService",
+		ExpirationMinutes: 30,
+		ExpirationHours:   12,
+		Leeway:            30 * time.Second,
+		// Tokens issued before the JWT library migration stay valid until the
+		// longest of them (the refresh token) has expired after its release
+		LegacyUntil: legacyTokensUntil,
+	}
+	if legacyUntil := os.Getenv("JWT_LEGACY_UNTIL"); legacyUntil != "" {
+		jwtWrapper.LegacyUntil, err = time.Parse(time.RFC3339, legacyUntil)
+		if err != nil {
+			log.Fatal("JWT_LEGACY_UNTIL must be an RFC3339 timestamp")
+		}
+	}
+
+	// Password hashing parameters, stored hashes with weaker ones are upgraded on login
+	usermodel.PasswordParams.Memory = argon2ParamFromEnv("ARGON2_MEMORY_KB", usermodel.PasswordParams.Memory)
+	usermodel.PasswordParams.Time = argon2ParamFromEnv("ARGON2_TIME", usermodel.PasswordParams.Time)
+	usermodel.PasswordParams.Threads = uint8(argon2ParamFromEnv("ARGON2_THREADS", uint32(usermodel.PasswordParams.Threads)))
 
 	// Create a new user storage instance
 	userDB, err := userstorage.NewUserStore()
@@ -42,82 +84,522 @@ func main() {
 	}
 	defer learningDB.DB.Close()
 
+	// Create a new audit storage instance
+	auditDB, err := auditstorage.NewAuditStore()
+	if err != nil {
+		panic(err)
+	}
+	defer auditDB.DB.Close()
+
 	// Create the tables if they don't exist
 	err = userDB.CreateTable()
 	if err != nil {
 		panic(err)
 	}
+	err = auditDB.CreateTable()
+	if err != nil {
+		panic(err)
+	}
+	// Send emails through SMTP if configured, otherwise write them to the log
+	var mail mailer.Mailer = mailer.LogMailer{}
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		mail = &mailer.SMTPMailer{
+			Host:     smtpHost,
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+	}
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+
 	// Create a new user service
 	userService := userbusiness.NewUserService(userDB)
-	userHandler := usertransport.NewUserHandler(userService, jwtKey)
+
+	// Promote the configured user to admin so the admin routes can be reached
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); adminEmail != "" {
+		admin, err := userService.GetUserByEmail(adminEmail)
+		if err != nil {
+			log.Printf("ADMIN_EMAIL %s is not a registered user", adminEmail)
+		} else if err = userService.UpdateUserRole(admin.ID, string(auth.RoleAdmin)); err != nil {
+			panic(err)
+		}
+	}
+	userHandler := usertransport.NewUserHandler(userService, jwtWrapper, mail, baseURL)
+	if graceDays := os.Getenv("ERASURE_GRACE_DAYS"); graceDays != "" {
+		days, err := strconv.Atoi(graceDays)
+		if err != nil || days < 0 {
+			log.Fatal("ERASURE_GRACE_DAYS must be a number of days")
+		}
+		userHandler.ErasureGrace = time.Duration(days) * 24 * time.Hour
+	}
+	if mode := os.Getenv("EMAIL_VERIFICATION"); mode != "" {
+		if mode != usertransport.VerificationOff && mode != usertransport.VerificationRestrict && mode != usertransport.VerificationBlock {
+			log.Fatal("EMAIL_VERIFICATION must be off, restrict or block")
+		}
+		userHandler.EmailVerification = mode
+	}
+
+	// Identity providers users can log in with
+	apiBaseURL := os.Getenv("API_BASE_URL")
+	if apiBaseURL == "" {
+		apiBaseURL = "http://localhost:8000"
+	}
+	userHandler.OIDCProviders = oidcProvidersFromEnv(apiBaseURL)
+	var mockOIDC *oidc.MockProvider
+	if os.Getenv("OIDC_MOCK") == "true" {
+		clientSecret, _, err := auth.GenerateOpaqueToken()
+		if err != nil {
+			panic(err)
+		}
+		mockOIDC, err = oidc.NewMockProvider(apiBaseURL+"/mock-oidc", "learning-tracker", clientSecret)
+		if err != nil {
+			panic(err)
+		}
+		userHandler.OIDCProviders = append(userHandler.OIDCProviders, &oidc.Provider{
+			ID:           "mock",
+			Name:         "Mock Provider",
+			Issuer:       mockOIDC.Issuer,
+			ClientID:     mockOIDC.ClientID,
+			ClientSecret: mockOIDC.ClientSecret,
+			RedirectURL:  apiBaseURL + "/auth/oidc/mock/callback",
+		})
+	}
+
+	// Uploaded files are kept on local disk or in an S3-compatible object store
+	blobs, err := blobStoreFromEnv()
+	if err != nil {
+		panic(err)
+	}
 
 	// Create a new learning service
-	learningService := learningbusiness.NewLearningService(learningDB)
-	learningHandler := learningtransport.NewLearningHandler(learningService)
+	learningService := learningbusiness.NewLearningService(learningDB, blobs)
+	learningHandler := learningtransport.NewLearningHandler(learningService, blobs)
+	if allowed := os.Getenv("ATTACHMENT_ALLOWED_TYPES"); allowed != "" {
+		learningHandler.AllowedTypes = strings.Split(allowed, ",")
+	}
+	if denied, ok := os.LookupEnv("ATTACHMENT_DENIED_TYPES"); ok {
+		learningHandler.DeniedTypes = strings.Split(denied, ",")
+	}
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		learningService.UploadDir = dir
+	}
+	// Shared links are signed with their own key if set, so they can be revoked all at once
+	// by changing it, otherwise with the JWT key
+	learningService.LinkKey = []byte(jwtKey)
+	if linkKey := os.Getenv("LINK_SIGNING_KEY"); linkKey != "" {
+		learningService.LinkKey = []byte(linkKey)
+	}
+	learningService.LinkBaseURL = apiBaseURL
+	learningService.Scanner = malwareScannerFromEnv()
+	if renderer, ok := os.LookupEnv("PDF_RENDERER"); ok {
+		learningService.Thumbnails.PDFRenderer = renderer
+	}
+	if size, ok := megabytesFromEnv("MAX_FILE_SIZE_MB"); ok {
+		learningHandler.MaxFileSize = size
+	}
+	if quota, ok := megabytesFromEnv("STORAGE_QUOTA_MB"); ok {
+		learningHandler.StorageQuota = quota
+	}
+	if kept := os.Getenv("FILE_VERSIONS_KEPT"); kept != "" {
+		versions, err := strconv.Atoi(kept)
+		if err != nil || versions < 1 {
+			log.Fatal("FILE_VERSIONS_KEPT must be a number of versions")
+		}
+		learningHandler.FileVersionsKept = versions
+	}
+	learningHandler.RoleStorageQuotas = map[string]int64{}
+	for _, role := range []auth.Role{auth.RoleUser, auth.RoleMentor, auth.RoleAdmin} {
+		if quota, ok := megabytesFromEnv("STORAGE_QUOTA_" + strings.ToUpper(string(role)) + "_MB"); ok {
+			learningHandler.RoleStorageQuotas[string(role)] = quota
+		}
+	}
 
-	r := setupRouter(userHandler, learningHandler)
+	// File maintenance commands run instead of the server
+	if len(os.Args) > 1 {
+		runFileCommand(os.Args[1], learningService)
+		return
+	}
+	go learningService.RunBlobCollection(time.Hour)
+	go learningService.RunUploadExpiry(time.Hour)
+	go learningService.RunThumbnailGeneration(time.Minute)
+	go learningService.RunTextExtraction(time.Minute)
+	go learningService.RunScans(time.Minute)
+
+	// Create a new audit service
+	auditService := auditbusiness.NewAuditService(auditDB)
+	auditHandler := audittransport.NewAuditHandler(auditService)
+
+	// Create a new privacy service, which erases deleted accounts once their grace period is over
+	privacyService := privacybusiness.NewPrivacyService(userService, learningService, auditService, blobs)
+	privacyHandler := privacytransport.NewPrivacyHandler(privacyService)
+	go privacyService.RunErasures(time.Hour)
+
+	// Proxies whose X-Forwarded-For header is believed, none by default so clients cannot pick their own IP
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	r, err := newEngine(trustedProxies)
+	if err != nil {
+		log.Fatal("TRUSTED_PROXIES must be comma separated IP addresses or CIDR ranges: ", err)
+	}
+	setupRouter(r, userHandler, userService, learningHandler, auditHandler, auditService, privacyHandler)
+	if mockOIDC != nil {
+		r.Any("/mock-oidc/*path", gin.WrapH(mockOIDC))
+	}
 	r.Run(":8000")
 }
 
-func setupRouter(userHandler *usertransport.UserHandler, learningHandler *learningtransport.LearningHandler) *gin.Engine {
+// runFileCommand runs one of the file maintenance commands
+func runFileCommand(command string, learningService *learningbusiness.LearningService) {
+	ctx := context.Background()
+	switch command {
+	case "verify-blobs":
+		problems, err := learningService.VerifyBlobs(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", problem.Key, problem.Problem)
+		}
+		if len(problems) > 0 {
+			log.Fatalf("%d blob(s) failed verification", len(problems))
+		}
+		log.Println("all blobs verified")
+	case "gc-blobs":
+		deleted, err := learningService.CollectBlobs(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("deleted %d unreferenced blob(s)", deleted)
+	case "migrate-blobs":
+		moved, err := learningService.MigrateFilesToBlobs(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("moved %d file(s) to content-addressed blobs", moved)
+	case "extract-text":
+		handled, err := learningService.ReprocessTexts(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("extracted the text of %d file(s)", handled)
+	default:
+		log.Fatalf("unknown command %s, expected verify-blobs, gc-blobs, migrate-blobs or extract-text", command)
+	}
+}
+
+// megabytesFromEnv reads a size in MiB and returns it in bytes, reporting whether it is set
+func megabytesFromEnv(key string) (int64, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 || size > 1<<40 {
+		log.Fatalf("%s must be a number of megabytes", key)
+	}
+	return size << 20, true
+}
+
+// argon2ParamFromEnv reads a password hashing parameter, falling back to def if it is not set
+func argon2ParamFromEnv(key string, def uint32) uint32 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	param, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || param == 0 || (key == "ARGON2_THREADS" && param > 255) {
+		log.Fatalf("%s must be a positive number", key)
+	}
+	return uint32(param)
+}
+
+// blobStoreFromEnv creates the store for uploaded files selected by BLOB_STORE
+func blobStoreFromEnv() (blob.BlobStore, error) {
+	switch backend := os.Getenv("BLOB_STORE"); backend {
+	case "", "local":
+		dir := os.Getenv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return blob.NewLocalStore(dir)
+	case "s3":
+		config := blob.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+		}
+		if config.Endpoint == "" || config.Bucket == "" {
+			log.Fatal("S3_ENDPOINT and S3_BUCKET must be set")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return blob.NewS3Store(ctx, config)
+	default:
+		log.Fatalf("BLOB_STORE must be local or s3, not %s", backend)
+		return nil, nil
+	}
+}
+
+// malwareScannerFromEnv creates the scanner selected by MALWARE_SCANNER, nil if none is
+func malwareScannerFromEnv() scanner.Scanner {
+	switch name := os.Getenv("MALWARE_SCANNER"); name {
+	case "":
+		return nil
+	case "clamd":
+		address := os.Getenv("CLAMD_ADDRESS")
+		if address == "" {
+			address = "localhost:3310"
+		}
+		clamd := scanner.NewClamd(address)
+		// Uploads wait for their scan until clamd can be reached
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := clamd.Ping(ctx); err != nil {
+			log.Printf("clamd at %s is not answering: %v", address, err)
+		}
+		return clamd
+	case "eicar":
+		return scanner.EICAR{}
+	default:
+		log.Fatalf("MALWARE_SCANNER must be clamd or eicar, not %s", name)
+		return nil
+	}
+}
+
+// oidcProvidersFromEnv reads the identity providers listed in OIDC_PROVIDERS.
+// Each provider <ID> is configured with OIDC_<ID>_ISSUER, OIDC_<ID>_CLIENT_ID,
+// OIDC_<ID>_CLIENT_SECRET and optionally OIDC_<ID>_NAME.
+func oidcProvidersFromEnv(apiBaseURL string) []*oidc.Provider {
+	var providers []*oidc.Provider
+	for _, id := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(id) + "_"
+		provider := &oidc.Provider{
+			ID:           id,
+			Name:         os.Getenv(prefix + "NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  apiBaseURL + "/auth/oidc/" + id + "/callback",
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		if provider.Name == "" {
+			provider.Name = id
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// newEngine returns a router that only takes the client IP from X-Forwarded-For for requests
+// coming from one of the trusted proxies, as the client IP is what login throttling and sessions go by
+func newEngine(trustedProxies []string) (*gin.Engine, error) {
 	r := gin.Default()
+	err := r.SetTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func setupRouter(r *gin.Engine, userHandler *usertransport.UserHandler, userService *userbusiness.UserService, learningHandler *learningtransport.LearningHandler, auditHandler *audittransport.AuditHandler, auditService *auditbusiness.AuditService, privacyHandler *privacytransport.PrivacyHandler) {
 	// Create a new group for the API
-	auth := r.Group("/auth")
+	authRoutes := r.Group("/auth")
 	{
 		// Add the login route
-		auth.POST(("/login"), userHandler.Login)
+		authRoutes.POST(("/login"), userHandler.Login)
+		// Complete a login with the second factor
+		authRoutes.POST("/mfa", userHandler.VerifyMFA)
 		// Add the signup route
-		auth.POST("/signup", userHandler.Signup)
+		authRoutes.POST("/signup", userHandler.Signup)
 		// Add the refresh token route
-		auth.POST("/refresh", userHandler.RenewAccessToken)
+		authRoutes.POST("/refresh", userHandler.RenewAccessToken)
+		// Request a password reset link
+		authRoutes.POST("/password/forgot", userHandler.ForgotPassword)
+		// Set a new password with a reset token
+		authRoutes.POST("/password/reset", userHandler.ResetPassword)
+		// Verify an email address with the token from a verification link
+		authRoutes.GET("/verify", userHandler.VerifyEmail)
+		// Send a new verification link
+		authRoutes.POST("/verify/resend", userHandler.ResendVerification)
+		// List the identity providers users can log in with
+		authRoutes.GET("/oidc/providers", userHandler.ListOIDCProviders)
+		// Start a login at an identity provider
+		authRoutes.GET("/oidc/:provider/login", userHandler.OIDCLogin)
+		// Complete a login at an identity provider
+		authRoutes.GET("/oidc/:provider/callback", userHandler.OIDCCallback)
 	}
 
-	// Create protected route
-	protected := r.Group("/protected").Use(middleware.AuthMiddleware(userHandler.JWTKey))
+	authMiddleware := middleware.AuthMiddleware(userHandler.JWT, userService, userHandler.VerificationStatus)
+
+	// Create account route, which needs an interactive login rather than a personal access token
+	account := r.Group("/protected").Use(authMiddleware, middleware.DenyPersonalTokens())
 	{
 		// Get user profile
-		protected.GET("/profile", userHandler.Profile)
+		account.GET("/profile", userHandler.Profile)
 		// Update user profile
-		protected.PUT("/profile", userHandler.UpdateProfile)
+		account.PUT("/profile", userHandler.UpdateProfile)
 		// Delete user profile
-		protected.DELETE("/profile", userHandler.DeleteProfile)
+		account.DELETE("/profile", userHandler.DeleteProfile)
+		// Cancel the erasure of a deleted profile
+		account.DELETE("/profile/erasure", userHandler.CancelErasure)
+		// Export all data held about the user
+		account.GET("/profile/export", privacyHandler.ExportData)
+		// Change password
+		account.PUT("/profile/password", userHandler.ChangePassword)
+		// Start TOTP enrollment
+		account.POST("/mfa/totp", userHandler.SetupTOTP)
+		// Confirm TOTP enrollment
+		account.POST("/mfa/totp/enable", userHandler.EnableTOTP)
+		// Disable TOTP
+		account.POST("/mfa/totp/disable", userHandler.DisableTOTP)
+		// Regenerate recovery codes
+		account.POST("/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+		// List personal access tokens
+		account.GET("/tokens", userHandler.ListPersonalTokens)
+		// Create a personal access token
+		account.POST("/tokens", userHandler.CreatePersonalToken)
+		// Revoke a personal access token
+		account.DELETE("/tokens/:id", userHandler.DeletePersonalToken)
+		// List active sessions
+		account.GET("/sessions", userHandler.ListSessions)
+		// Log out every other session
+		account.DELETE("/sessions", userHandler.RevokeOtherSessions)
+		// Log out a session
+		account.DELETE("/sessions/:id", userHandler.RevokeSession)
+		// List linked identities
+		account.GET("/identities", userHandler.ListIdentities)
+		// Link an identity at an identity provider
+		account.POST("/identities/:provider", userHandler.LinkIdentity)
+		// Unlink an identity
+		account.DELETE("/identities/:id", userHandler.UnlinkIdentity)
+	}
+
+	// Discover the tus resumable upload protocol, which clients do without credentials
+	r.OPTIONS("/protected/uploads", learningHandler.UploadOptions)
+	// Download a file through a shared link, the signature in the URL grants access
+	r.GET("/links/:id", learningHandler.DownloadLink)
 
+	// Create protected route
+	protected := r.Group("/protected").Use(authMiddleware)
+	{
 		// Create a new goal
-		protected.POST("/goals", learningHandler.CreateGoal)
+		protected.POST("/goals", middleware.RequirePermission(auth.PermGoalsWrite), learningHandler.CreateGoal)
 		// Update a goal
-		protected.PUT("/goals", learningHandler.UpdateGoal)
+		protected.PUT("/goals", middleware.RequirePermission(auth.PermGoalsWrite), learningHandler.UpdateGoal)
 		// Delete a goal
-		protected.DELETE("/goals/:id", learningHandler.DeleteGoal)
+		protected.DELETE("/goals/:id", middleware.RequirePermission(auth.PermGoalsWrite), learningHandler.DeleteGoal)
 		// Get all goals
-		protected.GET("/goals", learningHandler.GetAllGoalsByUserID)
+		protected.GET("/goals", middleware.RequirePermission(auth.PermGoalsRead), learningHandler.GetAllGoalsByUserID)
 		// Get a goal by ID
-		protected.GET("/goals/:id", learningHandler.GetGoalByID)
+		protected.GET("/goals/:id", middleware.RequirePermission(auth.PermGoalsRead), learningHandler.GetGoalByID)
 		// Get all entries with the given goal ID
-		protected.GET("/goals/:id/entries", learningHandler.GetAllEntriesByGoalID)
+		protected.GET("/goals/:id/entries", middleware.RequirePermission(auth.PermGoalsRead), learningHandler.GetAllEntriesByGoalID)
+		// Download a goal with its entries and files as a zip archive
+		protected.GET("/goals/:id/archive", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetGoalArchive)
 
 		// Create a new entry
-		protected.POST("/entries", learningHandler.CreateEntry)
+		protected.POST("/entries", middleware.RequirePermission(auth.PermGoalsWrite), learningHandler.CreateEntry)
 		// Update an entry
-		protected.PUT("/entries", learningHandler.UpdateEntry)
+		protected.PUT("/entries", middleware.RequirePermission(auth.PermGoalsWrite), learningHandler.UpdateEntry)
 		// Delete an entry
-		protected.DELETE("/entries/:id", learningHandler.DeleteEntry)
+		protected.DELETE("/entries/:id", middleware.RequirePermission(auth.PermGoalsWrite), learningHandler.DeleteEntry)
 		// Get an entry by ID
-		protected.GET("/entries/:id", learningHandler.GetEntryByID)
+		protected.GET("/entries/:id", middleware.RequirePermission(auth.PermGoalsRead), learningHandler.GetEntryByID)
 		// Get all files by entry ID
-		protected.GET("/entries/:id/files", learningHandler.GetAllFilesByEntryID)
+		protected.GET("/entries/:id/files", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetAllFilesByEntryID)
+		// Download an entry with its files as a zip archive
+		protected.GET("/entries/:id/archive", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetEntryArchive)
 
 		// Create a new file with the given entry ID
-		protected.POST("/files", learningHandler.CreateFile)
+		protected.POST("/files", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.CreateFile)
 		// Update a file
-		protected.PUT("/files", learningHandler.UpdateFile)
+		protected.PUT("/files", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.UpdateFile)
 		// Delete a file
-		protected.DELETE("/files/:id", learningHandler.DeleteFile)
+		protected.DELETE("/files/:id", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.DeleteFile)
 		// Get a file by ID
-		protected.GET("/files/:id", learningHandler.GetFileByID)
+		protected.GET("/files/:id", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetFileByID)
+		// Get the storage used by the files of the user against their quota
+		protected.GET("/storage", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetStorage)
 		// Download a file
-		protected.GET("/files/:id/download", learningHandler.DownloadFile)
+		protected.GET("/files/:id/download", middleware.RequirePermission(auth.PermFilesRead), learningHandler.DownloadFile)
+		// Get a thumbnail of a file
+		protected.GET("/files/:id/thumbnail", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetFileThumbnail)
+		// Get the text extracted from a file
+		protected.GET("/files/:id/text", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetFileText)
+		// Get the versions of a file
+		protected.GET("/files/:id/versions", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetFileVersions)
+		// Download a version of a file
+		protected.GET("/files/:id/versions/:version/download", middleware.RequirePermission(auth.PermFilesRead), learningHandler.DownloadFileVersion)
+		// Restore a version of a file as the current one
+		protected.POST("/files/:id/versions/:version/restore", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.RestoreFileVersion)
+		// Get the shared links of a file
+		protected.GET("/files/:id/links", middleware.RequirePermission(auth.PermFilesRead), learningHandler.GetFileLinks)
+		// Create a shared link to a file
+		protected.POST("/files/:id/links", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.CreateFileLink)
+		// Revoke a shared link to a file
+		protected.DELETE("/files/:id/links/:link", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.DeleteFileLink)
+
+		// Start a resumable upload of a file with the tus protocol
+		protected.POST("/uploads", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.CreateUpload)
+		// Get the offset of a resumable upload
+		protected.HEAD("/uploads/:id", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.GetUploadOffset)
+		// Send a chunk of a resumable upload, the file is created with the last one
+		protected.PATCH("/uploads/:id", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.PatchUpload)
+		// Cancel a resumable upload
+		protected.DELETE("/uploads/:id", middleware.RequirePermission(auth.PermFilesWrite), learningHandler.DeleteUpload)
 
 	}
 
-	return r
+	// Create admin route, only admins get in and every request is written to the audit log,
+	// the ones turned away included
+	admin := r.Group("/admin").Use(authMiddleware, middleware.DenyPersonalTokens(), middleware.AuditMiddleware(auditService), middleware.RequirePermission(auth.PermAdmin))
+	{
+		// List or search users
+		admin.GET("/users", middleware.RequirePermission(auth.PermUsersRead), userHandler.ListUsers)
+		// Get goal counts and storage usage of a user
+		admin.GET("/users/:id/stats", middleware.RequirePermission(auth.PermUsersManage), userHandler.GetUserStats)
+		// Change the role of a user
+		admin.PUT("/users/:id/role", middleware.RequirePermission(auth.PermUsersManage), userHandler.UpdateUserRole)
+		// Set the storage quota of a user
+		admin.PUT("/users/:id/storage-quota", middleware.RequirePermission(auth.PermUsersManage), userHandler.SetStorageQuota)
+		// Set how many versions of each file a user keeps
+		admin.PUT("/users/:id/file-versions", middleware.RequirePermission(auth.PermUsersManage), userHandler.SetFileVersionsKept)
+		// Disable or re-enable a user account
+		admin.PUT("/users/:id/disabled", middleware.RequirePermission(auth.PermUsersManage), userHandler.SetUserDisabled)
+		// Lock a user account
+		admin.PUT("/users/:id/lock", middleware.RequirePermission(auth.PermUsersManage), userHandler.LockUser)
+		// Unlock a user account
+		admin.DELETE("/users/:id/lock", middleware.RequirePermission(auth.PermUsersManage), userHandler.UnlockUser)
+		// Reset the password of a user
+		admin.POST("/users/:id/password", middleware.RequirePermission(auth.PermUsersManage), userHandler.ResetUserPassword)
+		// List failed login attempts
+		admin.GET("/login-attempts", middleware.RequirePermission(auth.PermUsersRead), userHandler.ListFailedLogins)
+
+		// Hard delete a goal with its entries and files
+		admin.DELETE("/goals/:id", middleware.RequirePermission(auth.PermModerate), learningHandler.PurgeGoal)
+		// Hard delete an entry with its files
+		admin.DELETE("/entries/:id", middleware.RequirePermission(auth.PermModerate), learningHandler.PurgeEntry)
+		// Hard delete a file
+		admin.DELETE("/files/:id", middleware.RequirePermission(auth.PermModerate), learningHandler.PurgeFile)
+
+		// List the audit log
+		admin.GET("/audit", middleware.RequirePermission(auth.PermAuditRead), auditHandler.ListEvents)
+	}
 }
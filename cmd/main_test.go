@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIPIgnoresUntrustedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clientIP := func(r *gin.Engine, remoteAddr string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	newTestEngine := func(trustedProxies []string) *gin.Engine {
+		t.Helper()
+		r, err := newEngine(trustedProxies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.GET("/ip", func(c *gin.Context) { c.String(200, c.ClientIP()) })
+		return r
+	}
+
+	// Without trusted proxies, a client cannot pass itself off as another IP
+	r := newTestEngine(nil)
+	if ip := clientIP(r, "203.0.113.5:1234"); ip != "203.0.113.5" {
+		t.Errorf("client IP = %s, want the connecting address", ip)
+	}
+
+	r = newTestEngine([]string{"10.0.0.0/8"})
+	if ip := clientIP(r, "10.1.2.3:1234"); ip != "198.51.100.7" {
+		t.Errorf("client IP behind a trusted proxy = %s, want the forwarded address", ip)
+	}
+	if ip := clientIP(r, "203.0.113.5:1234"); ip != "203.0.113.5" {
+		t.Errorf("client IP from an untrusted address = %s, want the connecting address", ip)
+	}
+
+	if _, err := newEngine([]string{"not-an-ip"}); err == nil {
+		t.Error("invalid trusted proxy accepted")
+	}
+}
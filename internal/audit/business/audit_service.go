@@ -0,0 +1,19 @@
+package auditbusiness
+
+import auditmodel "github.com/khoaphungnguyen/learning-tracker/internal/audit/model"
+
+func (s *AuditService) CreateEvent(event auditmodel.AuditEvent) error {
+	return s.auditStore.CreateEvent(event)
+}
+
+func (s *AuditService) ListEvents(limit int, offset int) ([]auditmodel.AuditEvent, error) {
+	return s.auditStore.ListEvents(limit, offset)
+}
+
+func (s *AuditService) ListEventsByActor(actorID int) ([]auditmodel.AuditEvent, error) {
+	return s.auditStore.ListEventsByActor(actorID)
+}
+
+func (s *AuditService) AnonymizeActor(actorID int) error {
+	return s.auditStore.AnonymizeActor(actorID)
+}
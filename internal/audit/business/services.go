@@ -0,0 +1,11 @@
+package auditbusiness
+
+import auditstorage "github.com/khoaphungnguyen/learning-tracker/internal/audit/storage"
+
+type AuditService struct {
+	auditStore auditstorage.AuditStore
+}
+
+func NewAuditService(auditStore auditstorage.AuditStore) *AuditService {
+	return &AuditService{auditStore: auditStore}
+}
@@ -0,0 +1,14 @@
+package auditmodel
+
+import "time"
+
+type AuditEvent struct {
+	ID        int       `json:"id"`
+	ActorID   int       `json:"actorId"`
+	Action    string    `json:"action"`
+	TargetID  string    `json:"targetId"`
+	Status    int       `json:"status"`
+	Details   string    `json:"details"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,93 @@
+package auditstorage
+
+import auditmodel "github.com/khoaphungnguyen/learning-tracker/internal/audit/model"
+
+func (s *auditStore) CreateTable() error {
+	// Create the audit_events table
+	_, err := s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_events (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			actor_id INTEGER,
+			action TEXT,
+			target_id TEXT,
+			status INTEGER,
+			details TEXT,
+			ip TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (actor_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateEvent inserts a new audit event into the database
+func (s *auditStore) CreateEvent(event auditmodel.AuditEvent) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO audit_events (actor_id, action, target_id, status, details, ip) VALUES (?, ?, ?, ?, ?, ?)
+	`, event.ActorID, event.Action, event.TargetID, event.Status, event.Details, event.IP)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListEvents returns audit events, newest first
+func (s *auditStore) ListEvents(limit int, offset int) ([]auditmodel.AuditEvent, error) {
+	var events []auditmodel.AuditEvent
+	rows, err := s.DB.Query(`
+		SELECT id, actor_id, action, target_id, status, details, ip, created_at FROM audit_events
+		ORDER BY id DESC LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event auditmodel.AuditEvent
+		err = rows.Scan(&event.ID, &event.ActorID, &event.Action, &event.TargetID, &event.Status, &event.Details, &event.IP, &event.CreatedAt)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// ListEventsByActor returns the audit events of requests made by a user, oldest first
+func (s *auditStore) ListEventsByActor(actorID int) ([]auditmodel.AuditEvent, error) {
+	var events []auditmodel.AuditEvent
+	rows, err := s.DB.Query(`
+		SELECT id, actor_id, action, target_id, status, details, ip, created_at FROM audit_events
+		WHERE actor_id=? ORDER BY id
+	`, actorID)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event auditmodel.AuditEvent
+		err = rows.Scan(&event.ID, &event.ActorID, &event.Action, &event.TargetID, &event.Status, &event.Details, &event.IP, &event.CreatedAt)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// AnonymizeActor removes the user and IP from the audit events of requests made by a user,
+// keeping the events themselves
+func (s *auditStore) AnonymizeActor(actorID int) error {
+	_, err := s.DB.Exec(`
+		UPDATE audit_events SET actor_id=0, ip='' WHERE actor_id=?
+	`, actorID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package auditstorage
+
+import (
+	"database/sql"
+
+	auditmodel "github.com/khoaphungnguyen/learning-tracker/internal/audit/model"
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+type AuditStore interface {
+	// Table operations
+	CreateTable() error
+
+	// Audit event operations
+	CreateEvent(event auditmodel.AuditEvent) error
+	ListEvents(limit int, offset int) ([]auditmodel.AuditEvent, error)
+	ListEventsByActor(actorID int) ([]auditmodel.AuditEvent, error)
+	AnonymizeActor(actorID int) error
+}
+
+type auditStore struct {
+	DB *sql.DB
+}
+
+func NewAuditStore() (*auditStore, error) {
+	DB, err := sql.Open("sqlite3", "./migrations/learning.db")
+	if err != nil {
+		panic(err)
+	}
+	return &auditStore{DB: DB}, nil
+}
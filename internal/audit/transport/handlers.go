@@ -0,0 +1,11 @@
+package audittransport
+
+import auditbusiness "github.com/khoaphungnguyen/learning-tracker/internal/audit/business"
+
+type AuditHandler struct {
+	auditHandler *auditbusiness.AuditService
+}
+
+func NewAuditHandler(auditHandler *auditbusiness.AuditService) *AuditHandler {
+	return &AuditHandler{auditHandler: auditHandler}
+}
@@ -2,25 +2,85 @@ package auth
 
 import (
 	"errors"
+	"slices"
 	"strconv"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Audience is the audience claim set on access tokens
+const Audience = "learning-tracker"
+
+// Audiences of refresh and single purpose tokens, which keep them from being accepted as access tokens
+const (
+	RefreshAudience           = "learning-tracker/refresh"
+	EmailVerificationAudience = "learning-tracker/verify-email"
+	MFAChallengeAudience      = "learning-tracker/mfa"
 )
 
 type JwtWrapper struct {
-	SecretKey         string // key used for signing the JWT token
-	Issuer            string // Issuer of the JWT token
-	ExpirationMinutes int64  // Number of minutes the JWT token will be valid for
-	ExpirationHours   int64  // Expiration time of the JWT token in hours
+	SecretKey         string        // key used for signing the JWT token
+	Issuer            string        // Issuer of the JWT token
+	ExpirationMinutes int64         // Number of minutes the JWT token will be valid for
+	ExpirationHours   int64         // Expiration time of the JWT token in hours
+	Leeway            time.Duration // Clock skew tolerated when validating exp, nbf and iat
+	LegacyUntil       time.Time     // Tokens in the old format (user ID in aud) are accepted until this time
+}
+
+// Claims are the claims carried by the service's tokens
+type Claims struct {
+	Role       string `json:"role,omitempty"`       // Role of the user, only set on access tokens
+	Unverified bool   `json:"unverified,omitempty"` // Whether the user's email is unverified, only set on access tokens
+	Email      string `json:"email,omitempty"`      // Email being verified, only set on email verification tokens
+	SessionID  int    `json:"sid,omitempty"`        // Session of access and refresh tokens, 0 on tokens issued before sessions existed
+	jwt.RegisteredClaims
+}
+
+// UserID returns the user ID the token was issued for.
+// Tokens issued before the migration carry it in the audience instead of the subject.
+func (c *Claims) UserID() (int, error) {
+	if c.Subject != "" {
+		return strconv.Atoi(c.Subject)
+	}
+	if len(c.Audience) != 1 {
+		return 0, errors.New("token has no subject")
+	}
+	return strconv.Atoi(c.Audience[0])
+}
+
+// GenerateToken generates a jwt token for a session.
+// Unverified marks tokens of users who have not verified their email yet.
+func (j *JwtWrapper) GenerateToken(id int, role string, unverified bool, sessionID int) (signedToken string, err error) {
+	claims := &Claims{Role: role, Unverified: unverified, SessionID: sessionID}
+	return j.sign(id, claims, Audience, time.Minute*time.Duration(j.ExpirationMinutes))
+}
+
+// RefreshToken generates a refresh jwt token for a session
+func (j *JwtWrapper) RefreshToken(id int, sessionID int) (signedtoken string, err error) {
+	return j.sign(id, &Claims{SessionID: sessionID}, RefreshAudience, time.Hour*time.Duration(j.ExpirationHours))
+}
+
+// EmailVerificationToken generates a token for an email verification link.
+// It is only valid for the given email, so changing the email invalidates it.
+func (j *JwtWrapper) EmailVerificationToken(id int, email string, ttl time.Duration) (signedToken string, err error) {
+	return j.sign(id, &Claims{Email: email}, EmailVerificationAudience, ttl)
 }
 
-// GenerateToken generates a jwt token
-func (j *JwtWrapper) GenerateToken(id int) (signedToken string, err error) {
-	claims := &jwt.StandardClaims{
-		Audience:  strconv.Itoa(id),
-		ExpiresAt: time.Now().Local().Add(time.Minute * time.Duration(j.ExpirationMinutes)).Unix(),
+// MFAChallengeToken generates the token proving a user passed the password step of a login
+// that still needs a second factor
+func (j *JwtWrapper) MFAChallengeToken(id int, ttl time.Duration) (signedToken string, err error) {
+	return j.sign(id, &Claims{}, MFAChallengeAudience, ttl)
+}
+
+func (j *JwtWrapper) sign(id int, claims *Claims, audience string, ttl time.Duration) (signedToken string, err error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(id),
+		Audience:  jwt.ClaimStrings{audience},
 		Issuer:    j.Issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signedToken, err = token.SignedString([]byte(j.SecretKey))
@@ -30,41 +90,100 @@ func (j *JwtWrapper) GenerateToken(id int) (signedToken string, err error) {
 	return
 }
 
-// RefreshToken generates a refresh jwt token
-func (j *JwtWrapper) RefreshToken(id int) (signedtoken string, err error) {
-	claims := &jwt.StandardClaims{
-		Audience:  strconv.Itoa(id),
-		ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(j.ExpirationHours)).Unix(),
-		Issuer:    j.Issuer,
+// ValidateToken validates an access token
+func (j *JwtWrapper) ValidateToken(signedToken string) (claims *Claims, err error) {
+	claims, err = j.parse(signedToken)
+	if err != nil {
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedtoken, err = token.SignedString([]byte(j.SecretKey))
+	if claims.Subject == "" {
+		err = j.checkLegacy()
+		return
+	}
+	if !slices.Contains(claims.Audience, Audience) {
+		err = errors.New("token has invalid audience")
+		return
+	}
+	// Refresh tokens issued before they had their own audience carry no role
+	if claims.Role == "" {
+		err = errors.New("token is not an access token")
+		return
+	}
+	return
+}
+
+// ValidateRefreshToken validates a refresh token issued by RefreshToken
+func (j *JwtWrapper) ValidateRefreshToken(signedToken string) (claims *Claims, err error) {
+	claims, err = j.parse(signedToken)
 	if err != nil {
 		return
 	}
+	if claims.Subject == "" {
+		err = j.checkLegacy()
+		return
+	}
+	if !slices.Contains(claims.Audience, RefreshAudience) {
+		err = errors.New("token is not a refresh token")
+		return
+	}
 	return
 }
 
-// ValidateToken validates the jwt token
-func (j *JwtWrapper) ValidateToken(signedToken string) (claims *jwt.StandardClaims, err error) {
-	token, err := jwt.ParseWithClaims(
-		signedToken,
-		&jwt.StandardClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(j.SecretKey), nil
-		},
-	)
+// checkLegacy refuses tokens in the old format, where the user ID is the audience,
+// once the transition window is over
+func (j *JwtWrapper) checkLegacy() error {
+	if time.Now().After(j.LegacyUntil) {
+		return errors.New("token format is no longer accepted")
+	}
+	return nil
+}
+
+// ValidateEmailVerificationToken validates a token from an email verification link
+func (j *JwtWrapper) ValidateEmailVerificationToken(signedToken string) (claims *Claims, err error) {
+	claims, err = j.validatePurpose(signedToken, EmailVerificationAudience)
 	if err != nil {
 		return
 	}
-	claims, ok := token.Claims.(*jwt.StandardClaims)
-	if !ok {
-		err = errors.New("could not parse claims")
+	if claims.Email == "" {
+		err = errors.New("token has no email")
 		return
 	}
-	if claims.ExpiresAt < time.Now().Unix() {
-		err = errors.New("JWT is expired")
+	return
+}
+
+// ValidateMFAChallengeToken validates a token issued by MFAChallengeToken
+func (j *JwtWrapper) ValidateMFAChallengeToken(signedToken string) (claims *Claims, err error) {
+	return j.validatePurpose(signedToken, MFAChallengeAudience)
+}
+
+// validatePurpose validates a single purpose token with the given audience
+func (j *JwtWrapper) validatePurpose(signedToken string, audience string) (claims *Claims, err error) {
+	claims, err = j.parse(signedToken)
+	if err != nil {
 		return
 	}
+	if claims.Subject == "" || !slices.Contains(claims.Audience, audience) {
+		err = errors.New("token has invalid audience")
+		return
+	}
+	return
+}
+
+// parse checks the signature, issuer and time based claims of a token
+func (j *JwtWrapper) parse(signedToken string) (claims *Claims, err error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(j.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(j.Leeway),
+	)
+	claims = &Claims{}
+	_, err = parser.ParseWithClaims(
+		signedToken,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return []byte(j.SecretKey), nil
+		},
+	)
 	return
 }
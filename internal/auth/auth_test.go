@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func testWrapper() *JwtWrapper {
+	return &JwtWrapper{
+		SecretKey:         "secret",
+		Issuer:            "AuthService",
+		ExpirationMinutes: 30,
+		ExpirationHours:   12,
+		LegacyUntil:       time.Now().Add(-time.Hour),
+	}
+}
+
+func TestRefreshTokenIsNotAnAccessToken(t *testing.T) {
+	j := testWrapper()
+	refresh, err := j.RefreshToken(7, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.ValidateToken(refresh); err == nil {
+		t.Error("refresh token accepted as an access token")
+	}
+	claims, err := j.ValidateRefreshToken(refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := claims.UserID(); id != 7 || claims.SessionID != 3 {
+		t.Errorf("refresh token claims = user %d, session %d", id, claims.SessionID)
+	}
+}
+
+func TestAccessTokenIsNotARefreshToken(t *testing.T) {
+	j := testWrapper()
+	access, err := j.GenerateToken(7, string(RoleAdmin), false, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.ValidateRefreshToken(access); err == nil {
+		t.Error("access token accepted as a refresh token")
+	}
+	claims, err := j.ValidateToken(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Role != string(RoleAdmin) {
+		t.Errorf("role = %q", claims.Role)
+	}
+}
+
+func TestOldRefreshTokenIsNotAnAccessToken(t *testing.T) {
+	j := testWrapper()
+	// Refresh tokens used to be signed with the access token audience and no role
+	old, err := j.sign(7, &Claims{SessionID: 3}, Audience, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.ValidateToken(old); err == nil {
+		t.Error("old refresh token accepted as an access token")
+	}
+}
+
+func TestPurposeTokensAreNotAccessTokens(t *testing.T) {
+	j := testWrapper()
+	verify, err := j.EmailVerificationToken(7, "u@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := j.MFAChallengeToken(7, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"verification": verify, "mfa challenge": challenge} {
+		if _, err := j.ValidateToken(token); err == nil {
+			t.Errorf("%s token accepted as an access token", name)
+		}
+		if _, err := j.ValidateRefreshToken(token); err == nil {
+			t.Errorf("%s token accepted as a refresh token", name)
+		}
+	}
+}
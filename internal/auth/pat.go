@@ -0,0 +1,54 @@
+package auth
+
+import "strings"
+
+// PATPrefix starts every personal access token, telling them apart from JWTs
+const PATPrefix = "ltpat_"
+
+// Scopes a personal access token can be limited to
+const (
+	ScopeReadOnly   = "read-only"
+	ScopeGoalsWrite = "goals:write"
+	ScopeFilesWrite = "files:write"
+)
+
+var scopePermissions = map[string][]Permission{
+	ScopeReadOnly:   {PermGoalsRead, PermFilesRead},
+	ScopeGoalsWrite: {PermGoalsRead, PermGoalsWrite},
+	ScopeFilesWrite: {PermFilesRead, PermFilesWrite},
+}
+
+// GeneratePAT returns a new personal access token and the hash to store for it
+func GeneratePAT() (token string, hash string, err error) {
+	token, _, err = GenerateOpaqueToken()
+	if err != nil {
+		return
+	}
+	token = PATPrefix + token
+	hash = HashOpaqueToken(token)
+	return
+}
+
+// IsPAT reports whether a bearer token is a personal access token
+func IsPAT(token string) bool {
+	return strings.HasPrefix(token, PATPrefix)
+}
+
+// ValidScope reports whether scope is one of the known scopes
+func ValidScope(scope string) bool {
+	_, ok := scopePermissions[scope]
+	return ok
+}
+
+// ScopesAllow reports whether any of the scopes grants perm.
+// The user's role still has to grant it as well.
+func ScopesAllow(scopes []string, perm Permission) bool {
+	for _, scope := range scopes {
+		for _, p := range scopePermissions[scope] {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package auth
+
+type Role string
+
+type Permission string
+
+// Roles a user can have, stored in the users.role column
+const (
+	RoleUser   Role = "user"
+	RoleMentor Role = "mentor"
+	RoleAdmin  Role = "admin"
+)
+
+// Permissions checked by RequirePermission
+const (
+	PermGoalsRead   Permission = "goals:read"
+	PermGoalsWrite  Permission = "goals:write"
+	PermFilesRead   Permission = "files:read"
+	PermFilesWrite  Permission = "files:write"
+	PermUsersRead   Permission = "users:read"
+	PermUsersManage Permission = "users:manage"
+	PermModerate    Permission = "content:moderate"
+	PermAuditRead   Permission = "audit:read"
+	PermAdmin       Permission = "admin:access" // Reach the /admin routes at all
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser: {
+		PermGoalsRead, PermGoalsWrite, PermFilesRead, PermFilesWrite,
+	},
+	RoleMentor: {
+		PermGoalsRead, PermGoalsWrite, PermFilesRead, PermFilesWrite,
+		PermUsersRead,
+	},
+	RoleAdmin: {
+		PermGoalsRead, PermGoalsWrite, PermFilesRead, PermFilesWrite,
+		PermUsersRead, PermUsersManage, PermModerate, PermAuditRead,
+		PermAdmin,
+	},
+}
+
+// unverifiedPermissions are the only permissions kept by users who have not verified their email
+var unverifiedPermissions = []Permission{PermGoalsRead, PermFilesRead}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[Role(role)]
+	return ok
+}
+
+// Permissions returns the permission set of a role.
+// An empty role is treated as RoleUser, as tokens issued before roles existed carry none.
+func (r Role) Permissions() []Permission {
+	if r == "" {
+		r = RoleUser
+	}
+	return rolePermissions[r]
+}
+
+// HasPermission reports whether the role grants the given permission
+func (r Role) HasPermission(perm Permission) bool {
+	for _, p := range r.Permissions() {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedUnverified reports whether perm is kept by users who have not verified their email
+func AllowedUnverified(perm Permission) bool {
+	for _, p := range unverifiedPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateOpaqueToken returns a random URL-safe token and the hash to store for it
+func GenerateOpaqueToken() (token string, hash string, err error) {
+	buf := make([]byte, 32)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	hash = HashOpaqueToken(token)
+	return
+}
+
+// HashOpaqueToken returns the hash under which an opaque token is stored
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,36 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob: not found")
+
+// ErrInvalidKey is returned for keys that could escape the store
+var ErrInvalidKey = errors.New("blob: invalid key")
+
+// BlobStore stores uploaded files under slash separated keys
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any blob already there.
+	// size is the content length, or -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns a reader for the content of a blob, which the caller must close
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob, doing nothing if it does not exist
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (Info, error)
+	// List returns the blobs whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
+
+// Info describes a stored blob
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
@@ -0,0 +1,108 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreInvalidKeys(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	keys := []string{
+		"",
+		".",
+		"..",
+		"../outside",
+		"1/../../outside",
+		"1/sha256/../../../outside",
+		"/etc/passwd",
+		`..\outside`,
+		`1\sha256\abc`,
+		"1//sha256",
+		"./1/sha256",
+		"1/sha256/",
+	}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Stat(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Stat(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	// Nothing was written outside the root
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d entries next to the root, want 1", len(entries))
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := "1/sha256/abc"
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing blob = %v, want ErrNotFound", err)
+	}
+	err = store.Put(ctx, key, strings.NewReader("content"), 7, "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(content) != "content" {
+		t.Fatalf("Get = %q, %v", content, err)
+	}
+	info, err := store.Stat(ctx, key)
+	if err != nil || info.Key != key || info.Size != 7 {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+	// A directory on the way to a key is not a blob
+	if _, err := store.Stat(ctx, "1/sha256"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a directory = %v, want ErrNotFound", err)
+	}
+	err = store.Put(ctx, "2/sha256/def", strings.NewReader("other"), 5, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := store.List(ctx, "1/")
+	if err != nil || len(infos) != 1 || infos[0].Key != key {
+		t.Fatalf("List = %+v, %v", infos, err)
+	}
+	err = store.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete = %v, want ErrNotFound", err)
+	}
+	// Deleting a missing blob is not an error
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("second Delete = %v", err)
+	}
+}
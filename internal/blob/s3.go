@@ -0,0 +1,107 @@
+package blob
+
+import (
+	"context"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store keeps blobs in a bucket of an S3-compatible object store such as MinIO
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// S3Config configures the connection to an S3-compatible object store
+type S3Config struct {
+	Endpoint  string // Host and port, without scheme
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// NewS3Store connects to the object store and creates the bucket if it does not exist
+func NewS3Store(ctx context.Context, config S3Config) (*S3Store, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &S3Store{client: client, bucket: config.Bucket}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	// GetObject is lazy, so check the object exists before handing out the reader
+	_, err = object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, s3Error(err)
+	}
+	return object, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (Info, error) {
+	object, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Info{}, s3Error(err)
+	}
+	return s3Info(object), nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Info, error) {
+	var infos []Info
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return infos, object.Err
+		}
+		infos = append(infos, s3Info(object))
+	}
+	return infos, nil
+}
+
+// s3Error translates missing objects into ErrNotFound
+func s3Error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
+
+func s3Info(object minio.ObjectInfo) Info {
+	return Info{
+		Key:         object.Key,
+		Size:        object.Size,
+		ContentType: object.ContentType,
+		ModTime:     object.LastModified,
+	}
+}
@@ -0,0 +1,102 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestS3Store returns a store on a new bucket of the MinIO server at S3_TEST_ENDPOINT
+// (default localhost:9000), and skips the test if no server is running there
+func newTestS3Store(t *testing.T) *S3Store {
+	t.Helper()
+	config := S3Config{
+		Endpoint:  os.Getenv("S3_TEST_ENDPOINT"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		Bucket:    fmt.Sprintf("learning-tracker-test-%d", time.Now().UnixNano()),
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "localhost:9000"
+	}
+	if config.AccessKey == "" {
+		config.AccessKey, config.SecretKey = "minioadmin", "minioadmin"
+	}
+	conn, err := net.DialTimeout("tcp", config.Endpoint, time.Second)
+	if err != nil {
+		t.Skipf("no MinIO server at %s: %v", config.Endpoint, err)
+	}
+	conn.Close()
+	ctx := context.Background()
+	store, err := NewS3Store(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		infos, _ := store.List(ctx, "")
+		for _, info := range infos {
+			store.Delete(ctx, info.Key)
+		}
+		store.client.RemoveBucket(ctx, store.bucket)
+	})
+	return store
+}
+
+func TestS3Store(t *testing.T) {
+	store := newTestS3Store(t)
+	ctx := context.Background()
+	// The bucket is created when missing
+	exists, err := store.client.BucketExists(ctx, store.bucket)
+	if err != nil || !exists {
+		t.Fatalf("BucketExists = %v, %v", exists, err)
+	}
+	key := "1/sha256/abc"
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing blob = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat of a missing blob = %v, want ErrNotFound", err)
+	}
+	err = store.Put(ctx, key, strings.NewReader("content"), 7, "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(content) != "content" {
+		t.Fatalf("Get = %q, %v", content, err)
+	}
+	info, err := store.Stat(ctx, key)
+	if err != nil || info.Key != key || info.Size != 7 || info.ContentType != "text/plain" {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+	err = store.Put(ctx, "2/sha256/def", strings.NewReader("other"), 5, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := store.List(ctx, "1/")
+	if err != nil || len(infos) != 1 || infos[0].Key != key {
+		t.Fatalf("List = %+v, %v", infos, err)
+	}
+	err = store.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete = %v, want ErrNotFound", err)
+	}
+	// Deleting a missing blob is not an error
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("second Delete = %v", err)
+	}
+}
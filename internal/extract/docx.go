@@ -0,0 +1,86 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strings"
+)
+
+// DOCX reads the body text of Word documents, a paragraph per line
+type DOCX struct {
+	// MaxLength is the longest text read, in bytes, 0 for no limit. Reading stops once
+	// the text is longer, so the caller can still tell it was cut.
+	MaxLength int
+	// MaxDocumentSize is the largest document body read, in bytes of uncompressed XML,
+	// 0 for no limit. Larger documents fail rather than be inflated without bound.
+	MaxDocumentSize int64
+}
+
+func (DOCX) Name() string { return "docx" }
+
+func (d DOCX) Extract(ctx context.Context, r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	document, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", errors.New("docx: no word/document.xml")
+	}
+	defer document.Close()
+
+	body := &io.LimitedReader{R: document, N: math.MaxInt64}
+	if d.MaxDocumentSize > 0 {
+		body.N = d.MaxDocumentSize + 1
+	}
+	var text strings.Builder
+	decoder := xml.NewDecoder(body)
+	inText := false
+	for d.MaxLength <= 0 || text.Len() <= d.MaxLength {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		token, err := decoder.Token()
+		if body.N <= 0 {
+			return "", errors.New("docx: word/document.xml is too large")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	return text.String(), nil
+}
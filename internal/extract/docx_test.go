@@ -0,0 +1,88 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// testDOCX returns a Word document with the given body XML
+func testDOCX(t *testing.T, body string) *bytes.Reader {
+	t.Helper()
+	var data bytes.Buffer
+	archive := zip.NewWriter(&data)
+	document, err := archive.Create("word/document.xml")
+	if err == nil {
+		_, err = document.Write([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			body + `</w:body></w:document>`))
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(data.Bytes())
+}
+
+// testParagraph returns the XML of a paragraph of text
+func testParagraph(text string) string {
+	return `<w:p><w:r><w:t>` + text + `</w:t></w:r></w:p>`
+}
+
+func TestDOCXExtract(t *testing.T) {
+	body := testParagraph("First paragraph") +
+		`<w:p><w:r><w:t>Name</w:t><w:tab/><w:t>Value</w:t><w:br/><w:t>Next line</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:instrText>not body text</w:instrText></w:r></w:p>`
+	text, err := DOCX{}.Extract(context.Background(), testDOCX(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "First paragraph\nName\tValue\nNext line\n\n"
+	if text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+}
+
+func TestDOCXExtractMaxLength(t *testing.T) {
+	paragraph := testParagraph(strings.Repeat("a", 99))
+	document := testDOCX(t, strings.Repeat(paragraph, 1000))
+	text, err := DOCX{MaxLength: 1000}.Extract(context.Background(), document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reading stops at the first paragraph past the limit
+	if len(text) <= 1000 || len(text) > 1100 {
+		t.Errorf("read %d bytes of text, want just over 1000", len(text))
+	}
+
+	// The registry cuts the text to its limit and reports it
+	registry := NewRegistry()
+	long := testDOCX(t, strings.Repeat(testParagraph(strings.Repeat("a", 1023)), 1100))
+	text, _, truncated, err := registry.Extract(context.Background(), long,
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "notes.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(text) != registry.MaxLength || !truncated {
+		t.Errorf("registry kept %d bytes, truncated %v", len(text), truncated)
+	}
+}
+
+func TestDOCXExtractMaxDocumentSize(t *testing.T) {
+	// Markup without text, which compresses far smaller than it inflates
+	body := strings.Repeat(`<w:p><w:pPr><w:spacing w:after="0"/></w:pPr></w:p>`, 10000)
+	extractor := DOCX{MaxDocumentSize: 100 << 10}
+	_, err := extractor.Extract(context.Background(), testDOCX(t, body))
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("err = %v, want the document to be too large", err)
+	}
+	extractor.MaxDocumentSize = 1 << 20
+	_, err = extractor.Extract(context.Background(), testDOCX(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
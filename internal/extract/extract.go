@@ -0,0 +1,131 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned for content no extractor reads
+var ErrUnsupported = errors.New("extract: unsupported type")
+
+// ErrTruncated is returned by extractors along with the text they read before reaching their
+// MaxLength, when they stopped reading the document there
+var ErrTruncated = errors.New("extract: text truncated")
+
+// Extractor reads the text of one kind of document
+type Extractor interface {
+	// Name identifies the extractor, and is stored with the text it extracted
+	Name() string
+	// Extract returns the text of a document, whose whole content is read from r
+	Extract(ctx context.Context, r io.Reader) (string, error)
+}
+
+// Registry picks the extractor of a document from its name and content type
+type Registry struct {
+	byExtension map[string]Extractor
+	byType      map[string]Extractor
+	// MaxLength is the longest text kept, in bytes, longer text is cut
+	MaxLength int
+	// Timeout is how long extracting the text of one document may take, 0 for no limit.
+	// An extractor still running then is left to finish in the background.
+	Timeout time.Duration
+}
+
+// NewRegistry returns a registry of the built-in extractors for PDF, DOCX, Markdown and plain text,
+// which includes source code and other text formats
+func NewRegistry() *Registry {
+	r := &Registry{
+		byExtension: map[string]Extractor{},
+		byType:      map[string]Extractor{},
+		MaxLength:   1 << 20,
+		Timeout:     time.Minute,
+	}
+	r.Register(PDF{MaxLength: r.MaxLength}, "application/pdf")
+	r.Register(DOCX{MaxLength: r.MaxLength, MaxDocumentSize: 64 << 20}, "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	r.Register(Markdown{MaxLength: r.MaxLength}, "text/markdown", ".md", ".markdown")
+	r.Register(PlainText{MaxLength: r.MaxLength}, "text/*", "application/json", "application/xml", "application/javascript", "application/x-sh")
+	return r
+}
+
+// Register makes an extractor read documents of the given content types, which may be like
+// text/* to match a whole family, or file extensions starting with a dot. Extensions are
+// matched first, so a type shared by several formats can be told apart by name.
+func (r *Registry) Register(extractor Extractor, kinds ...string) {
+	for _, kind := range kinds {
+		kind = strings.ToLower(kind)
+		if strings.HasPrefix(kind, ".") {
+			r.byExtension[kind] = extractor
+		} else {
+			r.byType[kind] = extractor
+		}
+	}
+}
+
+// For returns the extractor of a document, nil if none reads it.
+// A name extension only picks an extractor for text content, so renaming a binary
+// file to .md does not make it read as text.
+func (r *Registry) For(contentType string, fileName string) Extractor {
+	base, _, _ := strings.Cut(contentType, ";")
+	base = strings.ToLower(strings.TrimSpace(base))
+	if extractor, ok := r.byExtension[strings.ToLower(path.Ext(fileName))]; ok && strings.HasPrefix(base, "text/") {
+		return extractor
+	}
+	if extractor, ok := r.byType[base]; ok {
+		return extractor
+	}
+	if family, _, ok := strings.Cut(base, "/"); ok {
+		return r.byType[family+"/*"]
+	}
+	return nil
+}
+
+// Extract returns the text of a document and whether it was cut to MaxLength.
+// It fails with context.DeadlineExceeded when the document takes longer than Timeout.
+func (r *Registry) Extract(ctx context.Context, content io.Reader, contentType string, fileName string) (text string, extractor string, truncated bool, err error) {
+	found := r.For(contentType, fileName)
+	if found == nil {
+		return "", "", false, ErrUnsupported
+	}
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	// Extractors only check the context between steps, such as PDF pages, so a slow step
+	// is not waited for
+	type result struct {
+		text string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		text, err := found.Extract(ctx, content)
+		done <- result{text, err}
+	}()
+	select {
+	case res := <-done:
+		text, err = res.text, res.err
+	case <-ctx.Done():
+		return "", found.Name(), false, ctx.Err()
+	}
+	if errors.Is(err, ErrTruncated) {
+		truncated, err = true, nil
+	}
+	if err != nil {
+		return "", found.Name(), false, err
+	}
+	text = strings.TrimSpace(strings.ToValidUTF8(text, ""))
+	if r.MaxLength > 0 && len(text) > r.MaxLength {
+		text = text[:r.MaxLength]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+		truncated = true
+	}
+	return text, found.Name(), truncated, nil
+}
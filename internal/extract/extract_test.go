@@ -0,0 +1,86 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryMaxLength(t *testing.T) {
+	r := NewRegistry()
+	r.MaxLength = 1000
+	r.Register(PlainText{MaxLength: r.MaxLength}, "text/*")
+	r.Register(Markdown{MaxLength: r.MaxLength}, ".md")
+	tests := []struct {
+		name      string
+		fileName  string
+		content   string
+		length    int
+		truncated bool
+	}{
+		{"short text", "notes.txt", "\ufeffshort", 5, false},
+		{"text at the limit", "notes.txt", strings.Repeat("a", 1000), 1000, false},
+		{"long text", "notes.txt", strings.Repeat("a", 5000), 1000, true},
+		// Stripping the markup of what was read leaves less than the limit
+		{"long markdown", "notes.md", strings.Repeat("**bold** ", 1000), 556, true},
+	}
+	for _, tt := range tests {
+		text, _, truncated, err := r.Extract(context.Background(), strings.NewReader(tt.content), "text/plain", tt.fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(text) != tt.length || truncated != tt.truncated {
+			t.Errorf("%s: %d bytes, truncated %v, want %d bytes, truncated %v", tt.name, len(text), truncated, tt.length, tt.truncated)
+		}
+	}
+}
+
+func TestPlainTextReadsUpToMaxLength(t *testing.T) {
+	content := &countingReader{r: strings.NewReader(strings.Repeat("a", 1<<20))}
+	text, err := PlainText{MaxLength: 100}.Extract(context.Background(), content)
+	if !errors.Is(err, ErrTruncated) || len(text) != 100 {
+		t.Errorf("Extract = %d bytes, %v, want 100 bytes, ErrTruncated", len(text), err)
+	}
+	if content.read > 4096 {
+		t.Errorf("read %d bytes of content", content.read)
+	}
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+// slowExtractor takes a second to read any document, whatever its context
+type slowExtractor struct{}
+
+func (slowExtractor) Name() string { return "slow" }
+
+func (slowExtractor) Extract(ctx context.Context, r io.Reader) (string, error) {
+	time.Sleep(time.Second)
+	return "text", nil
+}
+
+func TestRegistryTimeout(t *testing.T) {
+	r := NewRegistry()
+	r.Timeout = 50 * time.Millisecond
+	r.Register(slowExtractor{}, "application/x-slow")
+	start := time.Now()
+	_, extractor, _, err := r.Extract(context.Background(), strings.NewReader("content"), "application/x-slow", "document")
+	if !errors.Is(err, context.DeadlineExceeded) || extractor != "slow" {
+		t.Errorf("Extract = %q, %v, want context.DeadlineExceeded", extractor, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Extract returned after %v", elapsed)
+	}
+}
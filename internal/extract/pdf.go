@@ -0,0 +1,63 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDF reads the text of PDF documents page by page. Scanned pages without a text layer read as empty.
+type PDF struct {
+	// MaxLength stops reading pages once this much text was read, 0 for no limit
+	MaxLength int
+}
+
+func (PDF) Name() string { return "pdf" }
+
+func (p PDF) Extract(ctx context.Context, r io.Reader) (text string, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	// The parser panics on some malformed documents
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			text, err = "", fmt.Errorf("pdf: %v", recovered)
+		}
+	}()
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	var builder strings.Builder
+	fonts := map[string]*pdf.Font{}
+	for i := 1; i <= reader.NumPage(); i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				font := page.Font(name)
+				fonts[name] = &font
+			}
+		}
+		pageText, err := page.GetPlainText(fonts)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(pageText)
+		builder.WriteByte('\n')
+		if p.MaxLength > 0 && builder.Len() > p.MaxLength && i < reader.NumPage() {
+			return builder.String(), ErrTruncated
+		}
+	}
+	return builder.String(), nil
+}
@@ -0,0 +1,71 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// PlainText reads text files and source code as they are
+type PlainText struct {
+	// MaxLength is the most text read, in bytes, 0 for no limit
+	MaxLength int
+}
+
+func (PlainText) Name() string { return "text" }
+
+func (p PlainText) Extract(ctx context.Context, r io.Reader) (string, error) {
+	if p.MaxLength > 0 {
+		r = io.LimitReader(r, int64(p.MaxLength)+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	if p.MaxLength > 0 && len(data) > p.MaxLength {
+		return text[:len(text)-1], ErrTruncated
+	}
+	return text, nil
+}
+
+// Markdown reads Markdown without its markup, keeping the text of links and the content of code blocks
+type Markdown struct {
+	// MaxLength is the most Markdown read, in bytes, 0 for no limit
+	MaxLength int
+}
+
+var markdownRules = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile("(?m)^ {0,3}(```|~~~).*$"), ""},                       // code fences
+	{regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`), "$1"},                      // images, keeping the alt text
+	{regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`), "$1"},                       // inline links
+	{regexp.MustCompile(`\[([^\]]*)\]\[[^\]]*\]`), "$1"},                      // reference links
+	{regexp.MustCompile(`(?m)^ {0,3}\[[^\]]+\]:\s+\S+.*$`), ""},               // link definitions
+	{regexp.MustCompile(`(?m)^ {0,3}#{1,6}\s+`), ""},                          // headings
+	{regexp.MustCompile(`(?m)^ {0,3}>\s?`), ""},                               // block quotes
+	{regexp.MustCompile(`(?m)^(\s*)([-*+]|\d+[.)])\s+(\[[ xX]\]\s+)?`), "$1"}, // list markers and task boxes
+	{regexp.MustCompile(`(?m)^ {0,3}([-*_]\s*){3,}$`), ""},                    // horizontal rules
+	{regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`), "$1"},                      // bold
+	{regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`), "$1"},                          // italic
+	{regexp.MustCompile(`(^|\W)__?(\S(?:.*?\S)?)__?(\W|$)`), "$1$2$3"},        // bold and italic with underscores, not within words
+	{regexp.MustCompile("`([^`]*)`"), "$1"},                                   // inline code
+	{regexp.MustCompile(`<[^>\n]+>`), ""},                                     // inline HTML
+}
+
+func (Markdown) Name() string { return "markdown" }
+
+func (m Markdown) Extract(ctx context.Context, r io.Reader) (string, error) {
+	text, err := PlainText{MaxLength: m.MaxLength}.Extract(ctx, r)
+	if err != nil && !errors.Is(err, ErrTruncated) {
+		return "", err
+	}
+	for _, rule := range markdownRules {
+		text = rule.pattern.ReplaceAllString(text, rule.replace)
+	}
+	return text, err
+}
@@ -0,0 +1,211 @@
+package learningbusiness
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// maxArchiveNameLength is the longest folder or file name written to an archive, in bytes
+const maxArchiveNameLength = 100
+
+// GoalArchiveContents returns a goal with its owner's entries, oldest first, and the files of each entry
+func (s *LearningService) GoalArchiveContents(goal learningmodel.LearningGoals) (learningmodel.LearningGoals, error) {
+	entries, err := s.learningStore.GetAllEntriesByGoalID(goal.ID, goal.UserID)
+	if err != nil {
+		return goal, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].ID < entries[j].ID
+		}
+		return entries[i].Date.Before(entries[j].Date)
+	})
+	for i := range entries {
+		entries[i].Files, err = s.learningStore.GetAllFilesByEntryID(entries[i].ID)
+		if err != nil {
+			return goal, err
+		}
+	}
+	goal.Entries = entries
+	return goal, nil
+}
+
+// EntryArchiveContents returns the goal of an entry with only that entry and its files.
+// An entry whose goal was deleted, or belongs to someone else, gets an untitled one.
+func (s *LearningService) EntryArchiveContents(entry learningmodel.LearningEntry) (learningmodel.LearningGoals, error) {
+	goal, err := s.learningStore.GetGoalByID(entry.GoalID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return goal, err
+	}
+	if goal.UserID != entry.UserID {
+		goal = learningmodel.LearningGoals{}
+	}
+	entry.Files, err = s.learningStore.GetAllFilesByEntryID(entry.ID)
+	if err != nil {
+		return goal, err
+	}
+	goal.Entries = []learningmodel.LearningEntry{entry}
+	return goal, nil
+}
+
+// WriteArchive writes a zip archive of a goal from GoalArchiveContents or EntryArchiveContents:
+// the attachments of each entry in a folder of its own, and manifest.md describing the goal and
+// its entries in Markdown. The archive is written to w as it is made, one attachment at a time,
+// so it is never held in memory. Attachments missing from the store, or not cleared by the
+// malware scan, are left out and marked so in the manifest.
+func (s *LearningService) WriteArchive(ctx context.Context, goal learningmodel.LearningGoals, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	var manifest strings.Builder
+	title := goal.Title
+	if title == "" {
+		title = "Untitled goal"
+	}
+	fmt.Fprintf(&manifest, "# %s\n\n", title)
+	if !goal.StartDate.IsZero() {
+		fmt.Fprintf(&manifest, "%s to %s\n\n", goal.StartDate.Format("2006-01-02"), goal.EndDate.Format("2006-01-02"))
+	}
+	for i, entry := range goal.Entries {
+		folder := fmt.Sprintf("%02d %s", i+1, archiveName(entry.Title, fmt.Sprintf("entry-%d", entry.ID)))
+		fmt.Fprintf(&manifest, "## %s\n\n", entry.Title)
+		fmt.Fprintf(&manifest, "Date: %s, status: %s\n\n", entry.Date.Format("2006-01-02"), entry.Status)
+		if description := strings.TrimSpace(entry.Description); description != "" {
+			fmt.Fprintf(&manifest, "%s\n\n", description)
+		}
+		if len(entry.Files) == 0 {
+			continue
+		}
+		manifest.WriteString("Attachments:\n\n")
+		used := make(map[string]bool)
+		for _, file := range entry.Files {
+			if !s.ScanAllowsDownload(file.ScanStatus) {
+				fmt.Fprintf(&manifest, "- %s (left out, malware scan %s)\n", file.FileName, file.ScanStatus)
+				continue
+			}
+			name := path.Join(folder, uniqueName(used, archiveName(file.FileName, fmt.Sprintf("file-%d", file.ID))))
+			added, err := s.addArchiveFile(ctx, archive, name, file)
+			if err != nil {
+				return err
+			}
+			if added {
+				fmt.Fprintf(&manifest, "- [%s](<%s>) (%d bytes)\n", file.FileName, name, file.FileSize)
+			} else {
+				fmt.Fprintf(&manifest, "- %s (missing)\n", file.FileName)
+			}
+		}
+		manifest.WriteString("\n")
+	}
+	out, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     "manifest.md",
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, manifest.String())
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// addArchiveFile copies the content of a file into the archive, and reports false if it is
+// missing from the store. Types that are compressed already are stored as they are.
+func (s *LearningService) addArchiveFile(ctx context.Context, archive *zip.Writer, name string, file learningmodel.LearningFiles) (bool, error) {
+	content, err := s.blobs.Get(ctx, file.FilePath)
+	if errors.Is(err, blob.ErrNotFound) {
+		log.Printf("archive: file#%d: %s is missing", file.ID, file.FilePath)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer content.Close()
+	method := zip.Deflate
+	if compressedType(file.FileType) {
+		method = zip.Store
+	}
+	modified := file.CreatedAt
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	out, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: modified,
+	})
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(out, content)
+	return err == nil, err
+}
+
+// archiveName returns a name usable as one element of a path in an archive, or fallback if
+// nothing of the name is left: separators and control characters are replaced, and the name
+// is cut to maxArchiveNameLength keeping its extension.
+func archiveName(name string, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':':
+			return '_'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return fallback
+	}
+	if len(name) > maxArchiveNameLength {
+		ext := path.Ext(name)
+		if len(ext) > maxArchiveNameLength/2 {
+			ext = ""
+		}
+		base := strings.ToValidUTF8(name[:maxArchiveNameLength-len(ext)], "")
+		name = strings.TrimSpace(base) + ext
+	}
+	return name
+}
+
+// uniqueName returns name, or name with a number before its extension if it is already used,
+// and marks the result used
+func uniqueName(used map[string]bool, name string) string {
+	unique := name
+	ext := path.Ext(name)
+	for n := 2; used[strings.ToLower(unique)]; n++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+// compressedType reports whether content of a type is compressed already, so deflating it
+// again would cost time without saving space
+func compressedType(contentType string) bool {
+	base, _, _ := strings.Cut(contentType, ";")
+	base = strings.ToLower(strings.TrimSpace(base))
+	switch base {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "application/zip",
+		"application/gzip", "application/x-7z-compressed", "application/vnd.rar",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation":
+		return true
+	}
+	return strings.HasPrefix(base, "video/") || strings.HasPrefix(base, "audio/")
+}
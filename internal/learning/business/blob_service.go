@@ -0,0 +1,238 @@
+package learningbusiness
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+)
+
+// blobGCGrace is how long an unreferenced blob is kept before it is collected,
+// so an upload that has stored its blob but not yet recorded its file keeps it
+const blobGCGrace = time.Hour
+
+// BlobProblem is a blob that failed verification
+type BlobProblem struct {
+	Key     string
+	Problem string
+}
+
+// BlobKey returns the key of a user's blob with the given SHA-256 digest.
+// Blobs are deduplicated per user and kept under the user ID, so erasing a user can list them.
+func BlobKey(userID int, digest string) string {
+	return fmt.Sprintf("%d/sha256/%s", userID, digest)
+}
+
+// StoreBlob stores content under its SHA-256 digest, unless the user already has a blob with
+// the same content, and returns its key, digest and size. The blob is unreferenced until a file
+// row points at the key.
+func (s *LearningService) StoreBlob(ctx context.Context, userID int, content io.ReadSeeker, contentType string) (key string, digest string, size int64, err error) {
+	hash := sha256.New()
+	size, err = io.Copy(hash, content)
+	if err != nil {
+		return
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		return
+	}
+	digest = hex.EncodeToString(hash.Sum(nil))
+	key = BlobKey(userID, digest)
+	// Garbage collection waits until the blob is recorded and stored, so it cannot delete an
+	// existing blob between the check that it exists and the file row pointing at it.
+	// Recording it also restarts its grace period.
+	s.blobLock.RLock()
+	defer s.blobLock.RUnlock()
+	err = s.learningStore.CreateBlob(key, userID, digest, size)
+	if err != nil {
+		return
+	}
+	_, err = s.blobs.Stat(ctx, key)
+	if errors.Is(err, blob.ErrNotFound) {
+		err = s.blobs.Put(ctx, key, content, size, contentType)
+	}
+	return
+}
+
+// VerifyBlobs rehashes every recorded blob and returns those that are missing or whose
+// content no longer matches their digest
+func (s *LearningService) VerifyBlobs(ctx context.Context) ([]BlobProblem, error) {
+	var problems []BlobProblem
+	blobs, err := s.learningStore.GetAllBlobs()
+	if err != nil {
+		return problems, err
+	}
+	for _, record := range blobs {
+		content, err := s.blobs.Get(ctx, record.Key)
+		if errors.Is(err, blob.ErrNotFound) {
+			problems = append(problems, BlobProblem{Key: record.Key, Problem: "missing"})
+			continue
+		}
+		if err != nil {
+			return problems, err
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, content)
+		content.Close()
+		if err != nil {
+			return problems, err
+		}
+		if digest := hex.EncodeToString(hash.Sum(nil)); digest != record.SHA256 {
+			problems = append(problems, BlobProblem{Key: record.Key, Problem: fmt.Sprintf("sha256 %s, expected %s", digest, record.SHA256)})
+		} else if size != record.Size {
+			problems = append(problems, BlobProblem{Key: record.Key, Problem: fmt.Sprintf("size %d, expected %d", size, record.Size)})
+		}
+	}
+	return problems, nil
+}
+
+// CollectBlobs deletes blobs that no file has referenced for the grace period, and stored
+// content that is neither a recorded blob nor used by a file, and returns how many it deleted
+func (s *LearningService) CollectBlobs(ctx context.Context) (int, error) {
+	deleted := 0
+	before := time.Now().Add(-blobGCGrace)
+	keys, err := s.learningStore.GetUnreferencedBlobs(before)
+	if err != nil {
+		return deleted, err
+	}
+	for _, key := range keys {
+		err = s.collectBlob(ctx, key, before)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	infos, err := s.blobs.List(ctx, "")
+	if err != nil {
+		return deleted, err
+	}
+	for _, info := range infos {
+		if info.ModTime.After(before) {
+			continue
+		}
+		collected, err := s.collectStray(ctx, info.Key)
+		if err != nil {
+			return deleted, err
+		}
+		if collected {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// collectBlob forgets a blob that is still unreferenced since before and deletes its content.
+// sql.ErrNoRows is returned if it is referenced again.
+func (s *LearningService) collectBlob(ctx context.Context, key string, before time.Time) error {
+	s.blobLock.Lock()
+	defer s.blobLock.Unlock()
+	err := s.learningStore.DeleteUnreferencedBlob(key, before)
+	if err != nil {
+		return err
+	}
+	err = s.blobs.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+	// Thumbnails go with the content they were made of
+	thumbnails, err := s.learningStore.DeleteThumbnails(key)
+	if err != nil {
+		return err
+	}
+	for _, thumbnail := range thumbnails {
+		err = s.blobs.Delete(ctx, thumbnail)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectStray deletes stored content that is not a recorded blob, reporting whether it did
+func (s *LearningService) collectStray(ctx context.Context, key string) (bool, error) {
+	s.blobLock.Lock()
+	defer s.blobLock.Unlock()
+	known, err := s.learningStore.IsBlobKnown(key)
+	if err != nil || known {
+		return false, err
+	}
+	return true, s.blobs.Delete(ctx, key)
+}
+
+// RunBlobCollection collects unreferenced blobs now and then at every interval, it does not return
+func (s *LearningService) RunBlobCollection(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := s.CollectBlobs(context.Background())
+		if err != nil {
+			log.Println(err)
+		} else if deleted > 0 {
+			log.Printf("deleted %d unreferenced blob(s)", deleted)
+		}
+		<-ticker.C
+	}
+}
+
+// MigrateFilesToBlobs moves files uploaded before content addressing, which are stored by
+// path, into content-addressed blobs and records their digest. Files whose content is
+// missing are logged and left as they are. It returns how many files it moved.
+func (s *LearningService) MigrateFilesToBlobs(ctx context.Context) (int, error) {
+	moved := 0
+	files, err := s.learningStore.GetFilesWithoutDigest()
+	if err != nil {
+		return moved, err
+	}
+	for _, file := range files {
+		content, err := s.blobs.Get(ctx, file.FilePath)
+		if errors.Is(err, blob.ErrNotFound) {
+			log.Printf("file#%d: %s is missing", file.ID, file.FilePath)
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		// Hashing and storing need two passes over the content, which the store may only stream
+		tmp, err := os.CreateTemp("", "blob-*")
+		if err != nil {
+			content.Close()
+			return moved, err
+		}
+		_, err = io.Copy(tmp, content)
+		content.Close()
+		if err == nil {
+			_, err = tmp.Seek(0, io.SeekStart)
+		}
+		var key, digest string
+		if err == nil {
+			key, digest, _, err = s.StoreBlob(ctx, file.UserID, tmp, file.FileType)
+		}
+		tmp.Close()
+		os.Remove(tmp.Name())
+		if err != nil {
+			return moved, err
+		}
+		err = s.learningStore.SetFileBlob(file.ID, key, digest)
+		if err != nil {
+			return moved, err
+		}
+		err = s.blobs.Delete(ctx, file.FilePath)
+		if err != nil {
+			log.Println(err)
+		}
+		moved++
+	}
+	return moved, nil
+}
@@ -0,0 +1,223 @@
+package learningbusiness
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+)
+
+// refCount returns the reference count of a recorded blob
+func refCount(t *testing.T, key string) int {
+	t.Helper()
+	var count int
+	err := testDB.QueryRow(`SELECT ref_count FROM attachment_blobs WHERE blob_key=?`, key).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// storeTestBlob stores content as a blob of the user
+func storeTestBlob(t *testing.T, s *LearningService, userID int, content string) (key string, digest string) {
+	t.Helper()
+	key, digest, _, err := s.StoreBlob(context.Background(), userID, strings.NewReader(content), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, digest
+}
+
+// ageBlobs moves the last change of a user's blob records and stored blobs past the grace period
+func ageBlobs(t *testing.T, blobs *blob.LocalStore, userID int) {
+	t.Helper()
+	_, err := testDB.Exec(`UPDATE attachment_blobs SET updated_at=datetime('now', '-2 hours') WHERE user_id=?`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * blobGCGrace)
+	err = filepath.Walk(blobs.Root, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return os.Chtimes(name, old, old)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreBlobDeduplicates(t *testing.T) {
+	s, blobs := newTestService(t)
+	userID, _, _ := createTestEntry(t, s)
+	key, digest := storeTestBlob(t, s, userID, "same content")
+	if key != BlobKey(userID, digest) {
+		t.Errorf("key = %q, want %q", key, BlobKey(userID, digest))
+	}
+	again, _ := storeTestBlob(t, s, userID, "same content")
+	if again != key {
+		t.Errorf("same content stored as %q and %q", key, again)
+	}
+	infos, err := blobs.List(context.Background(), "")
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("List = %+v, %v, want one blob", infos, err)
+	}
+	// Content is not shared between users
+	other, _, _ := createTestEntry(t, s)
+	if otherKey, _ := storeTestBlob(t, s, other, "same content"); otherKey == key {
+		t.Error("users share a blob")
+	}
+}
+
+func TestBlobReferenceCount(t *testing.T) {
+	s, _ := newTestService(t)
+	userID, goalID, entryID := createTestEntry(t, s)
+	first, digest := storeTestBlob(t, s, userID, "first")
+	if refCount(t, first) != 0 {
+		t.Fatalf("new blob has %d references", refCount(t, first))
+	}
+	// Every file and every version of it holds a reference
+	a, err := s.CreateFile(entryID, goalID, userID, "a.txt", 5, "text/plain", first, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.CreateFile(entryID, goalID, userID, "b.txt", 5, "text/plain", first, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refCount(t, first); got != 4 {
+		t.Fatalf("two files hold %d references, want 4", got)
+	}
+	// Replacing the content moves the file's reference, and dropping the old version its own
+	second, digest := storeTestBlob(t, s, userID, "second")
+	err = s.UpdateFile(int(a), userID, "a.txt", 6, "text/plain", second, digest, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refCount(t, first); got != 2 {
+		t.Errorf("first blob has %d references after the update, want 2", got)
+	}
+	if got := refCount(t, second); got != 2 {
+		t.Errorf("second blob has %d references after the update, want 2", got)
+	}
+	err = s.DeleteFile(int(b), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refCount(t, first); got != 0 {
+		t.Errorf("first blob has %d references after the delete, want 0", got)
+	}
+}
+
+func TestCollectBlobs(t *testing.T) {
+	s, blobs := newTestService(t)
+	ctx := context.Background()
+	userID, goalID, entryID := createTestEntry(t, s)
+	used, digest := storeTestBlob(t, s, userID, "used")
+	_, err := s.CreateFile(entryID, goalID, userID, "used.txt", 4, "text/plain", used, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unused, digest := storeTestBlob(t, s, userID, "unused")
+	id, err := s.CreateFile(entryID, goalID, userID, "unused.txt", 6, "text/plain", unused, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.DeleteFile(int(id), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Content of an upload that has not recorded its file yet
+	pending, _ := storeTestBlob(t, s, userID, "pending")
+	// Content nothing knows about, left behind by a failed upload
+	stray := BlobKey(userID, "stray")
+	err = blobs.Put(ctx, stray, strings.NewReader("stray"), 5, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is collected within the grace period
+	deleted, err := s.CollectBlobs(ctx)
+	if err != nil || deleted != 0 {
+		t.Fatalf("CollectBlobs = %d, %v, want nothing deleted in the grace period", deleted, err)
+	}
+
+	ageBlobs(t, blobs, userID)
+	// The pending upload records its file just before collection
+	_, err = s.CreateFile(entryID, goalID, userID, "pending.txt", 7, "text/plain", pending, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err = s.CollectBlobs(ctx)
+	if err != nil || deleted != 2 {
+		t.Fatalf("CollectBlobs = %d, %v, want 2 deleted", deleted, err)
+	}
+	for _, key := range []string{unused, stray} {
+		if _, err := blobs.Stat(ctx, key); !errors.Is(err, blob.ErrNotFound) {
+			t.Errorf("%s was not collected: %v", key, err)
+		}
+	}
+	for _, key := range []string{used, pending} {
+		if _, err := blobs.Stat(ctx, key); err != nil {
+			t.Errorf("%s was collected: %v", key, err)
+		}
+	}
+	if known, err := testStore.IsBlobKnown(unused); err != nil || known {
+		t.Errorf("collected blob is still recorded: %v, %v", known, err)
+	}
+}
+
+// deleteHookStore calls beforeDelete ahead of every deletion from the store it wraps
+type deleteHookStore struct {
+	blob.BlobStore
+	beforeDelete func(key string)
+}
+
+func (s *deleteHookStore) Delete(ctx context.Context, key string) error {
+	s.beforeDelete(key)
+	return s.BlobStore.Delete(ctx, key)
+}
+
+func TestCollectBlobsWhileStoring(t *testing.T) {
+	s, blobs := newTestService(t)
+	ctx := context.Background()
+	userID, _, _ := createTestEntry(t, s)
+	key, _ := storeTestBlob(t, s, userID, "stored again")
+	ageBlobs(t, blobs, userID)
+
+	// The same content is uploaded again while collection deletes it
+	stored := make(chan error, 1)
+	var once sync.Once
+	s.blobs = &deleteHookStore{BlobStore: blobs, beforeDelete: func(deleting string) {
+		if deleting != key {
+			return
+		}
+		once.Do(func() {
+			go func() {
+				_, _, _, err := s.StoreBlob(ctx, userID, strings.NewReader("stored again"), "text/plain")
+				stored <- err
+			}()
+			time.Sleep(100 * time.Millisecond)
+		})
+	}}
+	_, err := s.CollectBlobs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-stored
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Stat(ctx, key); err != nil {
+		t.Errorf("blob stored during collection is missing: %v", err)
+	}
+	if known, err := testStore.IsBlobKnown(key); err != nil || !known {
+		t.Errorf("blob stored during collection is not recorded: %v, %v", known, err)
+	}
+}
@@ -39,8 +39,8 @@ func (s *LearningService) UpdateEntry(id int, userID int, title string, descript
 func (s *LearningService) DeleteEntry(id int, userID int) error {
 	return s.learningStore.DeleteEntry(id, userID)
 }
-func (s *LearningService) GetAllEntriesByGoalID(goalID int) ([]learningmodel.LearningEntry, error) {
-	return s.learningStore.GetAllEntriesByGoalID(goalID)
+func (s *LearningService) GetAllEntriesByGoalID(goalID int, userID int) ([]learningmodel.LearningEntry, error) {
+	return s.learningStore.GetAllEntriesByGoalID(goalID, userID)
 }
 
 func (s *LearningService) GetEntryByID(id int) (learningmodel.LearningEntry, error) {
@@ -48,12 +48,20 @@ func (s *LearningService) GetEntryByID(id int) (learningmodel.LearningEntry, err
 }
 
 // Learning File Operations
-func (s *LearningService) CreateFile(entryID int, userID int, fileName string, fileSize int64, fileType string, filePath string) (int64, error) {
-	return s.learningStore.CreateFile(entryID, userID, fileName, fileSize, fileType, filePath)
+func (s *LearningService) CreateFile(entryID int, goalID int, userID int, fileName string, fileSize int64, fileType string, filePath string, sha256 string) (int64, error) {
+	id, err := s.learningStore.CreateFile(entryID, goalID, userID, fileName, fileSize, fileType, filePath, sha256)
+	if err == nil {
+		s.fileChanged(int(id), filePath)
+	}
+	return id, err
 }
 
-func (s *LearningService) UpdateFile(id int, userID int, fileName string, fileSize int64, fileType string, filePath string) error {
-	return s.learningStore.UpdateFile(id, userID, fileName, fileSize, fileType, filePath)
+func (s *LearningService) UpdateFile(id int, userID int, fileName string, fileSize int64, fileType string, filePath string, sha256 string, keep int) error {
+	err := s.learningStore.UpdateFile(id, userID, fileName, fileSize, fileType, filePath, sha256, keep)
+	if err == nil {
+		s.fileChanged(id, filePath)
+	}
+	return err
 }
 
 func (s *LearningService) DeleteFile(id int, userID int) error {
@@ -67,3 +75,60 @@ func (s *LearningService) GetAllFilesByEntryID(entryID int) ([]learningmodel.Lea
 func (s *LearningService) GetFileByID(id int) (learningmodel.LearningFiles, error) {
 	return s.learningStore.GetFileByID(id)
 }
+
+// Learning File Version Operations
+func (s *LearningService) GetFileVersions(fileID int) ([]learningmodel.FileVersion, error) {
+	return s.learningStore.GetFileVersions(fileID)
+}
+
+func (s *LearningService) GetFileVersion(fileID int, version int) (learningmodel.FileVersion, error) {
+	return s.learningStore.GetFileVersion(fileID, version)
+}
+
+func (s *LearningService) GetFileVersionsKept(userID int) (*int, error) {
+	return s.learningStore.GetFileVersionsKept(userID)
+}
+
+// RestoreFileVersion makes the content of an old version of a file current again, as a new version
+func (s *LearningService) RestoreFileVersion(id int, userID int, version int, keep int) error {
+	old, err := s.learningStore.GetFileVersion(id, version)
+	if err != nil {
+		return err
+	}
+	return s.UpdateFile(id, userID, old.FileName, old.FileSize, old.FileType, old.FilePath, old.SHA256, keep)
+}
+
+// Account Operations
+func (s *LearningService) GetAllEntriesByUserID(userID int) ([]learningmodel.LearningEntry, error) {
+	return s.learningStore.GetAllEntriesByUserID(userID)
+}
+
+func (s *LearningService) GetAllFilesByUserID(userID int) ([]learningmodel.LearningFiles, error) {
+	return s.learningStore.GetAllFilesByUserID(userID)
+}
+
+func (s *LearningService) PurgeUserContent(userID int) ([]string, error) {
+	return s.learningStore.PurgeUserContent(userID)
+}
+
+// Storage Accounting Operations
+func (s *LearningService) GetStorageUsage(userID int) (int64, *int64, error) {
+	return s.learningStore.GetStorageUsage(userID)
+}
+
+func (s *LearningService) GetStorageByGoal(userID int) ([]learningmodel.GoalStorage, error) {
+	return s.learningStore.GetStorageByGoal(userID)
+}
+
+// Moderation Operations
+func (s *LearningService) PurgeGoal(id int) ([]string, error) {
+	return s.learningStore.PurgeGoal(id)
+}
+
+func (s *LearningService) PurgeEntry(id int) ([]string, error) {
+	return s.learningStore.PurgeEntry(id)
+}
+
+func (s *LearningService) PurgeFile(id int) ([]string, error) {
+	return s.learningStore.PurgeFile(id)
+}
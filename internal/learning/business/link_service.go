@@ -0,0 +1,131 @@
+package learningbusiness
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// DefaultLinkTTL is how long a shared link lasts when no expiry is asked for, and MaxLinkTTL the longest it may
+const (
+	DefaultLinkTTL = 7 * 24 * time.Hour
+	MaxLinkTTL     = 30 * 24 * time.Hour
+)
+
+// Errors of opening a shared link. A link that was revoked, or whose file was deleted,
+// is invalid like a forged one.
+var (
+	ErrLinkInvalid = errors.New("link is invalid")
+	ErrLinkExpired = errors.New("link has expired")
+	ErrLinkUsed    = errors.New("link has already been used")
+	// ErrScanBlocked is returned for a file the malware scan has not cleared, without using the link
+	ErrScanBlocked = errors.New("file is blocked by the malware scan")
+)
+
+// CreateFileLink creates a link to a file that lasts ttl, which anyone holding it can download the file with
+func (s *LearningService) CreateFileLink(fileID int, userID int, ttl time.Duration, singleUse bool) (learningmodel.FileLink, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	link := learningmodel.FileLink{
+		FileID:    fileID,
+		UserID:    userID,
+		SingleUse: singleUse,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	id, err := s.learningStore.CreateFileLink(link)
+	if err != nil {
+		return link, err
+	}
+	link.ID = int(id)
+	link.URL = s.linkURL(link)
+	return link, nil
+}
+
+// GetFileLinks returns the links to a file with their URLs, expired ones included
+func (s *LearningService) GetFileLinks(fileID int) ([]learningmodel.FileLink, error) {
+	links, err := s.learningStore.GetFileLinks(fileID)
+	for i := range links {
+		links[i].URL = s.linkURL(links[i])
+	}
+	return links, err
+}
+
+func (s *LearningService) DeleteFileLink(id int, fileID int) error {
+	return s.learningStore.DeleteFileLink(id, fileID)
+}
+
+// OpenFileLink checks the signature and expiry of a link from its URL and returns the file to send.
+// The download is not counted until UseFileLink, once the content is ready to send, so a single
+// use link is not spent on a download that fails. session is what LinkSession gave the client when
+// it last used the link, if anything: a client that already opened the link may keep requesting
+// it, as viewers do for ranges of a file, and opened is then true so the requests are not counted again.
+func (s *LearningService) OpenFileLink(id int, expires int64, signature string, session string) (file learningmodel.LearningFiles, opened bool, err error) {
+	if !auth.VerifyLink(s.LinkKey, linkResource(id), expires, signature) {
+		return file, false, ErrLinkInvalid
+	}
+	now := time.Now()
+	if now.Unix() >= expires {
+		return file, false, ErrLinkExpired
+	}
+	link, err := s.learningStore.GetFileLink(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && link.ExpiresAt.Unix() != expires) {
+		return file, false, ErrLinkInvalid
+	}
+	if err != nil {
+		return file, false, err
+	}
+	opened = session != "" && auth.VerifyLink(s.LinkKey, linkSessionResource(id), expires, session)
+	if link.SingleUse && link.Downloads > 0 && !opened {
+		return file, false, ErrLinkUsed
+	}
+	file, err = s.learningStore.GetFileByID(link.FileID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return file, false, ErrLinkInvalid
+	}
+	if err != nil {
+		return file, false, err
+	}
+	if !s.ScanAllowsDownload(file.ScanStatus) {
+		return file, false, ErrScanBlocked
+	}
+	return file, opened, nil
+}
+
+// UseFileLink counts a download through a link opened with OpenFileLink. ErrLinkUsed is returned
+// if it is single use and another download took it first, or it expired in the meantime.
+func (s *LearningService) UseFileLink(id int) error {
+	err := s.learningStore.UseFileLink(id, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLinkUsed
+	}
+	return err
+}
+
+// LinkSession returns the proof that a client opened a link, which it sends back to OpenFileLink
+// on its next requests of the link until the link expires
+func (s *LearningService) LinkSession(id int, expires int64) string {
+	return auth.SignLink(s.LinkKey, linkSessionResource(id), expires)
+}
+
+// linkURL returns the signed URL of a link, which is the same every time as the signature
+// covers only the link ID and expiry
+func (s *LearningService) linkURL(link learningmodel.FileLink) string {
+	expires := link.ExpiresAt.Unix()
+	signature := auth.SignLink(s.LinkKey, linkResource(link.ID), expires)
+	return fmt.Sprintf("%s/links/%d?expires=%d&signature=%s", s.LinkBaseURL, link.ID, expires, signature)
+}
+
+// linkResource names a link in its signature
+func linkResource(id int) string {
+	return "file-link:" + strconv.Itoa(id)
+}
+
+// linkSessionResource names the opening of a link in the signature of its session
+func linkSessionResource(id int) string {
+	return "file-link-session:" + strconv.Itoa(id)
+}
@@ -0,0 +1,128 @@
+package learningbusiness
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+	"github.com/khoaphungnguyen/learning-tracker/internal/scanner"
+)
+
+// scanBatch is how many files the malware scan job handles at a time
+const scanBatch = 20
+
+// ScanFiles scans the content of files and of their earlier versions for malware since the job
+// last ran, and returns how many it handled. Infected content is quarantined, content the scanner
+// cannot decide on is marked failed, while an error reaching the scanner or the stores stops the
+// job and leaves the content pending. Content uploaded while no scanner was configured is scanned
+// once there is one, and is held back like pending content until then, see ScanStatus.
+func (s *LearningService) ScanFiles(ctx context.Context) (int, error) {
+	handled := 0
+	// Content found clean can have thumbnails made and text extracted
+	defer func() {
+		if handled > 0 {
+			s.wake(s.thumbnailWake, s.textWake)
+		}
+	}()
+	for {
+		files, err := s.learningStore.GetFilesPendingScan(scanBatch, s.Scanner != nil)
+		if err != nil {
+			return handled, err
+		}
+		if len(files) == 0 {
+			break
+		}
+		for _, file := range files {
+			result, status, err := s.scanFile(ctx, file)
+			if err != nil {
+				return handled, err
+			}
+			err = s.learningStore.SetScanStatus(file.ID, file.FilePath, status, result.Signature)
+			if err != nil {
+				return handled, err
+			}
+			handled++
+		}
+	}
+	for {
+		versions, err := s.learningStore.GetVersionsPendingScan(scanBatch, s.Scanner != nil)
+		if err != nil || len(versions) == 0 {
+			return handled, err
+		}
+		for _, version := range versions {
+			file := learningmodel.LearningFiles{ID: version.FileID, UserID: version.UserID, FilePath: version.FilePath}
+			result, status, err := s.scanFile(ctx, file)
+			if err != nil {
+				return handled, err
+			}
+			err = s.learningStore.SetVersionScanStatus(version.ID, version.FilePath, status, result.Signature)
+			if err != nil {
+				return handled, err
+			}
+			handled++
+		}
+	}
+}
+
+// ScanStatus returns the scan status content is held to: content skipped while no scanner was
+// configured waits for its scan like pending content once there is one
+func (s *LearningService) ScanStatus(status string) string {
+	if status == learningmodel.ScanSkipped && s.Scanner != nil {
+		return learningmodel.ScanPending
+	}
+	return status
+}
+
+// ScanAllowsDownload reports whether content with a scan status may be downloaded, see ScanStatus
+func (s *LearningService) ScanAllowsDownload(status string) bool {
+	return learningmodel.ScanAllowsDownload(s.ScanStatus(status))
+}
+
+// scanFile scans the content of a file and returns the verdict with its scan status
+func (s *LearningService) scanFile(ctx context.Context, file learningmodel.LearningFiles) (scanner.Result, string, error) {
+	if s.Scanner == nil {
+		return scanner.Result{}, learningmodel.ScanSkipped, nil
+	}
+	content, err := s.blobs.Get(ctx, file.FilePath)
+	if errors.Is(err, blob.ErrNotFound) {
+		log.Printf("file#%d: %s is missing", file.ID, file.FilePath)
+		return scanner.Result{}, learningmodel.ScanFailed, nil
+	}
+	if err != nil {
+		return scanner.Result{}, "", err
+	}
+	defer content.Close()
+	result, err := s.Scanner.Scan(ctx, content)
+	if errors.Is(err, scanner.ErrScanFailed) {
+		log.Printf("file#%d: %s: %v", file.ID, s.Scanner.Name(), err)
+		return result, learningmodel.ScanFailed, nil
+	}
+	if err != nil {
+		return result, "", err
+	}
+	if result.Infected {
+		log.Printf("file#%d of user#%d is quarantined, %s found %s", file.ID, file.UserID, s.Scanner.Name(), result.Signature)
+		return result, learningmodel.ScanInfected, nil
+	}
+	return result, learningmodel.ScanClean, nil
+}
+
+// RunScans scans files now, whenever files are added or changed, and at every interval
+// to retry after errors, it does not return
+func (s *LearningService) RunScans(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := s.ScanFiles(context.Background())
+		if err != nil {
+			log.Println(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.scanWake:
+		}
+	}
+}
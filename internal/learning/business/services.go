@@ -1,11 +1,74 @@
 package learningbusiness
 
-import learningstorage "github.com/khoaphungnguyen/learning-tracker/internal/learning/storage"
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	"github.com/khoaphungnguyen/learning-tracker/internal/extract"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+	learningstorage "github.com/khoaphungnguyen/learning-tracker/internal/learning/storage"
+	"github.com/khoaphungnguyen/learning-tracker/internal/scanner"
+	"github.com/khoaphungnguyen/learning-tracker/internal/thumbnail"
+)
 
 type LearningService struct {
 	learningStore learningstorage.LearningStore
+	blobs         blob.BlobStore
+	// UploadDir holds the content of resumable uploads until they are complete
+	UploadDir string
+	// Thumbnails makes the thumbnails of attachments
+	Thumbnails *thumbnail.Generator
+	// Extractors read the text of attachments
+	Extractors *extract.Registry
+	// Scanner checks attachments for malware before they can be downloaded, none if nil
+	Scanner scanner.Scanner
+	// LinkKey signs shared links, changing it invalidates every link,
+	// and LinkBaseURL is the address of the API the links point at
+	LinkKey     []byte
+	LinkBaseURL string
+	// thumbnailWake, textWake and scanWake wake the background jobs when files are added or changed
+	thumbnailWake chan struct{}
+	textWake      chan struct{}
+	scanWake      chan struct{}
+	// blobLock keeps garbage collection from deleting a blob while StoreBlob records or reuses it
+	blobLock sync.RWMutex
+}
+
+func NewLearningService(learningStore learningstorage.LearningStore, blobs blob.BlobStore) *LearningService {
+	return &LearningService{
+		learningStore: learningStore,
+		blobs:         blobs,
+		UploadDir:     filepath.Join(os.TempDir(), "learning-tracker-uploads"),
+		Thumbnails:    thumbnail.NewGenerator(),
+		Extractors:    extract.NewRegistry(),
+		thumbnailWake: make(chan struct{}, 1),
+		textWake:      make(chan struct{}, 1),
+		scanWake:      make(chan struct{}, 1),
+	}
+}
+
+// fileChanged marks new content of a file as skipped by the malware scan when there is no
+// scanner, so it can be downloaded at once, and wakes the jobs processing file content
+func (s *LearningService) fileChanged(id int, filePath string) {
+	if s.Scanner == nil {
+		err := s.learningStore.SetScanStatus(id, filePath, learningmodel.ScanSkipped, "")
+		if err != nil {
+			// The scan job marks the file instead
+			log.Println(err)
+		}
+	}
+	s.wake(s.scanWake, s.thumbnailWake, s.textWake)
 }
 
-func NewLearningService(learningStore learningstorage.LearningStore) *LearningService {
-	return &LearningService{learningStore: learningStore}
+// wake wakes background jobs, a job that cannot be woken is already due
+func (s *LearningService) wake(jobs ...chan struct{}) {
+	for _, wake := range jobs {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
 }
@@ -0,0 +1,89 @@
+package learningbusiness
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningstorage "github.com/khoaphungnguyen/learning-tracker/internal/learning/storage"
+	userstorage "github.com/khoaphungnguyen/learning-tracker/internal/users/storage"
+)
+
+var (
+	testStore learningstorage.LearningStore
+	testDB    *sql.DB
+	testUsers int
+)
+
+// TestMain runs the tests against a fresh database, which the stores open under the working directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "learningbusiness")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "migrations"), 0o755)
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The users store creates every table
+	users, err := userstorage.NewUserStore()
+	if err == nil {
+		err = users.CreateTable()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	users.DB.Close()
+	store, err := learningstorage.NewLearningStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	testStore, testDB = store, store.DB
+	code := m.Run()
+	store.DB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestService returns a service on the test database, with its blobs in a temporary directory
+func newTestService(t *testing.T) (*LearningService, *blob.LocalStore) {
+	t.Helper()
+	blobs, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewLearningService(testStore, blobs)
+	s.UploadDir = t.TempDir()
+	return s, blobs
+}
+
+// createTestEntry creates a user with a goal and an entry, and returns their IDs
+func createTestEntry(t *testing.T, s *LearningService) (userID int, goalID int, entryID int) {
+	t.Helper()
+	testUsers++
+	result, err := testDB.Exec(`INSERT INTO users (email, name) VALUES (?, 'Test')`, fmt.Sprintf("user%d@example.com", testUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	userID = int(id)
+	id, err = s.CreateGoal(userID, "Goal", time.Now(), time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goalID = int(id)
+	id, err = s.CreateEntry(goalID, userID, "Entry", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entryID = int(id)
+	return
+}
@@ -0,0 +1,101 @@
+package learningbusiness
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// textBatch is how many files the text extraction job handles at a time
+const textBatch = 20
+
+// ExtractTexts extracts the text of files whose content changed since the job last ran, and
+// returns how many files it handled. Files an extractor cannot read are marked failed, while an
+// error of the stores stops the job and leaves the file pending.
+func (s *LearningService) ExtractTexts(ctx context.Context) (int, error) {
+	handled := 0
+	for {
+		files, err := s.learningStore.GetFilesPendingText(textBatch, s.Scanner == nil)
+		if err != nil || len(files) == 0 {
+			return handled, err
+		}
+		for _, file := range files {
+			text, err := s.extractText(ctx, file)
+			if err != nil {
+				return handled, err
+			}
+			err = s.learningStore.SetFileText(file, text)
+			if err != nil {
+				return handled, err
+			}
+			handled++
+		}
+	}
+}
+
+// extractText reads the text of the content of a file with the extractor for its type
+func (s *LearningService) extractText(ctx context.Context, file learningmodel.LearningFiles) (learningmodel.FileText, error) {
+	if s.Extractors.For(file.FileType, file.FileName) == nil {
+		return learningmodel.FileText{Status: learningmodel.TextNone}, nil
+	}
+	content, err := s.blobs.Get(ctx, file.FilePath)
+	if errors.Is(err, blob.ErrNotFound) {
+		log.Printf("file#%d: %s is missing", file.ID, file.FilePath)
+		return learningmodel.FileText{Status: learningmodel.TextFailed}, nil
+	}
+	if err != nil {
+		return learningmodel.FileText{}, err
+	}
+	defer content.Close()
+	text, extractor, truncated, err := s.Extractors.Extract(ctx, content, file.FileType, file.FileName)
+	// The job was stopped, the file stays pending. A file taking longer than the
+	// extractors' timeout fails below instead.
+	if ctx.Err() != nil {
+		return learningmodel.FileText{}, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("file#%d: %s: %v", file.ID, extractor, err)
+		return learningmodel.FileText{Status: learningmodel.TextFailed, Extractor: extractor}, nil
+	}
+	return learningmodel.FileText{
+		Status:    learningmodel.TextReady,
+		Extractor: extractor,
+		Text:      text,
+		Truncated: truncated,
+	}, nil
+}
+
+// ReprocessTexts extracts the text of every file again, after extractors were added or improved,
+// and returns how many files it handled
+func (s *LearningService) ReprocessTexts(ctx context.Context) (int, error) {
+	_, err := s.learningStore.ResetTextStatus()
+	if err != nil {
+		return 0, err
+	}
+	return s.ExtractTexts(ctx)
+}
+
+func (s *LearningService) GetFileText(fileID int) (learningmodel.FileText, error) {
+	return s.learningStore.GetFileText(fileID)
+}
+
+// RunTextExtraction extracts text now, whenever files are added or changed, and at every
+// interval to retry after errors, it does not return
+func (s *LearningService) RunTextExtraction(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := s.ExtractTexts(context.Background())
+		if err != nil {
+			log.Println(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.textWake:
+		}
+	}
+}
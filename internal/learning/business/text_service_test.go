@@ -0,0 +1,41 @@
+package learningbusiness
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// slowExtractor takes a second to read any document, whatever its context
+type slowExtractor struct{}
+
+func (slowExtractor) Name() string { return "slow" }
+
+func (slowExtractor) Extract(ctx context.Context, r io.Reader) (string, error) {
+	time.Sleep(time.Second)
+	return "text", nil
+}
+
+func TestExtractTextsTimeout(t *testing.T) {
+	s, _ := newTestService(t)
+	s.Extractors.Timeout = 50 * time.Millisecond
+	s.Extractors.Register(slowExtractor{}, "application/x-slow")
+	userID, goalID, entryID := createTestEntry(t, s)
+	key, digest := storeTestBlob(t, s, userID, "slow content")
+	fileID, err := s.CreateFile(entryID, goalID, userID, "document", 12, "application/x-slow", key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A file taking too long fails without stopping the job
+	_, err = s.ExtractTexts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := s.GetFileText(int(fileID))
+	if err != nil || text.Status != learningmodel.TextFailed {
+		t.Errorf("GetFileText = %+v, %v, want status %q", text, err, learningmodel.TextFailed)
+	}
+}
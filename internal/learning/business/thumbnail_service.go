@@ -0,0 +1,143 @@
+package learningbusiness
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+	"github.com/khoaphungnguyen/learning-tracker/internal/thumbnail"
+)
+
+// ThumbnailSizes are the sizes thumbnails are made at, in pixels on their longest side
+var ThumbnailSizes = []int{128, 256, 512}
+
+// thumbnailBatch is how many files the thumbnail job handles at a time
+const thumbnailBatch = 20
+
+// ThumbnailKey returns the key of the thumbnail of a blob at a size. Thumbnails are kept under
+// the user ID like blobs and named after the content digest, so files sharing content share them.
+func ThumbnailKey(userID int, digest string, size int) string {
+	return fmt.Sprintf("%d/thumbnails/%s/%d.jpg", userID, digest, size)
+}
+
+// GenerateThumbnails makes the thumbnails of files whose content changed since the job last ran,
+// and returns how many files it handled. Files whose content cannot be read as an image are
+// marked failed, while an error of the stores stops the job and leaves the file pending.
+func (s *LearningService) GenerateThumbnails(ctx context.Context) (int, error) {
+	handled := 0
+	for {
+		files, err := s.learningStore.GetFilesPendingThumbnails(thumbnailBatch, s.Scanner == nil)
+		if err != nil || len(files) == 0 {
+			return handled, err
+		}
+		for _, file := range files {
+			status, err := s.generateThumbnails(ctx, file)
+			if err != nil {
+				return handled, err
+			}
+			err = s.learningStore.SetThumbnailStatus(file.ID, file.FilePath, status)
+			if err != nil {
+				return handled, err
+			}
+			handled++
+		}
+	}
+}
+
+// generateThumbnails makes the thumbnails of a file at every size unless its content has them,
+// and returns its thumbnail status
+func (s *LearningService) generateThumbnails(ctx context.Context, file learningmodel.LearningFiles) (string, error) {
+	if !s.Thumbnails.Supported(file.FileType) {
+		return learningmodel.ThumbnailNone, nil
+	}
+	existing, err := s.learningStore.GetThumbnails(file.FilePath)
+	if err != nil {
+		return "", err
+	}
+	if len(existing) == len(ThumbnailSizes) {
+		return learningmodel.ThumbnailReady, nil
+	}
+	content, err := s.blobs.Get(ctx, file.FilePath)
+	if errors.Is(err, blob.ErrNotFound) {
+		log.Printf("file#%d: %s is missing", file.ID, file.FilePath)
+		return learningmodel.ThumbnailFailed, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	img, err := s.Thumbnails.Decode(ctx, content, file.FileType)
+	content.Close()
+	if err != nil {
+		log.Printf("file#%d: %v", file.ID, err)
+		return learningmodel.ThumbnailFailed, nil
+	}
+	// Files stored before content addressing are named after the file instead
+	digest := file.SHA256
+	if digest == "" {
+		digest = fmt.Sprintf("file-%d", file.ID)
+	}
+	for _, size := range ThumbnailSizes {
+		thumb := thumbnail.Resize(img, size)
+		var encoded bytes.Buffer
+		err = thumbnail.Encode(&encoded, thumb)
+		if err != nil {
+			return "", err
+		}
+		key := ThumbnailKey(file.UserID, digest, size)
+		err = s.blobs.Put(ctx, key, &encoded, int64(encoded.Len()), thumbnail.ContentType)
+		if err != nil {
+			return "", err
+		}
+		err = s.learningStore.CreateThumbnail(learningmodel.Thumbnail{
+			SourceKey: file.FilePath,
+			Size:      size,
+			Key:       key,
+			UserID:    file.UserID,
+			Width:     thumb.Bounds().Dx(),
+			Height:    thumb.Bounds().Dy(),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return learningmodel.ThumbnailReady, nil
+}
+
+// GetThumbnail returns the smallest thumbnail of a file at least size pixels, or the largest one
+func (s *LearningService) GetThumbnail(file learningmodel.LearningFiles, size int) (learningmodel.Thumbnail, error) {
+	thumbnails, err := s.learningStore.GetThumbnails(file.FilePath)
+	if err != nil {
+		return learningmodel.Thumbnail{}, err
+	}
+	if len(thumbnails) == 0 {
+		return learningmodel.Thumbnail{}, blob.ErrNotFound
+	}
+	for _, thumbnail := range thumbnails {
+		if thumbnail.Size >= size {
+			return thumbnail, nil
+		}
+	}
+	return thumbnails[len(thumbnails)-1], nil
+}
+
+// RunThumbnailGeneration makes thumbnails now, whenever files are added or changed, and at every
+// interval to retry after errors, it does not return
+func (s *LearningService) RunThumbnailGeneration(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := s.GenerateThumbnails(context.Background())
+		if err != nil {
+			log.Println(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.thumbnailWake:
+		}
+	}
+}
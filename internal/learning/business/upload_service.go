@@ -0,0 +1,169 @@
+package learningbusiness
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// UploadTTL is how long an incomplete upload is kept after it was last written to
+const UploadTTL = 24 * time.Hour
+
+// CreateUpload starts a resumable upload of length bytes into a file of an entry
+func (s *LearningService) CreateUpload(userID, entryID, goalID int, fileName string, length int64) (learningmodel.Upload, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return learningmodel.Upload{}, err
+	}
+	now := time.Now()
+	upload := learningmodel.Upload{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		EntryID:   entryID,
+		GoalID:    goalID,
+		FileName:  fileName,
+		Length:    length,
+		ExpiresAt: now.Add(UploadTTL),
+		CreatedAt: now,
+	}
+	err = os.MkdirAll(s.UploadDir, 0o700)
+	if err != nil {
+		return upload, err
+	}
+	staging, err := os.OpenFile(s.uploadPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return upload, err
+	}
+	staging.Close()
+	err = s.learningStore.CreateUpload(upload)
+	if err != nil {
+		os.Remove(s.uploadPath(upload.ID))
+	}
+	return upload, err
+}
+
+func (s *LearningService) GetUpload(id string) (learningmodel.Upload, error) {
+	return s.learningStore.GetUpload(id)
+}
+
+// WriteUpload appends content at the offset of an upload, up to its length, and records the
+// new offset and expiry. What was received is kept when reading the content fails midway.
+func (s *LearningService) WriteUpload(upload *learningmodel.Upload, content io.Reader) error {
+	staging, err := os.OpenFile(s.uploadPath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = staging.Seek(upload.Offset, io.SeekStart)
+	if err != nil {
+		staging.Close()
+		return err
+	}
+	written, copyErr := io.Copy(staging, io.LimitReader(content, upload.Length-upload.Offset))
+	// Drop anything past the offset left by a write that was never recorded
+	err = staging.Truncate(upload.Offset + written)
+	if closeErr := staging.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(UploadTTL)
+	err = s.learningStore.UpdateUploadOffset(upload.ID, upload.Offset, upload.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return copyErr
+}
+
+// GetPendingUploadSize returns the total length of a user's unfinished uploads, which is
+// reserved for them until they finish or expire
+func (s *LearningService) GetPendingUploadSize(userID int) (int64, error) {
+	return s.learningStore.GetPendingUploadSize(userID, time.Now())
+}
+
+// OpenUpload opens the content received for an upload
+func (s *LearningService) OpenUpload(upload learningmodel.Upload) (*os.File, error) {
+	return os.Open(s.uploadPath(upload.ID))
+}
+
+// DeleteUpload forgets an upload and deletes its content
+func (s *LearningService) DeleteUpload(id string) error {
+	err := s.learningStore.DeleteUpload(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(s.uploadPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ExpireUploads deletes uploads that have not been written to for UploadTTL, and staged content
+// as old that no upload refers to, and returns how many uploads it deleted
+func (s *LearningService) ExpireUploads() (int, error) {
+	deleted := 0
+	now := time.Now()
+	uploads, err := s.learningStore.GetExpiredUploads(now)
+	if err != nil {
+		return deleted, err
+	}
+	for _, upload := range uploads {
+		err = s.DeleteUpload(upload.ID)
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	entries, err := os.ReadDir(s.UploadDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return deleted, nil
+	}
+	if err != nil {
+		return deleted, err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(now.Add(-UploadTTL)) {
+			continue
+		}
+		_, err = s.learningStore.GetUpload(entry.Name())
+		if err == nil {
+			continue
+		}
+		err = os.Remove(filepath.Join(s.UploadDir, entry.Name()))
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// RunUploadExpiry expires uploads now and then at every interval, it does not return
+func (s *LearningService) RunUploadExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := s.ExpireUploads()
+		if err != nil {
+			log.Println(err)
+		} else if deleted > 0 {
+			log.Printf("deleted %d expired upload(s)", deleted)
+		}
+		<-ticker.C
+	}
+}
+
+func (s *LearningService) uploadPath(id string) string {
+	return filepath.Join(s.UploadDir, id)
+}
@@ -23,12 +23,149 @@ type LearningEntry struct {
 }
 
 type LearningFiles struct {
-	ID        int       `json:"id"`
+	ID              int       `json:"id"`
+	UserID          int       `json:"userId"`
+	GoalID          int       `json:"goalId"`
+	EntryID         int       `json:"entryId"`
+	FileName        string    `json:"fileName"`
+	FileSize        int64     `json:"fileSize"`
+	FileType        string    `json:"fileType"`
+	FilePath        string    `json:"filePath"`
+	SHA256          string    `json:"sha256"`
+	Version         int       `json:"version"`
+	ThumbnailStatus string    `json:"thumbnailStatus"`
+	TextStatus      string    `json:"textStatus"`
+	ScanStatus      string    `json:"scanStatus"`
+	ScanSignature   string    `json:"scanSignature,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+	// UpdatedAt is when the current content was stored, by an upload or a restore
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Malware scan states of a file: pending until the scan job has seen its content, then clean,
+// infected and quarantined, failed if the scanner could not tell, or skipped when no scanner
+// is configured
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanFailed   = "failed"
+	ScanSkipped  = "skipped"
+)
+
+// ScanAllowsDownload reports whether content with a scan status may be downloaded
+func ScanAllowsDownload(status string) bool {
+	return status == ScanClean || status == ScanSkipped
+}
+
+// Thumbnail states of a file: pending until the thumbnail job has seen its content,
+// then ready, none for types without thumbnails, or failed
+const (
+	ThumbnailPending = "pending"
+	ThumbnailReady   = "ready"
+	ThumbnailNone    = "none"
+	ThumbnailFailed  = "failed"
+)
+
+// Thumbnail is a scaled down image of a blob, stored as a blob itself
+type Thumbnail struct {
+	SourceKey string    `json:"sourceKey"`
+	Size      int       `json:"size"`
+	Key       string    `json:"key"`
+	UserID    int       `json:"userId"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Text extraction states of a file: pending until the extraction job has seen its content,
+// then ready, none for types without an extractor, or failed
+const (
+	TextPending = "pending"
+	TextReady   = "ready"
+	TextNone    = "none"
+	TextFailed  = "failed"
+)
+
+// FileText is the text extracted from the current content of a file
+type FileText struct {
+	FileID      int       `json:"fileId"`
+	UserID      int       `json:"userId"`
+	Status      string    `json:"status"`
+	Extractor   string    `json:"extractor"`
+	Text        string    `json:"text"`
+	Truncated   bool      `json:"truncated"`
+	ExtractedAt time.Time `json:"extractedAt"`
+}
+
+// FileVersion is the content a file had at one version, the current one included
+type FileVersion struct {
+	ID            int       `json:"id"`
+	FileID        int       `json:"fileId"`
+	UserID        int       `json:"userId"`
+	Version       int       `json:"version"`
+	FileName      string    `json:"fileName"`
+	FileSize      int64     `json:"fileSize"`
+	FileType      string    `json:"fileType"`
+	FilePath      string    `json:"filePath"`
+	SHA256        string    `json:"sha256"`
+	Current       bool      `json:"current"`
+	ScanStatus    string    `json:"scanStatus"`
+	ScanSignature string    `json:"scanSignature,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// FileLink is a signed URL anyone holding it can download a file with until it expires,
+// or until its first download if it is single use
+type FileLink struct {
+	ID               int        `json:"id"`
+	FileID           int        `json:"fileId"`
+	UserID           int        `json:"userId"`
+	URL              string     `json:"url"`
+	SingleUse        bool       `json:"singleUse"`
+	Downloads        int        `json:"downloads"`
+	LastDownloadedAt *time.Time `json:"lastDownloadedAt"`
+	ExpiresAt        time.Time  `json:"expiresAt"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+// AttachmentBlob is stored file content shared by all of a user's files with the same SHA-256 digest
+type AttachmentBlob struct {
+	Key       string    `json:"key"`
+	UserID    int       `json:"userId"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	RefCount  int       `json:"refCount"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// StorageUsage is the storage taken by a user's files against their quota
+type StorageUsage struct {
+	UsedBytes      int64         `json:"usedBytes"`
+	QuotaBytes     int64         `json:"quotaBytes"`     // 0 if unlimited
+	RemainingBytes int64         `json:"remainingBytes"` // 0 if unlimited
+	MaxFileSize    int64         `json:"maxFileSize"`
+	Files          int           `json:"files"`
+	Goals          []GoalStorage `json:"goals"`
+}
+
+// GoalStorage is the storage taken by the files of one goal
+type GoalStorage struct {
+	GoalID    int    `json:"goalId"` // 0 for files uploaded before goals were recorded
+	Title     string `json:"title"`
+	Files     int    `json:"files"`
+	UsedBytes int64  `json:"usedBytes"`
+}
+
+// Upload is a resumable upload that becomes a file attached to an entry once complete
+type Upload struct {
+	ID        string    `json:"id"`
 	UserID    int       `json:"userId"`
 	EntryID   int       `json:"entryId"`
+	GoalID    int       `json:"goalId"`
 	FileName  string    `json:"fileName"`
-	FileSize  int64     `json:"fileSize"`
-	FileType  string    `json:"fileType"`
-	FilePath  string    `json:"filePath"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	ExpiresAt time.Time `json:"expiresAt"`
 	CreatedAt time.Time `json:"createdAt"`
 }
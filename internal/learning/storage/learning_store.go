@@ -1,6 +1,7 @@
 package learningstorage
 
 import (
+	"database/sql"
 	"time"
 
 	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
@@ -30,15 +31,23 @@ func (service *learningStore) UpdateGoal(id int, userID int, title string, start
 	return nil
 }
 
-// DeleteGoal deletes a learning goal by ID.
+// DeleteGoal deletes a learning goal by ID, with its entries and their files.
 func (service *learningStore) DeleteGoal(id int, userID int) error {
-	_, err := service.DB.Exec(`
-		DELETE FROM learning_goals WHERE id=? and user_id=?
-	`, id, userID)
-	if err != nil {
-		return err
-	}
-	return nil
+	return service.deleteOwned(id, userID, `
+        DELETE FROM learning_file_versions WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=? and user_id=?))
+    `, `
+        DELETE FROM file_texts WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=? and user_id=?))
+    `, `
+        DELETE FROM file_links WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=? and user_id=?))
+    `, `
+        DELETE FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=? and user_id=?)
+    `, `
+        UPDATE uploads SET expires_at=created_at WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=? and user_id=?)
+    `, `
+        DELETE FROM learning_entries WHERE goal_id=? and user_id=?
+    `, `
+        DELETE FROM learning_goals WHERE id=? and user_id=?
+    `)
 }
 
 // GetAllGoalsByUserID returns all learning goals for a given user ID.
@@ -67,8 +76,8 @@ func (service *learningStore) GetAllGoalsByUserID(userID int) ([]learningmodel.L
 func (service *learningStore) GetGoalByID(id int) (learningmodel.LearningGoals, error) {
 	var goal learningmodel.LearningGoals
 	err := service.DB.QueryRow(`
-		SELECT id, title, startdate, enddate FROM learning_goals WHERE id=?
-	`, id).Scan(&goal.ID, &goal.Title, &goal.StartDate, &goal.EndDate)
+		SELECT id, user_id, title, startdate, enddate FROM learning_goals WHERE id=?
+	`, id).Scan(&goal.ID, &goal.UserID, &goal.Title, &goal.StartDate, &goal.EndDate)
 	if err != nil {
 		return goal, err
 	}
@@ -98,23 +107,48 @@ func (service *learningStore) UpdateEntry(id int, user_id int, title string, des
 	return nil
 }
 
-// DeleteEntry deletes a learning entry by ID.
+// DeleteEntry deletes a learning entry by ID, with its files.
 func (service *learningStore) DeleteEntry(id int, userID int) error {
-	_, err := service.DB.Exec(`
+	return service.deleteOwned(id, userID, `
+        DELETE FROM learning_file_versions WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id=? and user_id=?)
+    `, `
+        DELETE FROM file_texts WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id=? and user_id=?)
+    `, `
+        DELETE FROM file_links WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id=? and user_id=?)
+    `, `
+        DELETE FROM learning_files WHERE entry_id=? and user_id=?
+    `, `
+        UPDATE uploads SET expires_at=created_at WHERE entry_id=? and user_id=?
+    `, `
         DELETE FROM learning_entries WHERE id=? and user_id=?
-    `, id, userID)
+    `)
+}
+
+// deleteOwned runs the statements in order within one transaction, each with the ID of the
+// deleted item and of the user it has to belong to. Resumable uploads into deleted entries
+// are expired rather than deleted, so the expiry job removes their content.
+func (service *learningStore) deleteOwned(id int, userID int, statements ...string) error {
+	tx, err := service.DB.Begin()
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	for _, query := range statements {
+		_, err = tx.Exec(query, id, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-// GetAllEntriesByGoalID returns all learning entries for a given goal ID.
-func (service *learningStore) GetAllEntriesByGoalID(goalID int) ([]learningmodel.LearningEntry, error) {
+// GetAllEntriesByGoalID returns the learning entries of a user in a given goal.
+func (service *learningStore) GetAllEntriesByGoalID(goalID int, userID int) ([]learningmodel.LearningEntry, error) {
 	var entries []learningmodel.LearningEntry
 	rows, err := service.DB.Query(`
-        SELECT id, title, description, date, status FROM learning_entries WHERE goal_id=?
-    `, goalID)
+        SELECT id, title, description, date, status FROM learning_entries WHERE goal_id=? AND user_id=?
+    `, goalID, userID)
 	if err != nil {
 		return entries, err
 	}
@@ -135,53 +169,113 @@ func (service *learningStore) GetAllEntriesByGoalID(goalID int) ([]learningmodel
 func (service *learningStore) GetEntryByID(id int) (learningmodel.LearningEntry, error) {
 	var entry learningmodel.LearningEntry
 	err := service.DB.QueryRow(`
-        SELECT id, title, description, date, status FROM learning_entries WHERE id=?
-    `, id).Scan(&entry.ID, &entry.Title, &entry.Description, &entry.Date, &entry.Status)
+        SELECT id, goal_id, user_id, title, description, date, status FROM learning_entries WHERE id=?
+    `, id).Scan(&entry.ID, &entry.GoalID, &entry.UserID, &entry.Title, &entry.Description, &entry.Date, &entry.Status)
 	if err != nil {
 		return entry, err
 	}
 	return entry, nil
 }
 
-// CreateFile inserts a new learning file into the database and returns its ID.
-func (service *learningStore) CreateFile(entryID int, userID int, fileName string, fileSize int64, fileType string, filePath string) (int64, error) {
-	result, err := service.DB.Exec(`
-        INSERT INTO learning_files (entry_id, user_id, filename, filesize, filetype, filepath) VALUES (?, ?, ?, ?, ?, ?)
-    `, entryID, userID, fileName, fileSize, fileType, filePath)
+// CreateFile inserts a new learning file into the database with its first version and returns its ID.
+func (service *learningStore) CreateFile(entryID int, goalID int, userID int, fileName string, fileSize int64, fileType string, filePath string, sha256 string) (int64, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT INTO learning_files (entry_id, goal_id, user_id, filename, filesize, filetype, filepath, sha256) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, entryID, goalID, userID, fileName, fileSize, fileType, filePath, sha256)
 	if err != nil {
 		return 0, err
 	}
 	newID, _ := result.LastInsertId()
-	return newID, nil
+	err = addFileVersion(tx, newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, tx.Commit()
 }
 
-// UpdateFile updates an existing learning file.
-func (service *learningStore) UpdateFile(id int, userID int, fileName string, fileSize int64, fileType string, filePath string) error {
-	_, err := service.DB.Exec(`
-        UPDATE learning_files SET filename=?, filesize=?, filetype=?, filePath=? WHERE id=? and user_id=?
-    `, fileName, fileSize, fileType, filePath, id, userID)
+// UpdateFile replaces the content of a learning file with a new version, and deletes the
+// oldest versions so that keep remain. sql.ErrNoRows is returned if the user has no such file.
+func (service *learningStore) UpdateFile(id int, userID int, fileName string, fileSize int64, fileType string, filePath string, sha256 string, keep int) error {
+	tx, err := service.DB.Begin()
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        UPDATE learning_files SET filename=?, filesize=?, filetype=?, filePath=?, sha256=?, version=version+1, thumbnail_status='pending', text_status='pending', scan_status='pending', scan_signature=NULL, scanned_at=NULL WHERE id=? and user_id=?
+    `, fileName, fileSize, fileType, filePath, sha256, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	err = addFileVersion(tx, int64(id))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+        DELETE FROM learning_file_versions WHERE file_id=? AND version <= (SELECT version FROM learning_files WHERE id=?) - ?
+    `, id, id, keep)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// DeleteFile deletes a learning file by ID.
+// addFileVersion records the current content of a file as its current version
+func addFileVersion(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec(`
+        INSERT INTO learning_file_versions (file_id, user_id, version, filename, filesize, filetype, filepath, sha256, scan_status, scan_signature)
+        SELECT id, user_id, version, filename, filesize, filetype, filepath, sha256, scan_status, scan_signature FROM learning_files WHERE id=?
+    `, id)
+	return err
+}
+
+// DeleteFile deletes a learning file by ID with all its versions.
 func (service *learningStore) DeleteFile(id int, userID int) error {
-	_, err := service.DB.Exec(`
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM learning_file_versions WHERE file_id=? and user_id=?`,
+		`DELETE FROM file_texts WHERE file_id=? and user_id=?`,
+		`DELETE FROM file_links WHERE file_id=? and user_id=?`,
+	} {
+		_, err = tx.Exec(query, id, userID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
         DELETE FROM learning_files WHERE id=? and user_id=?
     `, id, userID)
 	if err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
 // GetAllFilesByGoalID returns all learning files for a given goal ID.
 func (service *learningStore) GetAllFilesByEntryID(entryID int) ([]learningmodel.LearningFiles, error) {
 	var files []learningmodel.LearningFiles
 	rows, err := service.DB.Query(`
-        SELECT id, filename, filesize, filetype, filepath FROM learning_files WHERE entry_id=?
+        SELECT f.id, f.user_id, COALESCE(f.goal_id, 0), f.entry_id, f.filename, f.filesize, f.filetype, f.filepath, COALESCE(f.sha256, ''), f.version, f.thumbnail_status, f.text_status, f.scan_status, COALESCE(f.scan_signature, ''), f.created_at, v.created_at
+        FROM learning_files f LEFT JOIN learning_file_versions v ON v.file_id=f.id AND v.version=f.version WHERE f.entry_id=?
     `, entryID)
 	if err != nil {
 		return files, err
@@ -190,10 +284,12 @@ func (service *learningStore) GetAllFilesByEntryID(entryID int) ([]learningmodel
 
 	for rows.Next() {
 		var file learningmodel.LearningFiles
-		err = rows.Scan(&file.ID, &file.FileName, &file.FileSize, &file.FileType, &file.FilePath)
+		var updatedAt sql.NullTime
+		err = rows.Scan(&file.ID, &file.UserID, &file.GoalID, &file.EntryID, &file.FileName, &file.FileSize, &file.FileType, &file.FilePath, &file.SHA256, &file.Version, &file.ThumbnailStatus, &file.TextStatus, &file.ScanStatus, &file.ScanSignature, &file.CreatedAt, &updatedAt)
 		if err != nil {
 			return files, err
 		}
+		file.UpdatedAt = fileUpdatedAt(file, updatedAt)
 		files = append(files, file)
 	}
 	return files, nil
@@ -202,11 +298,860 @@ func (service *learningStore) GetAllFilesByEntryID(entryID int) ([]learningmodel
 // GetFileByID returns a learning file by ID.
 func (service *learningStore) GetFileByID(id int) (learningmodel.LearningFiles, error) {
 	var file learningmodel.LearningFiles
+	var updatedAt sql.NullTime
 	err := service.DB.QueryRow(`
-        SELECT id, filename, filesize, filetype, filepath FROM learning_files WHERE id=?
-    `, id).Scan(&file.ID, &file.FileName, &file.FileSize, &file.FileType, &file.FilePath)
+        SELECT f.id, f.user_id, COALESCE(f.goal_id, 0), f.entry_id, f.filename, f.filesize, f.filetype, f.filepath, COALESCE(f.sha256, ''), f.version, f.thumbnail_status, f.text_status, f.scan_status, COALESCE(f.scan_signature, ''), f.created_at, v.created_at
+        FROM learning_files f LEFT JOIN learning_file_versions v ON v.file_id=f.id AND v.version=f.version WHERE f.id=?
+    `, id).Scan(&file.ID, &file.UserID, &file.GoalID, &file.EntryID, &file.FileName, &file.FileSize, &file.FileType, &file.FilePath, &file.SHA256, &file.Version, &file.ThumbnailStatus, &file.TextStatus, &file.ScanStatus, &file.ScanSignature, &file.CreatedAt, &updatedAt)
 	if err != nil {
 		return file, err
 	}
+	file.UpdatedAt = fileUpdatedAt(file, updatedAt)
 	return file, nil
 }
+
+// fileUpdatedAt returns when the current content of a file was stored, the time its current
+// version was recorded
+func fileUpdatedAt(file learningmodel.LearningFiles, versionCreatedAt sql.NullTime) time.Time {
+	if versionCreatedAt.Valid {
+		return versionCreatedAt.Time
+	}
+	return file.CreatedAt
+}
+
+// GetFileVersions returns the versions of a file, newest first.
+func (service *learningStore) GetFileVersions(fileID int) ([]learningmodel.FileVersion, error) {
+	versions := []learningmodel.FileVersion{}
+	rows, err := service.DB.Query(`
+        SELECT v.id, v.file_id, v.user_id, v.version, v.filename, v.filesize, v.filetype, v.filepath, COALESCE(v.sha256, ''), v.version=f.version, v.scan_status, COALESCE(v.scan_signature, ''), v.created_at
+        FROM learning_file_versions v JOIN learning_files f ON f.id=v.file_id
+        WHERE v.file_id=? ORDER BY v.version DESC
+    `, fileID)
+	if err != nil {
+		return versions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version learningmodel.FileVersion
+		err = rows.Scan(&version.ID, &version.FileID, &version.UserID, &version.Version, &version.FileName, &version.FileSize, &version.FileType, &version.FilePath, &version.SHA256, &version.Current, &version.ScanStatus, &version.ScanSignature, &version.CreatedAt)
+		if err != nil {
+			return versions, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// GetFileVersion returns one version of a file.
+func (service *learningStore) GetFileVersion(fileID int, version int) (learningmodel.FileVersion, error) {
+	var fileVersion learningmodel.FileVersion
+	err := service.DB.QueryRow(`
+        SELECT v.id, v.file_id, v.user_id, v.version, v.filename, v.filesize, v.filetype, v.filepath, COALESCE(v.sha256, ''), v.version=f.version, v.scan_status, COALESCE(v.scan_signature, ''), v.created_at
+        FROM learning_file_versions v JOIN learning_files f ON f.id=v.file_id
+        WHERE v.file_id=? AND v.version=?
+    `, fileID, version).Scan(&fileVersion.ID, &fileVersion.FileID, &fileVersion.UserID, &fileVersion.Version, &fileVersion.FileName, &fileVersion.FileSize, &fileVersion.FileType, &fileVersion.FilePath, &fileVersion.SHA256, &fileVersion.Current, &fileVersion.ScanStatus, &fileVersion.ScanSignature, &fileVersion.CreatedAt)
+	return fileVersion, err
+}
+
+// GetFileVersionsKept returns how many versions of each file are kept for a user,
+// nil if they have the default. sql.ErrNoRows is returned if the user does not exist.
+func (service *learningStore) GetFileVersionsKept(userID int) (*int, error) {
+	var kept *int
+	err := service.DB.QueryRow(`
+        SELECT file_versions_kept FROM users WHERE id=?
+    `, userID).Scan(&kept)
+	return kept, err
+}
+
+// CreateFileLink inserts a new shared link to a file.
+func (service *learningStore) CreateFileLink(link learningmodel.FileLink) (int64, error) {
+	result, err := service.DB.Exec(`
+        INSERT INTO file_links (file_id, user_id, single_use, expires_at, created_at) VALUES (?, ?, ?, ?, ?)
+    `, link.FileID, link.UserID, link.SingleUse, link.ExpiresAt.UTC(), link.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetFileLinks returns the shared links to a file, newest first.
+func (service *learningStore) GetFileLinks(fileID int) ([]learningmodel.FileLink, error) {
+	links := []learningmodel.FileLink{}
+	rows, err := service.DB.Query(`
+        SELECT id, file_id, user_id, single_use, downloads, last_downloaded_at, expires_at, created_at FROM file_links WHERE file_id=? ORDER BY id DESC
+    `, fileID)
+	if err != nil {
+		return links, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link learningmodel.FileLink
+		err = rows.Scan(&link.ID, &link.FileID, &link.UserID, &link.SingleUse, &link.Downloads, &link.LastDownloadedAt, &link.ExpiresAt, &link.CreatedAt)
+		if err != nil {
+			return links, err
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// GetFileLink returns a shared link by ID.
+func (service *learningStore) GetFileLink(id int) (learningmodel.FileLink, error) {
+	var link learningmodel.FileLink
+	err := service.DB.QueryRow(`
+        SELECT id, file_id, user_id, single_use, downloads, last_downloaded_at, expires_at, created_at FROM file_links WHERE id=?
+    `, id).Scan(&link.ID, &link.FileID, &link.UserID, &link.SingleUse, &link.Downloads, &link.LastDownloadedAt, &link.ExpiresAt, &link.CreatedAt)
+	return link, err
+}
+
+// UseFileLink counts a download through a shared link. sql.ErrNoRows is returned if the link
+// does not exist, has expired or is single use and was already used, so two requests
+// racing for a single use link cannot both download.
+func (service *learningStore) UseFileLink(id int, now time.Time) error {
+	result, err := service.DB.Exec(`
+        UPDATE file_links SET downloads=downloads+1, last_downloaded_at=?
+        WHERE id=? AND expires_at>? AND (single_use=0 OR downloads=0)
+    `, now.UTC(), id, now.UTC())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteFileLink revokes a shared link to a file. sql.ErrNoRows is returned if it does not exist.
+func (service *learningStore) DeleteFileLink(id int, fileID int) error {
+	result, err := service.DB.Exec(`
+        DELETE FROM file_links WHERE id=? AND file_id=?
+    `, id, fileID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetAllEntriesByUserID returns all learning entries of a user.
+func (service *learningStore) GetAllEntriesByUserID(userID int) ([]learningmodel.LearningEntry, error) {
+	var entries []learningmodel.LearningEntry
+	rows, err := service.DB.Query(`
+        SELECT id, goal_id, user_id, title, description, date, status FROM learning_entries WHERE user_id=?
+    `, userID)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry learningmodel.LearningEntry
+		err = rows.Scan(&entry.ID, &entry.GoalID, &entry.UserID, &entry.Title, &entry.Description, &entry.Date, &entry.Status)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetAllFilesByUserID returns all learning files of a user.
+func (service *learningStore) GetAllFilesByUserID(userID int) ([]learningmodel.LearningFiles, error) {
+	var files []learningmodel.LearningFiles
+	rows, err := service.DB.Query(`
+        SELECT id, user_id, COALESCE(goal_id, 0), entry_id, filename, filesize, filetype, filepath, COALESCE(sha256, ''), version, scan_status, COALESCE(scan_signature, ''), created_at FROM learning_files WHERE user_id=?
+    `, userID)
+	if err != nil {
+		return files, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file learningmodel.LearningFiles
+		err = rows.Scan(&file.ID, &file.UserID, &file.GoalID, &file.EntryID, &file.FileName, &file.FileSize, &file.FileType, &file.FilePath, &file.SHA256, &file.Version, &file.ScanStatus, &file.ScanSignature, &file.CreatedAt)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// PurgeUserContent deletes all goals, entries and files of a user,
+// and returns the paths of the deleted files.
+func (service *learningStore) PurgeUserContent(userID int) ([]string, error) {
+	var paths []string
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return paths, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+        SELECT filepath FROM learning_files WHERE user_id=?
+    `, userID)
+	if err != nil {
+		return paths, err
+	}
+	for rows.Next() {
+		var path string
+		err = rows.Scan(&path)
+		if err != nil {
+			rows.Close()
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	rows.Close()
+
+	for _, query := range []string{
+		`DELETE FROM learning_file_versions WHERE user_id=?`,
+		`DELETE FROM learning_files WHERE user_id=?`,
+		`DELETE FROM attachment_blobs WHERE user_id=?`,
+		`DELETE FROM file_thumbnails WHERE user_id=?`,
+		`DELETE FROM file_texts WHERE user_id=?`,
+		`DELETE FROM file_links WHERE user_id=?`,
+		`DELETE FROM uploads WHERE user_id=?`,
+		`DELETE FROM learning_entries WHERE user_id=?`,
+		`DELETE FROM learning_goals WHERE user_id=?`,
+	} {
+		_, err = tx.Exec(query, userID)
+		if err != nil {
+			return paths, err
+		}
+	}
+	return paths, tx.Commit()
+}
+
+// PurgeGoal deletes a goal with all its entries and files regardless of owner,
+// and returns the paths of the deleted files.
+func (service *learningStore) PurgeGoal(id int) ([]string, error) {
+	return service.purge(`
+        SELECT filepath FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=?)
+    `, id, `
+        DELETE FROM learning_file_versions WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=?))
+    `, `
+        DELETE FROM file_texts WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=?))
+    `, `
+        DELETE FROM file_links WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=?))
+    `, `
+        DELETE FROM learning_files WHERE entry_id IN (SELECT id FROM learning_entries WHERE goal_id=?)
+    `, `
+        DELETE FROM learning_entries WHERE goal_id=?
+    `, `
+        DELETE FROM learning_goals WHERE id=?
+    `)
+}
+
+// PurgeEntry deletes an entry with all its files regardless of owner,
+// and returns the paths of the deleted files.
+func (service *learningStore) PurgeEntry(id int) ([]string, error) {
+	return service.purge(`
+        SELECT filepath FROM learning_files WHERE entry_id=?
+    `, id, `
+        DELETE FROM learning_file_versions WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id=?)
+    `, `
+        DELETE FROM file_texts WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id=?)
+    `, `
+        DELETE FROM file_links WHERE file_id IN (SELECT id FROM learning_files WHERE entry_id=?)
+    `, `
+        DELETE FROM learning_files WHERE entry_id=?
+    `, `
+        DELETE FROM learning_entries WHERE id=?
+    `)
+}
+
+// PurgeFile deletes a file regardless of owner and returns its path.
+func (service *learningStore) PurgeFile(id int) ([]string, error) {
+	return service.purge(`
+        SELECT filepath FROM learning_files WHERE id=?
+    `, id, `
+        DELETE FROM learning_file_versions WHERE file_id=?
+    `, `
+        DELETE FROM file_texts WHERE file_id=?
+    `, `
+        DELETE FROM file_links WHERE file_id=?
+    `, `
+        DELETE FROM learning_files WHERE id=?
+    `)
+}
+
+// purge collects the file paths selected by pathQuery, then runs the delete
+// statements in order within one transaction. The last statement deletes the
+// purged item itself; sql.ErrNoRows is returned if it did not exist.
+func (service *learningStore) purge(pathQuery string, id int, deletes ...string) ([]string, error) {
+	var paths []string
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return paths, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(pathQuery, id)
+	if err != nil {
+		return paths, err
+	}
+	for rows.Next() {
+		var path string
+		err = rows.Scan(&path)
+		if err != nil {
+			rows.Close()
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	rows.Close()
+
+	var result sql.Result
+	for _, query := range deletes {
+		result, err = tx.Exec(query, id)
+		if err != nil {
+			return paths, err
+		}
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return paths, err
+	}
+	if affected == 0 {
+		return paths, sql.ErrNoRows
+	}
+	return paths, tx.Commit()
+}
+
+// StorageUsedQuery selects the total size of the content user ?1 stores, for their files and the
+// versions kept of them. Content is counted once however many files and versions use it, as it
+// is stored once. Every figure of storage used is based on it, so they all agree.
+const StorageUsedQuery = `
+    SELECT COALESCE(SUM(filesize), 0) FROM (
+        SELECT MAX(filesize) AS filesize FROM (
+            SELECT filepath, filesize FROM learning_files WHERE user_id=?1
+            UNION ALL
+            SELECT filepath, filesize FROM learning_file_versions WHERE user_id=?1
+        ) GROUP BY filepath
+    )`
+
+// GetStorageUsage returns the total size of the content a user stores, as StorageUsedQuery counts it,
+// and the storage quota set on the user, nil if they have the default quota.
+// sql.ErrNoRows is returned if the user does not exist.
+func (service *learningStore) GetStorageUsage(userID int) (int64, *int64, error) {
+	var used int64
+	var quota *int64
+	err := service.DB.QueryRow(`
+        SELECT (`+StorageUsedQuery+`), storage_quota FROM users WHERE id=?1
+    `, userID).Scan(&used, &quota)
+	return used, quota, err
+}
+
+// GetStorageByGoal returns the number of a user's files per goal and the size of the content
+// they store, largest first. Content is counted like StorageUsedQuery does, versions included,
+// in the goal of the oldest file using it, so the sizes add up to the storage used.
+func (service *learningStore) GetStorageByGoal(userID int) ([]learningmodel.GoalStorage, error) {
+	goals := []learningmodel.GoalStorage{}
+	rows, err := service.DB.Query(`
+        WITH content AS (
+            SELECT id AS file_id, COALESCE(goal_id, 0) AS goal_id, filepath, filesize FROM learning_files WHERE user_id=?1
+            UNION ALL
+            SELECT v.file_id, COALESCE(f.goal_id, 0), v.filepath, v.filesize
+            FROM learning_file_versions v JOIN learning_files f ON f.id=v.file_id WHERE v.user_id=?1
+        ), stored AS (
+            SELECT MIN(file_id), goal_id, filesize FROM content GROUP BY filepath
+        ), used AS (
+            SELECT goal_id, SUM(filesize) AS used_bytes FROM stored GROUP BY goal_id
+        ), counted AS (
+            SELECT COALESCE(goal_id, 0) AS goal_id, COUNT(*) AS files FROM learning_files WHERE user_id=?1 GROUP BY COALESCE(goal_id, 0)
+        )
+        SELECT c.goal_id, COALESCE(g.title, ''), c.files, COALESCE(u.used_bytes, 0)
+        FROM counted c LEFT JOIN used u ON u.goal_id=c.goal_id LEFT JOIN learning_goals g ON g.id=c.goal_id AND g.user_id=?1
+        ORDER BY 4 DESC
+    `, userID)
+	if err != nil {
+		return goals, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var goal learningmodel.GoalStorage
+		err = rows.Scan(&goal.GoalID, &goal.Title, &goal.Files, &goal.UsedBytes)
+		if err != nil {
+			return goals, err
+		}
+		goals = append(goals, goal)
+	}
+	return goals, nil
+}
+
+// CreateUpload inserts a new resumable upload.
+func (service *learningStore) CreateUpload(upload learningmodel.Upload) error {
+	_, err := service.DB.Exec(`
+        INSERT INTO uploads (id, user_id, entry_id, goal_id, filename, length, upload_offset, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, upload.ID, upload.UserID, upload.EntryID, upload.GoalID, upload.FileName, upload.Length, upload.Offset, upload.ExpiresAt.UTC(), upload.CreatedAt.UTC())
+	return err
+}
+
+// GetUpload returns a resumable upload by ID.
+func (service *learningStore) GetUpload(id string) (learningmodel.Upload, error) {
+	var upload learningmodel.Upload
+	err := service.DB.QueryRow(`
+        SELECT id, user_id, entry_id, goal_id, filename, length, upload_offset, expires_at, created_at FROM uploads WHERE id=?
+    `, id).Scan(&upload.ID, &upload.UserID, &upload.EntryID, &upload.GoalID, &upload.FileName, &upload.Length, &upload.Offset, &upload.ExpiresAt, &upload.CreatedAt)
+	return upload, err
+}
+
+// UpdateUploadOffset records how much of an upload has been received and when it expires.
+func (service *learningStore) UpdateUploadOffset(id string, offset int64, expiresAt time.Time) error {
+	_, err := service.DB.Exec(`
+        UPDATE uploads SET upload_offset=?, expires_at=? WHERE id=?
+    `, offset, expiresAt.UTC(), id)
+	return err
+}
+
+// DeleteUpload deletes a resumable upload.
+func (service *learningStore) DeleteUpload(id string) error {
+	_, err := service.DB.Exec(`
+        DELETE FROM uploads WHERE id=?
+    `, id)
+	return err
+}
+
+// GetExpiredUploads returns the uploads that expired before now.
+func (service *learningStore) GetExpiredUploads(now time.Time) ([]learningmodel.Upload, error) {
+	var uploads []learningmodel.Upload
+	rows, err := service.DB.Query(`
+        SELECT id, user_id, entry_id, goal_id, filename, length, upload_offset, expires_at, created_at FROM uploads WHERE expires_at<?
+    `, now.UTC())
+	if err != nil {
+		return uploads, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var upload learningmodel.Upload
+		err = rows.Scan(&upload.ID, &upload.UserID, &upload.EntryID, &upload.GoalID, &upload.FileName, &upload.Length, &upload.Offset, &upload.ExpiresAt, &upload.CreatedAt)
+		if err != nil {
+			return uploads, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+// GetPendingUploadSize returns the total length of a user's uploads that have not expired by now.
+func (service *learningStore) GetPendingUploadSize(userID int, now time.Time) (int64, error) {
+	var size int64
+	err := service.DB.QueryRow(`
+        SELECT COALESCE(SUM(length), 0) FROM uploads WHERE user_id=? AND expires_at>=?
+    `, userID, now.UTC()).Scan(&size)
+	return size, err
+}
+
+// timestampFormat matches CURRENT_TIMESTAMP, which the blob triggers write, so times compare as text
+const timestampFormat = "2006-01-02 15:04:05"
+
+// CreateBlob records a blob before its content is stored, or refreshes the record if it exists,
+// so it is not collected as garbage before a file references it.
+func (service *learningStore) CreateBlob(key string, userID int, sha256 string, size int64) error {
+	_, err := service.DB.Exec(`
+        INSERT INTO attachment_blobs (blob_key, user_id, sha256, size, updated_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+        ON CONFLICT (blob_key) DO UPDATE SET updated_at=CURRENT_TIMESTAMP
+    `, key, userID, sha256, size)
+	return err
+}
+
+// GetAllBlobs returns every recorded blob.
+func (service *learningStore) GetAllBlobs() ([]learningmodel.AttachmentBlob, error) {
+	var blobs []learningmodel.AttachmentBlob
+	rows, err := service.DB.Query(`
+        SELECT blob_key, user_id, sha256, size, ref_count, updated_at FROM attachment_blobs ORDER BY blob_key
+    `)
+	if err != nil {
+		return blobs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var blob learningmodel.AttachmentBlob
+		err = rows.Scan(&blob.Key, &blob.UserID, &blob.SHA256, &blob.Size, &blob.RefCount, &blob.UpdatedAt)
+		if err != nil {
+			return blobs, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, nil
+}
+
+// GetUnreferencedBlobs returns the keys of blobs no file has referenced since before.
+func (service *learningStore) GetUnreferencedBlobs(before time.Time) ([]string, error) {
+	var keys []string
+	rows, err := service.DB.Query(`
+        SELECT blob_key FROM attachment_blobs WHERE ref_count<=0 AND updated_at<?
+    `, before.UTC().Format(timestampFormat))
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// DeleteUnreferencedBlob deletes the record of a blob if it is still unreferenced since before.
+// sql.ErrNoRows is returned if it was referenced again in the meantime.
+func (service *learningStore) DeleteUnreferencedBlob(key string, before time.Time) error {
+	result, err := service.DB.Exec(`
+        DELETE FROM attachment_blobs WHERE blob_key=? AND ref_count<=0 AND updated_at<?
+    `, key, before.UTC().Format(timestampFormat))
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsBlobKnown reports whether a key in the blob store is recorded as a blob or used by a file.
+func (service *learningStore) IsBlobKnown(key string) (bool, error) {
+	var known bool
+	err := service.DB.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM attachment_blobs WHERE blob_key=?)
+            OR EXISTS (SELECT 1 FROM learning_files WHERE filepath=?)
+            OR EXISTS (SELECT 1 FROM learning_file_versions WHERE filepath=?)
+            OR EXISTS (SELECT 1 FROM file_thumbnails WHERE blob_key=?)
+    `, key, key, key, key).Scan(&known)
+	return known, err
+}
+
+// GetFilesWithoutDigest returns the files uploaded before content addressing, which are stored by path.
+func (service *learningStore) GetFilesWithoutDigest() ([]learningmodel.LearningFiles, error) {
+	var files []learningmodel.LearningFiles
+	rows, err := service.DB.Query(`
+        SELECT id, user_id, entry_id, filename, filesize, filetype, filepath FROM learning_files WHERE sha256 IS NULL OR sha256=''
+    `)
+	if err != nil {
+		return files, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file learningmodel.LearningFiles
+		err = rows.Scan(&file.ID, &file.UserID, &file.EntryID, &file.FileName, &file.FileSize, &file.FileType, &file.FilePath)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// SetFileBlob points a file, and the versions with the same content, at a content-addressed blob.
+func (service *learningStore) SetFileBlob(id int, filePath string, sha256 string) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+        UPDATE learning_file_versions SET filepath=?, sha256=? WHERE file_id=? AND filepath=(SELECT filepath FROM learning_files WHERE id=?)
+    `, filePath, sha256, id, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+        UPDATE learning_files SET filepath=?, sha256=?, thumbnail_status='pending', text_status='pending' WHERE id=?
+    `, filePath, sha256, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetFilesPendingThumbnails returns up to limit files whose content the thumbnail job has not seen, oldest first.
+// Files not yet found free of malware wait for their scan, and so do files uploaded while no
+// scanner was configured unless skipped is set.
+func (service *learningStore) GetFilesPendingThumbnails(limit int, skipped bool) ([]learningmodel.LearningFiles, error) {
+	var files []learningmodel.LearningFiles
+	rows, err := service.DB.Query(`
+        SELECT id, user_id, filename, filetype, filepath, COALESCE(sha256, '') FROM learning_files WHERE thumbnail_status='pending' AND (scan_status='clean' OR (? AND scan_status='skipped')) ORDER BY id LIMIT ?
+    `, skipped, limit)
+	if err != nil {
+		return files, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file learningmodel.LearningFiles
+		err = rows.Scan(&file.ID, &file.UserID, &file.FileName, &file.FileType, &file.FilePath, &file.SHA256)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// SetThumbnailStatus sets the thumbnail status of a file, unless its content changed since filePath was read.
+func (service *learningStore) SetThumbnailStatus(id int, filePath string, status string) error {
+	_, err := service.DB.Exec(`
+        UPDATE learning_files SET thumbnail_status=? WHERE id=? AND filepath=?
+    `, status, id, filePath)
+	return err
+}
+
+// CreateThumbnail records a thumbnail, replacing one of the same blob and size.
+func (service *learningStore) CreateThumbnail(thumbnail learningmodel.Thumbnail) error {
+	_, err := service.DB.Exec(`
+        INSERT OR REPLACE INTO file_thumbnails (source_key, size, blob_key, user_id, width, height) VALUES (?, ?, ?, ?, ?, ?)
+    `, thumbnail.SourceKey, thumbnail.Size, thumbnail.Key, thumbnail.UserID, thumbnail.Width, thumbnail.Height)
+	return err
+}
+
+// GetThumbnails returns the thumbnails of a blob, smallest first.
+func (service *learningStore) GetThumbnails(sourceKey string) ([]learningmodel.Thumbnail, error) {
+	var thumbnails []learningmodel.Thumbnail
+	rows, err := service.DB.Query(`
+        SELECT source_key, size, blob_key, user_id, width, height, created_at FROM file_thumbnails WHERE source_key=? ORDER BY size
+    `, sourceKey)
+	if err != nil {
+		return thumbnails, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var thumbnail learningmodel.Thumbnail
+		err = rows.Scan(&thumbnail.SourceKey, &thumbnail.Size, &thumbnail.Key, &thumbnail.UserID, &thumbnail.Width, &thumbnail.Height, &thumbnail.CreatedAt)
+		if err != nil {
+			return thumbnails, err
+		}
+		thumbnails = append(thumbnails, thumbnail)
+	}
+	return thumbnails, nil
+}
+
+// DeleteThumbnails forgets the thumbnails of a blob and returns their keys.
+func (service *learningStore) DeleteThumbnails(sourceKey string) ([]string, error) {
+	var keys []string
+	rows, err := service.DB.Query(`
+        DELETE FROM file_thumbnails WHERE source_key=? RETURNING blob_key
+    `, sourceKey)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetFilesPendingText returns up to limit files whose content the text extraction job has not seen, oldest first.
+// Files not yet found free of malware wait for their scan, and so do files uploaded while no
+// scanner was configured unless skipped is set.
+func (service *learningStore) GetFilesPendingText(limit int, skipped bool) ([]learningmodel.LearningFiles, error) {
+	var files []learningmodel.LearningFiles
+	rows, err := service.DB.Query(`
+        SELECT id, user_id, filename, filetype, filepath FROM learning_files WHERE text_status='pending' AND (scan_status='clean' OR (? AND scan_status='skipped')) ORDER BY id LIMIT ?
+    `, skipped, limit)
+	if err != nil {
+		return files, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file learningmodel.LearningFiles
+		err = rows.Scan(&file.ID, &file.UserID, &file.FileName, &file.FileType, &file.FilePath)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// SetFileText records the outcome of extracting the text of a file, with the text if it is ready,
+// unless its content changed since filePath was read.
+func (service *learningStore) SetFileText(file learningmodel.LearningFiles, text learningmodel.FileText) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        UPDATE learning_files SET text_status=? WHERE id=? AND filepath=?
+    `, text.Status, file.ID, file.FilePath)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return nil
+	}
+	_, err = tx.Exec(`
+        DELETE FROM file_texts WHERE file_id=?
+    `, file.ID)
+	if err != nil {
+		return err
+	}
+	if text.Status == learningmodel.TextReady {
+		_, err = tx.Exec(`
+            INSERT INTO file_texts (file_id, user_id, source_key, extractor, content, truncated) VALUES (?, ?, ?, ?, ?, ?)
+        `, file.ID, file.UserID, file.FilePath, text.Extractor, text.Text, text.Truncated)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetFileText returns the extracted text of a file, empty unless its text status is ready.
+func (service *learningStore) GetFileText(fileID int) (learningmodel.FileText, error) {
+	var text learningmodel.FileText
+	var extractor, content sql.NullString
+	var truncated sql.NullBool
+	var extractedAt sql.NullTime
+	err := service.DB.QueryRow(`
+        SELECT f.id, f.user_id, f.text_status, t.extractor, t.content, t.truncated, t.extracted_at
+        FROM learning_files f LEFT JOIN file_texts t ON t.file_id=f.id WHERE f.id=?
+    `, fileID).Scan(&text.FileID, &text.UserID, &text.Status, &extractor, &content, &truncated, &extractedAt)
+	text.Extractor = extractor.String
+	text.Text = content.String
+	text.Truncated = truncated.Bool
+	text.ExtractedAt = extractedAt.Time
+	return text, err
+}
+
+// ResetTextStatus queues every file for text extraction again and returns how many there are.
+func (service *learningStore) ResetTextStatus() (int64, error) {
+	result, err := service.DB.Exec(`
+        UPDATE learning_files SET text_status='pending'
+    `)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetFilesPendingScan returns up to limit files whose content the malware scan job has not seen,
+// oldest first, with those uploaded while no scanner was configured if rescanSkipped is set.
+func (service *learningStore) GetFilesPendingScan(limit int, rescanSkipped bool) ([]learningmodel.LearningFiles, error) {
+	var files []learningmodel.LearningFiles
+	rows, err := service.DB.Query(`
+        SELECT id, user_id, filename, filetype, filepath, scan_status FROM learning_files
+        WHERE scan_status='pending' OR (? AND scan_status='skipped') ORDER BY id LIMIT ?
+    `, rescanSkipped, limit)
+	if err != nil {
+		return files, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file learningmodel.LearningFiles
+		err = rows.Scan(&file.ID, &file.UserID, &file.FileName, &file.FileType, &file.FilePath, &file.ScanStatus)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// SetScanStatus records the outcome of scanning the content of a file, on the file and on its
+// versions with the same content, unless its content changed since filePath was read.
+func (service *learningStore) SetScanStatus(id int, filePath string, status string, signature string) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        UPDATE learning_files SET scan_status=?, scan_signature=NULLIF(?, ''), scanned_at=CURRENT_TIMESTAMP WHERE id=? AND filepath=?
+    `, status, signature, id, filePath)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return nil
+	}
+	_, err = tx.Exec(`
+        UPDATE learning_file_versions SET scan_status=?, scan_signature=NULLIF(?, '') WHERE file_id=? AND filepath=?
+    `, status, signature, id, filePath)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetVersionsPendingScan returns up to limit earlier versions of files whose content the malware
+// scan job has not seen, oldest first, with those recorded while no scanner was configured if
+// rescanSkipped is set. Versions with the current content of their file are scanned with the file.
+func (service *learningStore) GetVersionsPendingScan(limit int, rescanSkipped bool) ([]learningmodel.FileVersion, error) {
+	versions := []learningmodel.FileVersion{}
+	rows, err := service.DB.Query(`
+        SELECT v.id, v.file_id, v.user_id, v.version, v.filepath, v.scan_status
+        FROM learning_file_versions v JOIN learning_files f ON f.id=v.file_id
+        WHERE v.filepath!=f.filepath AND (v.scan_status='pending' OR (? AND v.scan_status='skipped'))
+        ORDER BY v.id LIMIT ?
+    `, rescanSkipped, limit)
+	if err != nil {
+		return versions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version learningmodel.FileVersion
+		err = rows.Scan(&version.ID, &version.FileID, &version.UserID, &version.Version, &version.FilePath, &version.ScanStatus)
+		if err != nil {
+			return versions, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// SetVersionScanStatus records the outcome of scanning the content of a version, unless its
+// content moved since filePath was read.
+func (service *learningStore) SetVersionScanStatus(id int, filePath string, status string, signature string) error {
+	_, err := service.DB.Exec(`
+        UPDATE learning_file_versions SET scan_status=?, scan_signature=NULLIF(?, '') WHERE id=? AND filepath=?
+    `, status, signature, id, filePath)
+	return err
+}
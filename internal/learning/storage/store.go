@@ -21,15 +21,77 @@ type LearningStore interface {
 	CreateEntry(goalID int, user_id int, title string, description string) (int64, error)
 	UpdateEntry(id int, userID int, title string, description string, status string) error
 	DeleteEntry(id int, userID int) error
-	GetAllEntriesByGoalID(goalID int) ([]learningmodel.LearningEntry, error)
+	GetAllEntriesByGoalID(goalID int, userID int) ([]learningmodel.LearningEntry, error)
 	GetEntryByID(id int) (learningmodel.LearningEntry, error)
 
 	// Learning file operations
-	CreateFile(entryID int, userID int, fileName string, fileSize int64, fileType string, filePath string) (int64, error)
-	UpdateFile(id int, userID int, fileName string, fileSize int64, fileType string, filePath string) error
+	CreateFile(entryID int, goalID int, userID int, fileName string, fileSize int64, fileType string, filePath string, sha256 string) (int64, error)
+	UpdateFile(id int, userID int, fileName string, fileSize int64, fileType string, filePath string, sha256 string, keep int) error
 	DeleteFile(id int, userID int) error
 	GetAllFilesByEntryID(entryID int) ([]learningmodel.LearningFiles, error)
 	GetFileByID(id int) (learningmodel.LearningFiles, error)
+
+	// File version operations, every change of a file's content is a new version
+	GetFileVersions(fileID int) ([]learningmodel.FileVersion, error)
+	GetFileVersion(fileID int, version int) (learningmodel.FileVersion, error)
+	GetFileVersionsKept(userID int) (*int, error)
+
+	// Shared link operations, links are deleted with their file
+	CreateFileLink(link learningmodel.FileLink) (int64, error)
+	GetFileLinks(fileID int) ([]learningmodel.FileLink, error)
+	GetFileLink(id int) (learningmodel.FileLink, error)
+	UseFileLink(id int, now time.Time) error
+	DeleteFileLink(id int, fileID int) error
+
+	// Thumbnail operations, thumbnails belong to blobs and are shared by the files using them
+	GetFilesPendingThumbnails(limit int, skipped bool) ([]learningmodel.LearningFiles, error)
+	SetThumbnailStatus(id int, filePath string, status string) error
+	CreateThumbnail(thumbnail learningmodel.Thumbnail) error
+	GetThumbnails(sourceKey string) ([]learningmodel.Thumbnail, error)
+	DeleteThumbnails(sourceKey string) ([]string, error)
+
+	// Text extraction operations
+	GetFilesPendingText(limit int, skipped bool) ([]learningmodel.LearningFiles, error)
+	SetFileText(file learningmodel.LearningFiles, text learningmodel.FileText) error
+	GetFileText(fileID int) (learningmodel.FileText, error)
+	ResetTextStatus() (int64, error)
+
+	// Malware scan operations, files are downloadable once found clean
+	GetFilesPendingScan(limit int, rescanSkipped bool) ([]learningmodel.LearningFiles, error)
+	SetScanStatus(id int, filePath string, status string, signature string) error
+	GetVersionsPendingScan(limit int, rescanSkipped bool) ([]learningmodel.FileVersion, error)
+	SetVersionScanStatus(id int, filePath string, status string, signature string) error
+
+	// Account operations, for exporting and erasing a user's data
+	GetAllEntriesByUserID(userID int) ([]learningmodel.LearningEntry, error)
+	GetAllFilesByUserID(userID int) ([]learningmodel.LearningFiles, error)
+	PurgeUserContent(userID int) ([]string, error)
+
+	// Moderation operations, not restricted to the owner
+	PurgeGoal(id int) ([]string, error)
+	PurgeEntry(id int) ([]string, error)
+	PurgeFile(id int) ([]string, error)
+
+	// Storage accounting operations
+	GetStorageUsage(userID int) (int64, *int64, error)
+	GetStorageByGoal(userID int) ([]learningmodel.GoalStorage, error)
+
+	// Resumable upload operations
+	CreateUpload(upload learningmodel.Upload) error
+	GetUpload(id string) (learningmodel.Upload, error)
+	UpdateUploadOffset(id string, offset int64, expiresAt time.Time) error
+	DeleteUpload(id string) error
+	GetExpiredUploads(now time.Time) ([]learningmodel.Upload, error)
+	GetPendingUploadSize(userID int, now time.Time) (int64, error)
+
+	// Attachment blob operations, reference counts follow the learning_files rows
+	CreateBlob(key string, userID int, sha256 string, size int64) error
+	GetAllBlobs() ([]learningmodel.AttachmentBlob, error)
+	GetUnreferencedBlobs(before time.Time) ([]string, error)
+	DeleteUnreferencedBlob(key string, before time.Time) error
+	IsBlobKnown(key string) (bool, error)
+	GetFilesWithoutDigest() ([]learningmodel.LearningFiles, error)
+	SetFileBlob(id int, filePath string, sha256 string) error
 }
 
 type learningStore struct {
@@ -0,0 +1,54 @@
+package learningtransport
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handle hard delete of any user's goal with its entries and files
+func (h *LearningHandler) PurgeGoal(c *gin.Context) {
+	h.purge(c, "Goal", h.learningHandler.PurgeGoal)
+}
+
+// Handle hard delete of any user's entry with its files
+func (h *LearningHandler) PurgeEntry(c *gin.Context) {
+	h.purge(c, "Entry", h.learningHandler.PurgeEntry)
+}
+
+// Handle hard delete of any user's file
+func (h *LearningHandler) PurgeFile(c *gin.Context) {
+	h.purge(c, "File", h.learningHandler.PurgeFile)
+}
+
+func (h *LearningHandler) purge(c *gin.Context, kind string, purge func(id int) ([]string, error)) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid %s ID", kind),
+		})
+		return
+	}
+	paths, err := purge(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("%s#%d not found", kind, id),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	// The content of the files is collected once no file uses it
+	c.Set("auditDetails", fmt.Sprintf("files=%d", len(paths)))
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%s#%d is purged with %d file(s)", kind, id, len(paths)),
+	})
+}
@@ -0,0 +1,65 @@
+package learningtransport
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// Handle download of a zip archive of a goal with the attachments of all its entries
+func (h *LearningHandler) GetGoalArchive(c *gin.Context) {
+	goal, ok := h.ownGoal(c)
+	if !ok {
+		return
+	}
+	contents, err := h.learningHandler.GoalArchiveContents(goal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	h.sendArchive(c, contents, archiveFileName(goal.Title, fmt.Sprintf("goal-%d", goal.ID)))
+}
+
+// Handle download of a zip archive of an entry with its attachments
+func (h *LearningHandler) GetEntryArchive(c *gin.Context) {
+	entry, ok := h.ownEntry(c)
+	if !ok {
+		return
+	}
+	contents, err := h.learningHandler.EntryArchiveContents(entry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	h.sendArchive(c, contents, archiveFileName(entry.Title, fmt.Sprintf("entry-%d", entry.ID)))
+}
+
+// sendArchive streams the archive of a goal as the response. Its size is not known in advance,
+// so it is sent chunked, and an error once it has started can only cut the archive short,
+// which unzipping reports as a damaged archive.
+func (h *LearningHandler) sendArchive(c *gin.Context, contents learningmodel.LearningGoals, fileName string) {
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", contentDisposition("application/zip", fileName))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	err := h.learningHandler.WriteArchive(c, contents, c.Writer)
+	if err != nil {
+		log.Printf("archive %s: %v", fileName, err)
+	}
+}
+
+// archiveFileName returns the name a downloaded archive is saved as, named after a title
+func archiveFileName(title string, fallback string) string {
+	if strings.TrimSpace(title) == "" {
+		return fallback + ".zip"
+	}
+	return sanitizeFileName(strings.NewReplacer("/", "-", "\\", "-").Replace(title)) + ".zip"
+}
@@ -0,0 +1,147 @@
+package learningtransport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// storedContent is content of the blob store sent as a response
+type storedContent struct {
+	Key         string
+	ContentType string
+	// FileName is the name the content is saved as, no Content-Disposition is sent if empty
+	FileName string
+	// ETag is a strong validator of the content, like its SHA-256 digest, none is sent if empty
+	ETag string
+	// Immutable is set when the URL always returns the same content
+	Immutable bool
+	// ModTime is when the content was stored, sent as Last-Modified. Blobs are shared by
+	// content, so the time the blob was written may be older than the file using it.
+	ModTime time.Time
+}
+
+// sendContent streams stored content as the response. Range, If-Range, If-None-Match and
+// If-Modified-Since requests are answered from the ETag and ModTime.
+func (h *LearningHandler) sendContent(c *gin.Context, stored storedContent, notFound string) {
+	info, content, ok := h.openContent(c, stored.Key, notFound)
+	if !ok {
+		return
+	}
+	defer content.Close()
+	serveContent(c, stored, info, content)
+}
+
+// openContent opens stored content to send, or writes the response if it cannot be read:
+// 404 with the notFound message for missing content
+func (h *LearningHandler) openContent(c *gin.Context, key string, notFound string) (blob.Info, io.ReadCloser, bool) {
+	var content io.ReadCloser
+	info, err := h.blobs.Stat(c, key)
+	if err == nil {
+		content, err = h.blobs.Get(c, key)
+	}
+	if errors.Is(err, blob.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": notFound,
+		})
+		return info, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return info, nil, false
+	}
+	return info, content, true
+}
+
+// serveContent streams opened content as the response, like sendContent
+func serveContent(c *gin.Context, stored storedContent, info blob.Info, content io.ReadCloser) {
+	contentType := stored.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	// The type was detected on upload, browsers must not guess another one
+	header.Set("X-Content-Type-Options", "nosniff")
+	if stored.ETag != "" {
+		header.Set("ETag", `"`+stored.ETag+`"`)
+	}
+	if stored.Immutable {
+		header.Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "private, no-cache")
+	}
+	if stored.FileName != "" {
+		header.Set("Content-Disposition", contentDisposition(contentType, stored.FileName))
+	}
+	// Both stores return seekable content, which is needed to serve ranges
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", stored.ModTime, seeker)
+		return
+	}
+	c.DataFromReader(http.StatusOK, info.Size, contentType, content, nil)
+}
+
+// scanAllows checks the malware scan of content allows it to be downloaded, and otherwise
+// writes the response: 409 while the scan is pending, so the client can retry, and 403 for
+// infected content and content the scanner could not decide on
+func (h *LearningHandler) scanAllows(c *gin.Context, fileID int, status string, signature string) bool {
+	status = h.learningHandler.ScanStatus(status)
+	switch {
+	case learningmodel.ScanAllowsDownload(status):
+		return true
+	case status == learningmodel.ScanPending:
+		c.Header("Retry-After", "10")
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("File#%d is waiting for its malware scan", fileID),
+		})
+	case status == learningmodel.ScanInfected:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("File#%d is quarantined, malware was found: %s", fileID, signature),
+		})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("File#%d could not be scanned for malware", fileID),
+		})
+	}
+	return false
+}
+
+// contentDisposition returns the Content-Disposition of a file: inline for types browsers
+// display safely, so videos can be played and seeked, and attachment for the others.
+// Names outside ASCII are encoded as RFC 6266 describes.
+func contentDisposition(contentType string, fileName string) string {
+	disposition := "attachment"
+	if inlineType(contentType) {
+		disposition = "inline"
+	}
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": fileName}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// inlineType reports whether content of a type is displayed by browsers without running scripts
+func inlineType(contentType string) bool {
+	base, _, _ := strings.Cut(contentType, ";")
+	base = strings.ToLower(strings.TrimSpace(base))
+	if base == "image/svg+xml" {
+		return false
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(base, prefix) {
+			return true
+		}
+	}
+	return base == "application/pdf" || base == "text/plain"
+}
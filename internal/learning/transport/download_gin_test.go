@@ -0,0 +1,250 @@
+package learningtransport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+	"github.com/khoaphungnguyen/learning-tracker/internal/scanner"
+)
+
+// eicar is the EICAR anti-virus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func TestDownloadBlockedByScan(t *testing.T) {
+	h, s := newTestHandler(t)
+	s.Scanner = scanner.EICAR{}
+	s.LinkKey = []byte("secret")
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	infected := createTestFile(t, h, s, userID, entryID, "notes "+eicar)
+	clean := createTestFile(t, h, s, userID, entryID, "clean notes")
+	r := newTestRouter(h, userID)
+	download := func(fileID int) *httptest.ResponseRecorder {
+		return serve(r, httptest.NewRequest("GET", "/files/"+strconv.Itoa(fileID)+"/download", nil))
+	}
+
+	// Nothing can be downloaded before it is scanned
+	if w := download(infected); w.Code != http.StatusConflict {
+		t.Fatalf("download before the scan status = %d, want 409: %s", w.Code, w.Body)
+	}
+	_, err := s.ScanFiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := s.GetFileByID(infected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ScanStatus != learningmodel.ScanInfected || file.ScanSignature == "" {
+		t.Fatalf("infected file has scan status %q, signature %q", file.ScanStatus, file.ScanSignature)
+	}
+	if w := download(infected); w.Code != http.StatusForbidden {
+		t.Errorf("download of an infected file status = %d, want 403: %s", w.Code, w.Body)
+	}
+	if w := download(clean); w.Code != http.StatusOK || w.Body.String() != "clean notes" {
+		t.Errorf("download of a clean file status = %d: %s", w.Code, w.Body)
+	}
+
+	// Nor through a shared link, which is not used up by the attempt
+	link, err := s.CreateFileLink(infected, userID, time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(r, httptest.NewRequest("GET", link.URL, nil)); w.Code != http.StatusForbidden {
+		t.Errorf("link download of an infected file status = %d, want 403: %s", w.Code, w.Body)
+	}
+	links, err := s.GetFileLinks(infected)
+	if err != nil || len(links) != 1 || links[0].Downloads != 0 {
+		t.Errorf("links = %+v, %v, want no download", links, err)
+	}
+}
+
+func TestDownloadRanges(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, "0123456789")
+	file, err := s.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := `"` + file.SHA256 + `"`
+	r := newTestRouter(h, userID)
+	download := func(header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/files/"+strconv.Itoa(fileID)+"/download", nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return serve(r, req)
+	}
+
+	w := download()
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Fatalf("download status = %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("ETag = %q, want %q", got, etag)
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `inline; filename=notes.txt` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	tests := []struct {
+		name   string
+		header []string
+		code   int
+		body   string
+	}{
+		{"range", []string{"Range", "bytes=2-4"}, http.StatusPartialContent, "234"},
+		{"suffix range", []string{"Range", "bytes=-3"}, http.StatusPartialContent, "789"},
+		{"range past the end", []string{"Range", "bytes=20-"}, http.StatusRequestedRangeNotSatisfiable, ""},
+		{"range of the same content", []string{"Range", "bytes=2-4", "If-Range", etag}, http.StatusPartialContent, "234"},
+		{"range of changed content", []string{"Range", "bytes=2-4", "If-Range", `"other"`}, http.StatusOK, "0123456789"},
+		{"cached", []string{"If-None-Match", etag}, http.StatusNotModified, ""},
+		{"cached another content", []string{"If-None-Match", `"other"`}, http.StatusOK, "0123456789"},
+	}
+	for _, tt := range tests {
+		w := download(tt.header...)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: status = %d, body %q, want %d, %q", tt.name, w.Code, w.Body, tt.code, tt.body)
+		}
+	}
+	if w := download("Range", "bytes=2-4"); w.Header().Get("Content-Range") != "bytes 2-4/10" {
+		t.Errorf("Content-Range = %q", w.Header().Get("Content-Range"))
+	}
+}
+
+func TestDownloadLastModified(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, "first")
+	if w := updateTestFile(t, h, userID, fileID, "second"); w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body)
+	}
+	// The first content was stored three hours ago and the second two hours ago
+	now := time.Now().UTC().Truncate(time.Second)
+	for version, age := range map[int]time.Duration{1: 3 * time.Hour, 2: 2 * time.Hour} {
+		_, err := testDB.Exec(`UPDATE learning_file_versions SET created_at=? WHERE file_id=? AND version=?`, now.Add(-age), fileID, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := now.Add(-3 * time.Hour)
+	err := filepath.Walk(h.blobs.(*blob.LocalStore).Root, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return os.Chtimes(name, old, old)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(h, userID)
+	get := func(target string, modifiedSince time.Time) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if !modifiedSince.IsZero() {
+			req.Header.Set("If-Modified-Since", modifiedSince.Format(http.TimeFormat))
+		}
+		return serve(r, req)
+	}
+	download := "/files/" + strconv.Itoa(fileID) + "/download"
+	if w := get(download, time.Time{}); w.Header().Get("Last-Modified") != now.Add(-2*time.Hour).Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q, want the time of the second version", w.Header().Get("Last-Modified"))
+	}
+	if w := get(download, now.Add(-2*time.Hour)); w.Code != http.StatusNotModified {
+		t.Errorf("unchanged download status = %d, want 304", w.Code)
+	}
+	// Restoring the first content, whose blob is older, is a change
+	w := serve(r, httptest.NewRequest("POST", "/files/"+strconv.Itoa(fileID)+"/versions/1/restore", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore status = %d: %s", w.Code, w.Body)
+	}
+	if w := get(download, now.Add(-2*time.Hour)); w.Code != http.StatusOK || w.Body.String() != "first" {
+		t.Errorf("download after the restore status = %d: %s", w.Code, w.Body)
+	}
+	// A version was modified when it was stored
+	version := "/files/" + strconv.Itoa(fileID) + "/versions/1/download"
+	if w := get(version, time.Time{}); w.Header().Get("Last-Modified") != old.Format(http.TimeFormat) {
+		t.Errorf("version Last-Modified = %q, want the time of the version", w.Header().Get("Last-Modified"))
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		contentType string
+		fileName    string
+		want        string
+	}{
+		{"image/png", "photo.png", "inline; filename=photo.png"},
+		{"application/pdf", "paper.pdf", "inline; filename=paper.pdf"},
+		{"text/plain; charset=utf-8", "notes.txt", "inline; filename=notes.txt"},
+		{"image/svg+xml", "drawing.svg", "attachment; filename=drawing.svg"},
+		{"text/html; charset=utf-8", "page.html", "attachment; filename=page.html"},
+		{"application/zip", "notes.zip", "attachment; filename=notes.zip"},
+		{"application/pdf", "my paper.pdf", `inline; filename="my paper.pdf"`},
+		{"application/pdf", "résumé.pdf", "inline; filename*=utf-8''r%C3%A9sum%C3%A9.pdf"},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(tt.contentType, tt.fileName); got != tt.want {
+			t.Errorf("contentDisposition(%q, %q) = %q, want %q", tt.contentType, tt.fileName, got, tt.want)
+		}
+	}
+	if got := contentDisposition("application/pdf", "bad\x00name.pdf"); !strings.HasPrefix(got, "inline") {
+		t.Errorf("contentDisposition of an invalid name = %q", got)
+	}
+}
+
+func TestSkippedContentScannedOnceThereIsAScanner(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	// Both versions are uploaded while there is no scanner
+	fileID := createTestFile(t, h, s, userID, entryID, "notes "+eicar)
+	if w := updateTestFile(t, h, userID, fileID, "clean notes"); w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body)
+	}
+	r := newTestRouter(h, userID)
+	download := "/files/" + strconv.Itoa(fileID) + "/download"
+	firstVersion := "/files/" + strconv.Itoa(fileID) + "/versions/1/download"
+	if w := serve(r, httptest.NewRequest("GET", firstVersion, nil)); w.Code != http.StatusOK {
+		t.Fatalf("version download without a scanner status = %d: %s", w.Code, w.Body)
+	}
+
+	// Once a scanner is configured, skipped content waits for it
+	s.Scanner = scanner.EICAR{}
+	for _, target := range []string{download, firstVersion} {
+		if w := serve(r, httptest.NewRequest("GET", target, nil)); w.Code != http.StatusConflict {
+			t.Errorf("%s before the scan status = %d, want 409: %s", target, w.Code, w.Body)
+		}
+	}
+	_, err := s.ScanFiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := s.GetFileVersions(fileID)
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("versions = %+v, %v", versions, err)
+	}
+	if versions[0].ScanStatus != learningmodel.ScanClean || versions[1].ScanStatus != learningmodel.ScanInfected {
+		t.Errorf("versions scanned %q and %q, want clean and infected", versions[0].ScanStatus, versions[1].ScanStatus)
+	}
+	if w := serve(r, httptest.NewRequest("GET", download, nil)); w.Code != http.StatusOK || w.Body.String() != "clean notes" {
+		t.Errorf("download after the scan status = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(r, httptest.NewRequest("GET", firstVersion, nil)); w.Code != http.StatusForbidden {
+		t.Errorf("infected version download status = %d, want 403: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,112 @@
+package learningtransport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// DefaultDeniedTypes are the attachment types rejected unless configured otherwise:
+// executables, and documents a browser would run scripts in when downloaded
+var DefaultDeniedTypes = []string{
+	"application/vnd.microsoft.portable-executable",
+	"application/x-elf",
+	"application/x-mach-binary",
+	"application/x-msi",
+	"text/html",
+	"image/svg+xml",
+}
+
+var (
+	errTypeNotAllowed    = errors.New("file type is not allowed")
+	errExtensionMismatch = errors.New("file extension does not match its content")
+)
+
+// detectFileType sniffs the type of an uploaded file from its content, ignoring the
+// Content-Type sent by the client, and checks it against the allow and deny lists and
+// the extension of its name
+func (h *LearningHandler) detectFileType(file *multipart.FileHeader, fileName string) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return h.detectContentType(src, fileName)
+}
+
+// detectContentType sniffs the type of content read from r and checks it like detectFileType
+func (h *LearningHandler) detectContentType(r io.Reader, fileName string) (string, error) {
+	detected, err := mimetype.DetectReader(r)
+	if err != nil {
+		return "", err
+	}
+	if !typeAllowed(detected, h.AllowedTypes, h.DeniedTypes) {
+		return "", fmt.Errorf("%w: %s", errTypeNotAllowed, detected)
+	}
+	if !extensionMatches(detected, path.Ext(fileName)) {
+		return "", fmt.Errorf("%w: %s is %s", errExtensionMismatch, fileName, detected)
+	}
+	return detected.String(), nil
+}
+
+// typeAllowed reports whether a type is on the allow list, or any type is allowed
+// when the list is empty, and not on the deny list. Entries may be like image/*.
+// A type is denied along with the types it is based on, so denying application/x-elf
+// also denies the shared libraries and executables detected as more specific types.
+func typeAllowed(detected *mimetype.MIME, allowed []string, denied []string) bool {
+	for _, entry := range denied {
+		for m := detected; m != nil; m = m.Parent() {
+			if typeMatches(m, entry) {
+				return false
+			}
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, entry := range allowed {
+		if typeMatches(detected, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeMatches(detected *mimetype.MIME, entry string) bool {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if prefix, ok := strings.CutSuffix(entry, "/*"); ok {
+		return strings.HasPrefix(detected.String(), prefix+"/")
+	}
+	return detected.Is(entry)
+}
+
+// extensionMatches reports whether a file extension fits the detected type. Extensions
+// of the type it is based on fit too, so a .zip may hold a document, and any text
+// extension fits plain text. Unknown extensions cannot be checked and are accepted.
+func extensionMatches(detected *mimetype.MIME, ext string) bool {
+	ext = strings.ToLower(ext)
+	if ext == "" {
+		return true
+	}
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Extension() == ext {
+			return true
+		}
+	}
+	registered, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if err != nil {
+		return true
+	}
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is(registered) {
+			return true
+		}
+	}
+	return detected.Is("text/plain") && strings.HasPrefix(registered, "text/")
+}
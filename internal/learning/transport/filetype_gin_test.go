@@ -0,0 +1,61 @@
+package learningtransport
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Contents of the types the tests upload, detected from their first bytes
+var (
+	pngContent        = "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"
+	pdfContent        = "%PDF-1.4\n%test\n"
+	htmlContent       = "<html><body>hello</body></html>"
+	peContent         = "MZ\x90\x00\x03\x00\x00\x00"
+	sharedLibContent  = elfContent(3)
+	executableContent = elfContent(2)
+)
+
+// elfContent returns the start of a 64-bit ELF file of the given e_type
+func elfContent(elfType byte) string {
+	header := []byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, elfType, 0, 0x3e, 0}
+	return string(append(header, make([]byte, 44)...))
+}
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		denied   []string
+		fileName string
+		content  string
+		want     string
+		err      error
+	}{
+		{"image", nil, DefaultDeniedTypes, "photo.png", pngContent, "image/png", nil},
+		{"plain text with a text extension", nil, DefaultDeniedTypes, "notes.md", "# notes\n", "text/plain; charset=utf-8", nil},
+		{"no extension", nil, DefaultDeniedTypes, "photo", pngContent, "image/png", nil},
+		{"html", nil, DefaultDeniedTypes, "page.html", htmlContent, "", errTypeNotAllowed},
+		{"html sent as text", nil, DefaultDeniedTypes, "page.txt", htmlContent, "", errTypeNotAllowed},
+		{"windows executable", nil, DefaultDeniedTypes, "setup.exe", peContent, "", errTypeNotAllowed},
+		// Detected as types based on application/x-elf, which the deny list names
+		{"shared library", nil, DefaultDeniedTypes, "libtest.so", sharedLibContent, "", errTypeNotAllowed},
+		{"elf executable", nil, DefaultDeniedTypes, "program", executableContent, "", errTypeNotAllowed},
+		{"nothing denied", nil, nil, "page.html", htmlContent, "text/html; charset=utf-8", nil},
+		{"allowed wildcard", []string{"image/*"}, nil, "photo.png", pngContent, "image/png", nil},
+		{"not allowed", []string{"image/*"}, nil, "paper.pdf", pdfContent, "", errTypeNotAllowed},
+		{"allowed exactly", []string{" Application/PDF "}, nil, "paper.pdf", pdfContent, "application/pdf", nil},
+		{"denied even if allowed", []string{"text/*"}, []string{"text/html"}, "page.html", htmlContent, "", errTypeNotAllowed},
+		{"parent denied", nil, []string{"text/plain"}, "page.html", htmlContent, "", errTypeNotAllowed},
+		{"extension of another type", nil, DefaultDeniedTypes, "photo.pdf", pngContent, "", errExtensionMismatch},
+		{"text extension on an image", nil, DefaultDeniedTypes, "photo.txt", pngContent, "", errExtensionMismatch},
+		{"unknown extension", nil, DefaultDeniedTypes, "photo.unknownext", pngContent, "image/png", nil},
+	}
+	for _, tt := range tests {
+		h := &LearningHandler{AllowedTypes: tt.allowed, DeniedTypes: tt.denied}
+		got, err := h.detectContentType(bytes.NewReader([]byte(tt.content)), tt.fileName)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: detectContentType = %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
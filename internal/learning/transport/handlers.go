@@ -1,11 +1,45 @@
 package learningtransport
 
-import learningbusiness "github.com/khoaphungnguyen/learning-tracker/internal/learning/business"
+import (
+	"sync"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningbusiness "github.com/khoaphungnguyen/learning-tracker/internal/learning/business"
+)
 
 type LearningHandler struct {
 	learningHandler *learningbusiness.LearningService
+	blobs           blob.BlobStore
+
+	// AllowedTypes are the attachment types accepted, any type if empty,
+	// and DeniedTypes those rejected even if allowed. Entries may be like image/*.
+	AllowedTypes []string
+	DeniedTypes  []string
+
+	// MaxFileSize is the largest file accepted, in bytes
+	MaxFileSize int64
+
+	// StorageQuota is the total size of files a user may store, in bytes, 0 for unlimited.
+	// RoleStorageQuotas overrides it per role, and a quota set on a user overrides both.
+	StorageQuota      int64
+	RoleStorageQuotas map[string]int64
+
+	// FileVersionsKept is how many versions of each file are kept, the current one included,
+	// unless a different number is set on the user
+	FileVersionsKept int
+
+	// uploadLocks holds a mutex per resumable upload in use, so its chunks are written one at a time
+	uploadLocksMu sync.Mutex
+	uploadLocks   map[string]*uploadLock
 }
 
-func NewLearningHandler(learningHandler *learningbusiness.LearningService) *LearningHandler {
-	return &LearningHandler{learningHandler: learningHandler}
+func NewLearningHandler(learningHandler *learningbusiness.LearningService, blobs blob.BlobStore) *LearningHandler {
+	return &LearningHandler{
+		learningHandler:  learningHandler,
+		blobs:            blobs,
+		DeniedTypes:      DefaultDeniedTypes,
+		MaxFileSize:      25 << 20,
+		StorageQuota:     1 << 30,
+		FileVersionsKept: 10,
+	}
 }
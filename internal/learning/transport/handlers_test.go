@@ -0,0 +1,160 @@
+package learningtransport
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningbusiness "github.com/khoaphungnguyen/learning-tracker/internal/learning/business"
+	learningstorage "github.com/khoaphungnguyen/learning-tracker/internal/learning/storage"
+	userstorage "github.com/khoaphungnguyen/learning-tracker/internal/users/storage"
+)
+
+var (
+	testStore learningstorage.LearningStore
+	testDB    *sql.DB
+	testUsers int
+)
+
+// TestMain runs the tests against a fresh database, which the stores open under the working directory
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dir, err := os.MkdirTemp("", "learningtransport")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "migrations"), 0o755)
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The users store creates every table
+	users, err := userstorage.NewUserStore()
+	if err == nil {
+		err = users.CreateTable()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	users.DB.Close()
+	store, err := learningstorage.NewLearningStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	testStore, testDB = store, store.DB
+	code := m.Run()
+	store.DB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestHandler returns a handler on the test database, with its blobs in a temporary directory
+func newTestHandler(t *testing.T) (*LearningHandler, *learningbusiness.LearningService) {
+	t.Helper()
+	blobs, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := learningbusiness.NewLearningService(testStore, blobs)
+	s.UploadDir = t.TempDir()
+	return NewLearningHandler(s, blobs), s
+}
+
+// newTestRouter serves the learning routes to a logged in user
+func newTestRouter(h *LearningHandler, userID int) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("id", userID)
+		c.Set("role", "user")
+	})
+	r.GET("/goals/:id", h.GetGoalByID)
+	r.DELETE("/goals/:id", h.DeleteGoal)
+	r.GET("/goals/:id/entries", h.GetAllEntriesByGoalID)
+	r.POST("/entries", h.CreateEntry)
+	r.GET("/entries/:id", h.GetEntryByID)
+	r.DELETE("/entries/:id", h.DeleteEntry)
+	r.GET("/entries/:id/files", h.GetAllFilesByEntryID)
+	r.POST("/files", h.CreateFile)
+	r.PUT("/files", h.UpdateFile)
+	r.GET("/files/:id", h.GetFileByID)
+	r.GET("/files/:id/download", h.DownloadFile)
+	r.GET("/links/:id", h.DownloadLink)
+	r.GET("/files/:id/versions/:version/download", h.DownloadFileVersion)
+	r.POST("/files/:id/versions/:version/restore", h.RestoreFileVersion)
+	r.POST("/uploads", h.CreateUpload)
+	r.HEAD("/uploads/:id", h.GetUploadOffset)
+	r.PATCH("/uploads/:id", h.PatchUpload)
+	r.DELETE("/uploads/:id", h.DeleteUpload)
+	return r
+}
+
+// createTestUser creates a user and returns their ID
+func createTestUser(t *testing.T) int {
+	t.Helper()
+	testUsers++
+	result, err := testDB.Exec(`INSERT INTO users (email, name) VALUES (?, 'Test')`, fmt.Sprintf("user%d@example.com", testUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+// createTestEntry creates a goal with an entry for a user, and returns their IDs
+func createTestEntry(t *testing.T, s *learningbusiness.LearningService, userID int) (goalID int, entryID int) {
+	t.Helper()
+	id, err := s.CreateGoal(userID, "Goal", time.Now(), time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goalID = int(id)
+	id, err = s.CreateEntry(goalID, userID, "Entry", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return goalID, int(id)
+}
+
+// uploadRequest returns a multipart request with form fields and a file in field
+func uploadRequest(t *testing.T, method string, target string, fields map[string]string, field string, fileName string, content string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		err := form.WriteField(name, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := form.CreateFormFile(field, fileName)
+	if err == nil {
+		_, err = part.Write([]byte(content))
+	}
+	if err == nil {
+		err = form.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, target, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
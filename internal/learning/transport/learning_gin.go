@@ -1,11 +1,15 @@
 package learningtransport
 
 import (
+	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
-	"os"
+	"path"
 	"strconv"
-	"time"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
@@ -70,29 +74,20 @@ func (h *LearningHandler) UpdateGoal(c *gin.Context) {
 // Handle delete goal from gin
 func (h *LearningHandler) DeleteGoal(c *gin.Context) {
 	userID := c.GetInt("id")
-	goalID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid goal ID",
-		})
+	goal, ok := h.ownGoal(c)
+	if !ok {
 		return
 	}
-	// Check if the goal ID is valid
-	_, err = h.learningHandler.GetGoalByID(userID)
+	// Its entries and their files go with it, and stop counting towards the quota
+	err := h.learningHandler.DeleteGoal(goal.ID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-	err = h.learningHandler.DeleteGoal(goalID, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
-	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("Goal#%d is deleted successfully", goalID),
+		"message": fmt.Sprintf("Goal#%d is deleted successfully", goal.ID),
 	})
 }
 
@@ -110,14 +105,30 @@ func (h *LearningHandler) GetAllGoalsByUserID(c *gin.Context) {
 
 // Handle get goal by ID
 func (h *LearningHandler) GetGoalByID(c *gin.Context) {
-	userID := c.GetInt("id")
-	goal, err := h.learningHandler.GetGoalByID(userID)
+	goal, ok := h.ownGoal(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, goal)
+}
+
+// ownGoal returns the goal in the URL if it belongs to the logged in user
+func (h *LearningHandler) ownGoal(c *gin.Context) (learningmodel.LearningGoals, bool) {
+	goalID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid goal ID",
 		})
+		return learningmodel.LearningGoals{}, false
 	}
-	c.JSON(http.StatusOK, goal)
+	goal, err := h.learningHandler.GetGoalByID(goalID)
+	if err != nil || goal.UserID != c.GetInt("id") {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Goal#%d not found", goalID),
+		})
+		return goal, false
+	}
+	return goal, true
 }
 
 // Handle new entry
@@ -131,11 +142,19 @@ func (h *LearningHandler) CreateEntry(c *gin.Context) {
 		})
 		return
 	}
-	newID, err := h.learningHandler.CreateEntry(newEntry.GoalID, userID, newEntry.Title, newEntry.Description)
+	goal, err := h.learningHandler.GetGoalByID(newEntry.GoalID)
+	if err != nil || goal.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Goal#%d not found", newEntry.GoalID),
+		})
+		return
+	}
+	newID, err := h.learningHandler.CreateEntry(goal.ID, userID, newEntry.Title, newEntry.Description)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
+		return
 	}
 	c.JSON(http.StatusCreated, gin.H{
 		"message": fmt.Sprintf("New entry#%d is created successfully", newID),
@@ -173,70 +192,89 @@ func (h *LearningHandler) UpdateEntry(c *gin.Context) {
 
 func (h *LearningHandler) DeleteEntry(c *gin.Context) {
 	userID := c.GetInt("id")
-	entryID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid entry ID",
-		})
+	entry, ok := h.ownEntry(c)
+	if !ok {
 		return
 	}
-	// Check if the entry ID is valid
-	_, err = h.learningHandler.GetEntryByID(entryID)
+	// Its files go with it, and stop counting towards the quota
+	err := h.learningHandler.DeleteEntry(entry.ID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-
-	err = h.learningHandler.DeleteEntry(entryID, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
-	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("Entry#%d is deleted successfully", entryID),
+		"message": fmt.Sprintf("Entry#%d is deleted successfully", entry.ID),
 	})
 }
 
 func (h *LearningHandler) GetAllEntriesByGoalID(c *gin.Context) {
-	goalID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid goal ID",
-		})
+	goal, ok := h.ownGoal(c)
+	if !ok {
 		return
 	}
-	entries, err := h.learningHandler.GetAllEntriesByGoalID(goalID)
+	entries, err := h.learningHandler.GetAllEntriesByGoalID(goal.ID, goal.UserID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
+		return
 	}
 	c.JSON(http.StatusOK, entries)
 }
 
 func (h *LearningHandler) GetEntryByID(c *gin.Context) {
+	entry, ok := h.ownEntry(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// ownEntry returns the entry in the URL if it belongs to the logged in user
+func (h *LearningHandler) ownEntry(c *gin.Context) (learningmodel.LearningEntry, bool) {
 	entryID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid entry ID",
 		})
-		return
+		return learningmodel.LearningEntry{}, false
 	}
 	entry, err := h.learningHandler.GetEntryByID(entryID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
+	if err != nil || entry.UserID != c.GetInt("id") {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Entry#%d not found", entryID),
 		})
+		return entry, false
 	}
-	c.JSON(http.StatusOK, entry)
+	return entry, true
 }
 
 // Handle new file upload and support multiple files upload
 func (h *LearningHandler) CreateFile(c *gin.Context) {
 	userID := c.GetInt("id")
+	// Reject uploads that cannot fit in the quota, or are larger than the most files
+	// a request may carry, before reading them
+	used, quota, ok := h.quotaUsage(c, userID)
+	if !ok {
+		return
+	}
+	limit := maxFilesPerUpload * h.MaxFileSize
+	message := fmt.Sprintf("At most %d files of %s each can be uploaded at once", maxFilesPerUpload, formatSize(h.MaxFileSize))
+	if quota > 0 && quota-used < limit {
+		limit, message = quota-used, "Storage quota exceeded"
+	}
+	if !limitBody(c, limit+multipartOverhead, message) {
+		return
+	}
+
+	// Support multiple files upload
+	form, err := c.MultipartForm()
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
 	entryID, err := strconv.Atoi(c.PostForm("entryID"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -244,47 +282,69 @@ func (h *LearningHandler) CreateFile(c *gin.Context) {
 		})
 		return
 	}
-	goalID, err := strconv.Atoi(c.PostForm("goalID"))
-	if err != nil {
+	// Files are stored with the goal of their entry, which must belong to the user
+	entry, err := h.learningHandler.GetEntryByID(entryID)
+	if err != nil || entry.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Entry#%d not found", entryID),
+		})
+		return
+	}
+	if goalID := c.PostForm("goalID"); goalID != "" && goalID != strconv.Itoa(entry.GoalID) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid goal ID",
 		})
 		return
 	}
-
-	// Support multiple files upload
-	form, err := c.MultipartForm()
-	if err != nil {
+	files := form.File["files"]
+	if len(files) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
+			"error": "No files uploaded",
 		})
+		return
 	}
-	files := form.File["files"]
-	for _, file := range files {
-		// Create current time to append to the file name
-		fileName := fmt.Sprintf("%d_%s", time.Now().UnixNano(), file.Filename)
-		fileSize := file.Size
-		fileType := file.Header.Get("Content-Type")
-		filePath := fmt.Sprintf("uploads/%d/%d/%d/%s", userID, goalID, entryID, fileName)
-		// Limit file size to 25MB
-		if fileSize > 25<<20 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "File size must be less than 25MB",
-			})
+	if len(files) > maxFilesPerUpload {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("At most %d files can be uploaded at once", maxFilesPerUpload),
+		})
+		return
+	}
+	// Check every file before storing any, so a rejected upload stores nothing
+	var total int64
+	fileTypes := make([]string, len(files))
+	for i, file := range files {
+		if !h.checkFileSize(c, file.Size) {
 			return
 		}
-		_, err = h.learningHandler.CreateFile(entryID, userID, fileName, fileSize, fileType, filePath)
+		total += file.Size
+		fileTypes[i], err = h.detectFileType(file, sanitizeFileName(file.Filename))
+		if err != nil {
+			fileTypeError(c, err)
+			return
+		}
+	}
+	if quota > 0 && used+total > quota {
+		quotaExceeded(c, used, quota)
+		return
+	}
+	for i, file := range files {
+		fileName := sanitizeFileName(file.Filename)
+		fileSize := file.Size
+		fileType := fileTypes[i]
+		// Save the content, identical content is only stored once
+		filePath, digest, err := h.saveUpload(c, userID, file, fileType)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
+			return
 		}
-		// Save the file
-		err = c.SaveUploadedFile(file, filePath)
+		_, err = h.learningHandler.CreateFile(entryID, entry.GoalID, userID, fileName, fileSize, fileType, filePath, digest)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
+			return
 		}
 	}
 	c.JSON(http.StatusCreated, gin.H{
@@ -293,9 +353,18 @@ func (h *LearningHandler) CreateFile(c *gin.Context) {
 
 }
 
-// Handle update file and replace the old file
+// Handle update file, keeping the old content as a previous version
 func (h *LearningHandler) UpdateFile(c *gin.Context) {
 	userID := c.GetInt("id")
+	// The replaced file is only known once the form is read, so limit the body to one file
+	if !limitBody(c, h.MaxFileSize+multipartOverhead, fmt.Sprintf("File size must be less than %s", formatSize(h.MaxFileSize))) {
+		return
+	}
+	_, err := c.MultipartForm()
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
 	fileID, err := strconv.Atoi(c.PostForm("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -304,15 +373,12 @@ func (h *LearningHandler) UpdateFile(c *gin.Context) {
 		return
 	}
 	oldFile, err := h.learningHandler.GetFileByID(fileID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
+	if err != nil || oldFile.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("File#%d not found", fileID),
 		})
+		return
 	}
-	// Extract goalID and entryID from the old file
-	goalID := oldFile.FilePath[10:11]
-	entryID := oldFile.FilePath[12:13]
-
 	file, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -321,38 +387,44 @@ func (h *LearningHandler) UpdateFile(c *gin.Context) {
 		return
 	}
 
-	// Create current time to append to the file name
-	fileName := fmt.Sprintf("%d_%s", time.Now().UnixNano(), file.Filename)
+	fileName := sanitizeFileName(file.Filename)
 	fileSize := file.Size
-	fileType := file.Header.Get("Content-Type")
-	filePath := fmt.Sprintf("uploads/%d/%s/%s/%s", userID, goalID, entryID, fileName)
-	// Limit file size to 25MB
-	if fileSize > 25<<20 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "File size must be less than 25MB",
-		})
+	if !h.checkFileSize(c, fileSize) {
 		return
 	}
-	// Delete the old file
-	err = os.Remove(oldFile.FilePath)
+	// The old content is kept as a previous version, so it still counts
+	used, quota, ok := h.quotaUsage(c, userID)
+	if !ok {
+		return
+	}
+	if quota > 0 && used+fileSize > quota {
+		quotaExceeded(c, used, quota)
+		return
+	}
+	fileType, err := h.detectFileType(file, fileName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		fileTypeError(c, err)
+		return
 	}
-	// Update the file
-	err = h.learningHandler.UpdateFile(fileID, userID, fileName, fileSize, fileType, filePath)
+	// Save the new content, the old content is collected once no file uses it
+	filePath, digest, err := h.saveUpload(c, userID, file, fileType)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
+		return
+	}
+	keep, ok := h.versionsKept(c, userID)
+	if !ok {
+		return
 	}
-	// Save the new file
-	err = c.SaveUploadedFile(file, filePath)
+	// The new content becomes a new version of the file
+	err = h.learningHandler.UpdateFile(fileID, userID, fileName, fileSize, fileType, filePath, digest, keep)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": fmt.Sprintf("File#%d is updated successfully", fileID),
@@ -369,18 +441,7 @@ func (h *LearningHandler) DeleteFile(c *gin.Context) {
 		})
 		return
 	}
-	file, err := h.learningHandler.GetFileByID(fileID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
-	}
-	err = os.Remove(file.FilePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
-	}
+	// The content is collected once no file uses it
 	err = h.learningHandler.DeleteFile(fileID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -394,54 +455,89 @@ func (h *LearningHandler) DeleteFile(c *gin.Context) {
 
 // Handle get all files by entry ID
 func (h *LearningHandler) GetAllFilesByEntryID(c *gin.Context) {
-	entryID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid entry ID",
-		})
+	entry, ok := h.ownEntry(c)
+	if !ok {
 		return
 	}
-	files, err := h.learningHandler.GetAllFilesByEntryID(entryID)
+	files, err := h.learningHandler.GetAllFilesByEntryID(entry.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
+		return
 	}
 	c.JSON(http.StatusOK, files)
 }
 
 // Handle get file by ID
 func (h *LearningHandler) GetFileByID(c *gin.Context) {
-	fileID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid file ID",
-		})
+	file, ok := h.ownFile(c)
+	if !ok {
 		return
 	}
-	file, err := h.learningHandler.GetFileByID(fileID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
-	}
 	c.JSON(http.StatusOK, file)
 }
 
-// Handle download file by ID
+// Handle download file by ID, with its original name and support for ranges and conditional requests
 func (h *LearningHandler) DownloadFile(c *gin.Context) {
-	fileID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid file ID",
-		})
+	file, ok := h.ownFile(c)
+	if !ok || !h.scanAllows(c, file.ID, file.ScanStatus, file.ScanSignature) {
 		return
 	}
-	file, err := h.learningHandler.GetFileByID(fileID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	h.sendContent(c, storedContent{
+		Key:         file.FilePath,
+		ContentType: file.FileType,
+		FileName:    file.FileName,
+		ETag:        file.SHA256,
+		ModTime:     file.UpdatedAt,
+	}, fmt.Sprintf("File#%d content not found", file.ID))
+}
+
+// maxFileNameLength is the longest display name kept for an uploaded file, in bytes
+const maxFileNameLength = 255
+
+// sanitizeFileName returns the display name of an uploaded file: the last element of the
+// name the client sent, without control characters and cut to maxFileNameLength.
+// The name is only displayed, files are stored under keys generated by the server.
+func sanitizeFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// fileTypeError writes the response for an upload whose type was rejected
+func fileTypeError(c *gin.Context, err error) {
+	if errors.Is(err, errTypeNotAllowed) || errors.Is(err, errExtensionMismatch) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
 			"error": err.Error(),
 		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// saveUpload stores an uploaded file in the user's content-addressed blobs and returns its key and digest
+func (h *LearningHandler) saveUpload(c *gin.Context, userID int, file *multipart.FileHeader, fileType string) (string, string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", "", err
 	}
-	c.File(file.FilePath)
+	defer src.Close()
+	key, digest, _, err := h.learningHandler.StoreBlob(c, userID, src, fileType)
+	return key, digest, err
 }
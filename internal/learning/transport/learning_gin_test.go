@@ -0,0 +1,245 @@
+package learningtransport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	learningbusiness "github.com/khoaphungnguyen/learning-tracker/internal/learning/business"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"notes.txt", "notes.txt"},
+		{"../../etc/passwd", "passwd"},
+		{"../", "file"},
+		{"..", "file"},
+		{".", "file"},
+		{`..\..\windows\win.ini`, "win.ini"},
+		{`C:\Users\me\notes.txt`, "notes.txt"},
+		{"/etc/passwd", "passwd"},
+		{"/", "file"},
+		{"photos/", "photos"},
+		{"", "file"},
+		{"   ", "file"},
+		{"  notes.txt  ", "notes.txt"},
+		{"no\x00tes\r\n.txt", "notes.txt"},
+		{"bad\xffname.txt", "badname.txt"},
+		{strings.Repeat("a", 300), strings.Repeat("a", maxFileNameLength)},
+		// Names are cut between characters, not inside one
+		{strings.Repeat("é", 200), strings.Repeat("é", 127)},
+	}
+	for _, test := range tests {
+		if got := sanitizeFileName(test.name); got != test.want {
+			t.Errorf("sanitizeFileName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// createTestEntries creates entries until the next ID has two digits, so IDs are not
+// confused with their first digit, and returns the last one
+func createTestEntries(t *testing.T, s *learningbusiness.LearningService, userID int) (goalID int, entryID int) {
+	t.Helper()
+	for entryID < 10 {
+		goalID, entryID = createTestEntry(t, s, userID)
+	}
+	return goalID, entryID
+}
+
+func TestCreateFile(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	goalID, entryID := createTestEntries(t, s, userID)
+	r := newTestRouter(h, userID)
+	w := serve(r, uploadRequest(t, "POST", "/files", map[string]string{
+		"entryID": strconv.Itoa(entryID),
+		"goalID":  strconv.Itoa(goalID),
+	}, "files", "../../notes.txt", "some notes"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d: %s", w.Code, w.Body)
+	}
+	files, err := s.GetAllFilesByEntryID(entryID)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %+v, %v", files, err)
+	}
+	file := files[0]
+	if file.FileName != "notes.txt" || file.UserID != userID || file.GoalID != goalID {
+		t.Errorf("file = %+v", file)
+	}
+	if file.FilePath != learningbusiness.BlobKey(userID, file.SHA256) {
+		t.Errorf("file stored at %q", file.FilePath)
+	}
+
+	// The goal must be the entry's
+	otherGoal, _ := createTestEntry(t, s, userID)
+	w = serve(r, uploadRequest(t, "POST", "/files", map[string]string{
+		"entryID": strconv.Itoa(entryID),
+		"goalID":  strconv.Itoa(otherGoal),
+	}, "files", "notes.txt", "some notes"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("upload to another goal status = %d, want 400: %s", w.Code, w.Body)
+	}
+}
+
+func TestCreateFileOtherUsersEntry(t *testing.T) {
+	h, s := newTestHandler(t)
+	owner := createTestUser(t)
+	_, entryID := createTestEntries(t, s, owner)
+	other := createTestUser(t)
+	w := serve(newTestRouter(h, other), uploadRequest(t, "POST", "/files", map[string]string{
+		"entryID": strconv.Itoa(entryID),
+	}, "files", "notes.txt", "some notes"))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("upload status = %d, want 404: %s", w.Code, w.Body)
+	}
+	files, err := s.GetAllFilesByEntryID(entryID)
+	if err != nil || len(files) != 0 {
+		t.Fatalf("file added to another user's entry: %+v, %v", files, err)
+	}
+}
+
+// createTestFile uploads a file to an entry of the user and returns its ID
+func createTestFile(t *testing.T, h *LearningHandler, s *learningbusiness.LearningService, userID int, entryID int, content string) int {
+	t.Helper()
+	w := serve(newTestRouter(h, userID), uploadRequest(t, "POST", "/files", map[string]string{
+		"entryID": strconv.Itoa(entryID),
+	}, "files", "notes.txt", content))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d: %s", w.Code, w.Body)
+	}
+	files, err := s.GetAllFilesByEntryID(entryID)
+	if err != nil || len(files) == 0 {
+		t.Fatalf("files = %+v, %v", files, err)
+	}
+	return files[len(files)-1].ID
+}
+
+func TestUpdateFile(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntries(t, s, userID)
+	fileID := 0
+	for i := 0; fileID < 10; i++ {
+		fileID = createTestFile(t, h, s, userID, entryID, "version "+strconv.Itoa(i))
+	}
+	w := serve(newTestRouter(h, userID), uploadRequest(t, "PUT", "/files", map[string]string{
+		"id": strconv.Itoa(fileID),
+	}, "file", `..\new notes.txt`, "new content"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body)
+	}
+	file, err := s.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.FileName != "new notes.txt" || file.Version != 2 || file.FileSize != int64(len("new content")) {
+		t.Errorf("file = %+v", file)
+	}
+}
+
+func TestUpdateFileOtherUsersFile(t *testing.T) {
+	h, s := newTestHandler(t)
+	owner := createTestUser(t)
+	_, entryID := createTestEntries(t, s, owner)
+	fileID := createTestFile(t, h, s, owner, entryID, "owner's notes")
+	before, err := s.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := createTestUser(t)
+	w := serve(newTestRouter(h, other), uploadRequest(t, "PUT", "/files", map[string]string{
+		"id": strconv.Itoa(fileID),
+	}, "file", "notes.txt", "overwritten"))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("update status = %d, want 404: %s", w.Code, w.Body)
+	}
+	after, err := s.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.FilePath != before.FilePath || after.Version != before.Version {
+		t.Errorf("another user's file changed from %+v to %+v", before, after)
+	}
+}
+
+func TestReadsAreOwnerOnly(t *testing.T) {
+	h, s := newTestHandler(t)
+	owner := createTestUser(t)
+	goalID, entryID := createTestEntries(t, s, owner)
+	fileID := createTestFile(t, h, s, owner, entryID, "private notes")
+	other := createTestUser(t)
+	for _, target := range []string{
+		"/goals/" + strconv.Itoa(goalID),
+		"/goals/" + strconv.Itoa(goalID) + "/entries",
+		"/entries/" + strconv.Itoa(entryID),
+		"/entries/" + strconv.Itoa(entryID) + "/files",
+		"/files/" + strconv.Itoa(fileID),
+	} {
+		w := serve(newTestRouter(h, owner), httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("owner GET %s status = %d: %s", target, w.Code, w.Body)
+		}
+		w = serve(newTestRouter(h, other), httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("other user GET %s status = %d, want 404: %s", target, w.Code, w.Body)
+		}
+		if strings.Contains(w.Body.String(), "private notes") || strings.Contains(w.Body.String(), "notes.txt") {
+			t.Errorf("other user GET %s sees the owner's data: %s", target, w.Body)
+		}
+	}
+}
+
+func TestEntriesStayInOwnGoals(t *testing.T) {
+	h, s := newTestHandler(t)
+	owner := createTestUser(t)
+	other := createTestUser(t)
+	goalID, _ := createTestEntry(t, s, owner)
+
+	// Entries cannot be added to another user's goal
+	body := `{"goalId": ` + strconv.Itoa(goalID) + `, "title": "Intruder"}`
+	req := httptest.NewRequest("POST", "/entries", strings.NewReader(body))
+	if w := serve(newTestRouter(h, other), req); w.Code != http.StatusNotFound {
+		t.Fatalf("create in another user's goal status = %d, want 404: %s", w.Code, w.Body)
+	}
+	req = httptest.NewRequest("POST", "/entries", strings.NewReader(body))
+	if w := serve(newTestRouter(h, owner), req); w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", w.Code, w.Body)
+	}
+
+	// One added before that was checked is kept out of the goal, and the goal out of it
+	id, err := s.CreateEntry(goalID, other, "Intruder", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	intruder := int(id)
+	createTestFile(t, h, s, other, intruder, "intruder notes")
+	w := serve(newTestRouter(h, owner), httptest.NewRequest("GET", "/goals/"+strconv.Itoa(goalID)+"/entries", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"id":`+strconv.Itoa(intruder)+",") {
+		t.Errorf("entries status = %d: %s", w.Code, w.Body)
+	}
+	goal, err := s.GetGoalByID(goalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := s.GoalArchiveContents(goal)
+	if err != nil || len(contents.Entries) != 2 {
+		t.Errorf("goal archive has %d entries, %v, want the owner's 2", len(contents.Entries), err)
+	}
+	entry, err := s.GetEntryByID(intruder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err = s.EntryArchiveContents(entry)
+	if err != nil || contents.Title != "" || contents.UserID != 0 {
+		t.Errorf("entry archive goal = %+v, %v, want an untitled one", contents, err)
+	}
+	storage, err := s.GetStorageByGoal(other)
+	if err != nil || len(storage) != 1 || storage[0].Title != "" {
+		t.Errorf("storage by goal = %+v, %v, want no title", storage, err)
+	}
+}
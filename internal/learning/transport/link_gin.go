@@ -0,0 +1,182 @@
+package learningtransport
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	learningbusiness "github.com/khoaphungnguyen/learning-tracker/internal/learning/business"
+)
+
+// linkSessionCookie holds the proof that a browser opened a shared link, scoped to the link's path
+const linkSessionCookie = "link_session"
+
+// CreateLinkPayload asks for a shared link to a file, which lasts seven days unless
+// ExpiresInHours is set
+type CreateLinkPayload struct {
+	ExpiresInHours int  `json:"expiresInHours"`
+	SingleUse      bool `json:"singleUse"`
+}
+
+// Handle creation of a signed link anyone can download a file with, without logging in
+func (h *LearningHandler) CreateFileLink(c *gin.Context) {
+	userID := c.GetInt("id")
+	file, ok := h.ownFile(c)
+	if !ok {
+		return
+	}
+	var payload CreateLinkPayload
+	// An empty body asks for the defaults
+	if c.Request.ContentLength != 0 {
+		err := c.BindJSON(&payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	ttl := learningbusiness.DefaultLinkTTL
+	if payload.ExpiresInHours != 0 {
+		ttl = time.Duration(payload.ExpiresInHours) * time.Hour
+	}
+	if ttl <= 0 || ttl > learningbusiness.MaxLinkTTL {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("expiresInHours must be between 1 and %d", int(learningbusiness.MaxLinkTTL.Hours())),
+		})
+		return
+	}
+	link, err := h.learningHandler.CreateFileLink(file.ID, userID, ttl, payload.SingleUse)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, link)
+}
+
+// Handle the shared links of a file with their download counts, newest first
+func (h *LearningHandler) GetFileLinks(c *gin.Context) {
+	file, ok := h.ownFile(c)
+	if !ok {
+		return
+	}
+	links, err := h.learningHandler.GetFileLinks(file.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+// Handle revocation of a shared link, which stops working at once
+func (h *LearningHandler) DeleteFileLink(c *gin.Context) {
+	file, ok := h.ownFile(c)
+	if !ok {
+		return
+	}
+	linkID, err := strconv.Atoi(c.Param("link"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid link ID",
+		})
+		return
+	}
+	err = h.learningHandler.DeleteFileLink(linkID, file.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Link#%d not found", linkID),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Link#%d is revoked", linkID),
+	})
+}
+
+// Handle download of a file through a shared link, which needs no login but a valid signature
+func (h *LearningHandler) DownloadLink(c *gin.Context) {
+	linkID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": learningbusiness.ErrLinkInvalid.Error(),
+		})
+		return
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": learningbusiness.ErrLinkInvalid.Error(),
+		})
+		return
+	}
+	// Only the first request of a client opening the link counts as a download
+	session, _ := c.Cookie(linkSessionCookie)
+	file, opened, err := h.learningHandler.OpenFileLink(linkID, expires, c.Query("signature"), session)
+	switch {
+	case errors.Is(err, learningbusiness.ErrLinkInvalid):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, learningbusiness.ErrScanBlocked):
+		h.scanAllows(c, file.ID, file.ScanStatus, file.ScanSignature)
+		return
+	case errors.Is(err, learningbusiness.ErrLinkExpired), errors.Is(err, learningbusiness.ErrLinkUsed):
+		c.JSON(http.StatusGone, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	// The download only counts once the content can be sent
+	info, content, ok := h.openContent(c, file.FilePath, "File content not found")
+	if !ok {
+		return
+	}
+	defer content.Close()
+	if !opened {
+		err = h.learningHandler.UseFileLink(linkID)
+		if errors.Is(err, learningbusiness.ErrLinkUsed) {
+			c.JSON(http.StatusGone, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		maxAge := int(time.Until(time.Unix(expires, 0)).Seconds()) + 1
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(linkSessionCookie, h.learningHandler.LinkSession(linkID, expires), maxAge, c.Request.URL.Path, "", c.Request.TLS != nil, true)
+	}
+	// Pages opened from the file must not learn the signed URL
+	c.Header("Referrer-Policy", "no-referrer")
+	serveContent(c, storedContent{
+		Key:         file.FilePath,
+		ContentType: file.FileType,
+		FileName:    file.FileName,
+		ETag:        file.SHA256,
+		ModTime:     file.UpdatedAt,
+	}, info, content)
+}
@@ -0,0 +1,135 @@
+package learningtransport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadSingleUseLink(t *testing.T) {
+	h, s := newTestHandler(t)
+	s.LinkKey = []byte("secret")
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, "shared notes")
+	file, err := s.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := s.CreateFileLink(fileID, userID, time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Anyone with the link downloads it, logged in or not
+	r := newTestRouter(h, 0)
+
+	// A download that fails does not use up the link
+	err = h.blobs.Delete(context.Background(), file.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(r, httptest.NewRequest("GET", link.URL, nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("download of missing content status = %d, want 404: %s", w.Code, w.Body)
+	}
+	err = h.blobs.Put(context.Background(), file.FilePath, strings.NewReader("shared notes"), 12, file.FileType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = serve(r, httptest.NewRequest("GET", link.URL, nil))
+	if w.Code != http.StatusOK || w.Body.String() != "shared notes" {
+		t.Fatalf("download status = %d: %s", w.Code, w.Body)
+	}
+	w = serve(r, httptest.NewRequest("GET", link.URL, nil))
+	if w.Code != http.StatusGone {
+		t.Fatalf("second download status = %d, want 410: %s", w.Code, w.Body)
+	}
+	links, err := s.GetFileLinks(fileID)
+	if err != nil || len(links) != 1 || links[0].Downloads != 1 {
+		t.Fatalf("links = %+v, %v, want one download", links, err)
+	}
+}
+
+func TestDownloadLinkSignature(t *testing.T) {
+	h, s := newTestHandler(t)
+	s.LinkKey = []byte("secret")
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, "shared notes")
+	link, err := s.CreateFileLink(fileID, userID, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := strings.Replace(link.URL, "signature=", "signature=x", 1)
+	w := serve(newTestRouter(h, 0), httptest.NewRequest("GET", forged, nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("forged link status = %d, want 404: %s", w.Code, w.Body)
+	}
+}
+
+func TestLinkOpenedOnce(t *testing.T) {
+	h, s := newTestHandler(t)
+	s.LinkKey = []byte("secret")
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, "0123456789")
+	file, err := s.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(h, 0)
+	for _, singleUse := range []bool{true, false} {
+		link, err := s.CreateFileLink(fileID, userID, time.Hour, singleUse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		get := func(cookies []*http.Cookie, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", link.URL, nil)
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+			for i := 0; i < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			return serve(r, req)
+		}
+
+		// A viewer opens the link with a range request, then asks for more of the file
+		w := get(nil, "Range", "bytes=0-3")
+		if w.Code != http.StatusPartialContent || w.Body.String() != "0123" {
+			t.Fatalf("single use %v: first range status = %d: %s", singleUse, w.Code, w.Body)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != linkSessionCookie || !cookies[0].HttpOnly {
+			t.Fatalf("single use %v: cookies = %+v", singleUse, cookies)
+		}
+		if w := get(cookies, "Range", "bytes=4-"); w.Code != http.StatusPartialContent || w.Body.String() != "456789" {
+			t.Errorf("single use %v: second range status = %d: %s", singleUse, w.Code, w.Body)
+		}
+		if w := get(cookies, "If-None-Match", `"`+file.SHA256+`"`); w.Code != http.StatusNotModified {
+			t.Errorf("single use %v: revalidation status = %d, want 304", singleUse, w.Code)
+		}
+		links, err := s.GetFileLinks(fileID)
+		if err != nil || links[len(links)-1].Downloads != 1 {
+			t.Errorf("single use %v: links = %+v, %v, want one download", singleUse, links, err)
+		}
+
+		// Another client opening the link counts again, unless it was single use
+		want := http.StatusOK
+		if singleUse {
+			want = http.StatusGone
+		}
+		if w := get(nil); w.Code != want {
+			t.Errorf("single use %v: another client status = %d, want %d", singleUse, w.Code, want)
+		}
+		// A session of another link is no proof of opening this one
+		forged := []*http.Cookie{{Name: linkSessionCookie, Value: s.LinkSession(link.ID+1, link.ExpiresAt.Unix())}}
+		if w := get(forged); w.Code != want {
+			t.Errorf("single use %v: forged session status = %d, want %d", singleUse, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package learningtransport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// multipartOverhead is allowed on top of the file sizes for the form fields
+// and part headers of an upload request
+const multipartOverhead = 1 << 20
+
+// maxFilesPerUpload is how many files one upload request may carry
+const maxFilesPerUpload = 20
+
+// Handle storage usage of the logged in user, broken down by goal
+func (h *LearningHandler) GetStorage(c *gin.Context) {
+	userID := c.GetInt("id")
+	used, quota, ok := h.storageUsage(c, userID)
+	if !ok {
+		return
+	}
+	goals, err := h.learningHandler.GetStorageByGoal(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	usage := learningmodel.StorageUsage{
+		UsedBytes:   used,
+		QuotaBytes:  quota,
+		MaxFileSize: h.MaxFileSize,
+		Goals:       goals,
+	}
+	if quota > 0 {
+		usage.RemainingBytes = max(quota-used, 0)
+	}
+	for _, goal := range goals {
+		usage.Files += goal.Files
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// storageUsage returns the bytes used by a user's files and their kept versions, and their quota, 0 if unlimited.
+// The quota set on the user wins over the one of their role, then the default.
+func (h *LearningHandler) storageUsage(c *gin.Context, userID int) (used int64, quota int64, ok bool) {
+	used, override, err := h.learningHandler.GetStorageUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return 0, 0, false
+	}
+	if override != nil {
+		return used, *override, true
+	}
+	if quota, ok := h.RoleStorageQuotas[c.GetString("role")]; ok {
+		return used, quota, true
+	}
+	return used, h.StorageQuota, true
+}
+
+// quotaUsage returns the bytes used like storageUsage does, with the length of the user's
+// unfinished resumable uploads counted as used too, and their quota. Quota checks use it,
+// so uploads in progress cannot together take more space than the quota leaves.
+func (h *LearningHandler) quotaUsage(c *gin.Context, userID int) (used int64, quota int64, ok bool) {
+	used, quota, ok = h.storageUsage(c, userID)
+	if !ok {
+		return used, quota, false
+	}
+	pending, err := h.learningHandler.GetPendingUploadSize(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return 0, 0, false
+	}
+	return used + pending, quota, true
+}
+
+// limitBody rejects a request whose declared length is over limit before reading the body,
+// and stops reading a body that turns out to be longer
+func limitBody(c *gin.Context, limit int64, message string) bool {
+	if c.Request.ContentLength > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": message,
+		})
+		return false
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	return true
+}
+
+// uploadError writes the response for an upload form that could not be read
+func uploadError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": "Request body too large",
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// checkFileSize rejects a file over the maximum file size
+func (h *LearningHandler) checkFileSize(c *gin.Context, size int64) bool {
+	if size > h.MaxFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("File size must be less than %s", formatSize(h.MaxFileSize)),
+		})
+		return false
+	}
+	return true
+}
+
+// quotaExceeded writes the response for an upload that does not fit in the quota
+func quotaExceeded(c *gin.Context, used int64, quota int64) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":      fmt.Sprintf("Storage quota exceeded, %s of %s used", formatSize(used), formatSize(quota)),
+		"usedBytes":  used,
+		"quotaBytes": quota,
+	})
+}
+
+// formatSize formats a number of bytes in the largest unit it reaches, like 25MB or 1.5GB
+func formatSize(bytes int64) string {
+	for _, unit := range []struct {
+		size int64
+		name string
+	}{{1 << 30, "GB"}, {1 << 20, "MB"}, {1 << 10, "KB"}} {
+		if bytes < unit.size {
+			continue
+		}
+		if bytes%unit.size == 0 {
+			return fmt.Sprintf("%d%s", bytes/unit.size, unit.name)
+		}
+		return fmt.Sprintf("%.1f%s", float64(bytes)/float64(unit.size), unit.name)
+	}
+	return fmt.Sprintf("%dB", bytes)
+}
@@ -0,0 +1,23 @@
+package learningtransport
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handle the text extracted from a file, with its extraction status
+func (h *LearningHandler) GetFileText(c *gin.Context) {
+	file, ok := h.ownFile(c)
+	if !ok || !h.scanAllows(c, file.ID, file.ScanStatus, file.ScanSignature) {
+		return
+	}
+	text, err := h.learningHandler.GetFileText(file.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, text)
+}
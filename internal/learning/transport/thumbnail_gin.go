@@ -0,0 +1,73 @@
+package learningtransport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+	"github.com/khoaphungnguyen/learning-tracker/internal/thumbnail"
+)
+
+// defaultThumbnailSize is the thumbnail size returned when none is asked for, in pixels
+const defaultThumbnailSize = 256
+
+// Handle the thumbnail of a file, the smallest one at least as large as the size query parameter.
+// 202 is returned while the thumbnail is being made.
+func (h *LearningHandler) GetFileThumbnail(c *gin.Context) {
+	file, ok := h.ownFile(c)
+	if !ok || !h.scanAllows(c, file.ID, file.ScanStatus, file.ScanSignature) {
+		return
+	}
+	size := defaultThumbnailSize
+	if query := c.Query("size"); query != "" {
+		var err error
+		size, err = strconv.Atoi(query)
+		if err != nil || size < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid size",
+			})
+			return
+		}
+	}
+	switch file.ThumbnailStatus {
+	case learningmodel.ThumbnailPending:
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": fmt.Sprintf("Thumbnail of File#%d is being made", file.ID),
+		})
+		return
+	case learningmodel.ThumbnailReady:
+	default:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("File#%d has no thumbnail", file.ID),
+		})
+		return
+	}
+	thumb, err := h.learningHandler.GetThumbnail(file, size)
+	if errors.Is(err, blob.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("File#%d has no thumbnail", file.ID),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	content := storedContent{
+		Key:         thumb.Key,
+		ContentType: thumbnail.ContentType,
+		ModTime:     file.UpdatedAt,
+	}
+	// Thumbnails are made once per content and size
+	if file.SHA256 != "" {
+		content.ETag = fmt.Sprintf("%s-%d", file.SHA256, thumb.Size)
+	}
+	h.sendContent(c, content, fmt.Sprintf("File#%d thumbnail content not found", file.ID))
+}
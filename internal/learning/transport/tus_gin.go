@@ -0,0 +1,340 @@
+package learningtransport
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// tusVersion is the version of the tus resumable upload protocol served
+const tusVersion = "1.0.0"
+
+// Handle tus discovery of the protocol version, extensions and maximum size
+func (h *LearningHandler) UploadOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,termination,expiration")
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.MaxFileSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Handle creation of a resumable upload, the file name and entry ID are given in Upload-Metadata
+func (h *LearningHandler) CreateUpload(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	userID := c.GetInt("id")
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Upload-Length",
+		})
+		return
+	}
+	if !h.checkFileSize(c, length) {
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Upload-Metadata",
+		})
+		return
+	}
+	entryID, err := strconv.Atoi(metadata["entryID"])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid entry ID",
+		})
+		return
+	}
+	entry, err := h.learningHandler.GetEntryByID(entryID)
+	if err != nil || entry.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Entry#%d not found", entryID),
+		})
+		return
+	}
+	fileName := metadata["filename"]
+	if fileName == "" {
+		fileName = metadata["name"]
+	}
+	used, quota, ok := h.quotaUsage(c, userID)
+	if !ok {
+		return
+	}
+	if quota > 0 && used+length > quota {
+		quotaExceeded(c, used, quota)
+		return
+	}
+	upload, err := h.learningHandler.CreateUpload(userID, entryID, entry.GoalID, sanitizeFileName(fileName), length)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	// An empty file is complete as soon as it is created
+	if length == 0 {
+		h.finishUpload(c, upload, http.StatusCreated)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+// Handle the offset of a resumable upload, from which the client resumes
+func (h *LearningHandler) GetUploadOffset(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	upload, ok := h.ownUpload(c)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+// Handle a chunk of a resumable upload, which must start at its current offset.
+// The upload becomes a file of its entry once the last chunk is received, and the
+// ID of the file is returned in File-Id.
+func (h *LearningHandler) PatchUpload(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "Content-Type must be application/offset+octet-stream",
+		})
+		return
+	}
+	// Looked up before locking, so only uploads that exist get a lock
+	if _, ok := h.ownUpload(c); !ok {
+		return
+	}
+	unlock := h.lockUpload(c.Param("id"))
+	defer unlock()
+	// Looked up again, as another request may have written or finished it in the meantime
+	upload, ok := h.ownUpload(c)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Upload-Offset",
+		})
+		return
+	}
+	if offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Upload offset is %d", upload.Offset),
+		})
+		return
+	}
+	if c.Request.ContentLength > upload.Length-upload.Offset {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": "Chunk is past the end of the upload",
+		})
+		return
+	}
+	err = h.learningHandler.WriteUpload(&upload, c.Request.Body)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if err != nil {
+		// The client resumes from the offset recorded before the connection broke
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if upload.Offset == upload.Length {
+		h.finishUpload(c, upload, http.StatusNoContent)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Handle termination of a resumable upload, discarding what was received
+func (h *LearningHandler) DeleteUpload(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	// Looked up before locking, so only uploads that exist get a lock
+	if _, ok := h.ownUpload(c); !ok {
+		return
+	}
+	unlock := h.lockUpload(c.Param("id"))
+	defer unlock()
+	// Looked up again, as another request may have written or finished it in the meantime
+	upload, ok := h.ownUpload(c)
+	if !ok {
+		return
+	}
+	err := h.learningHandler.DeleteUpload(upload.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// finishUpload checks the content of a complete upload like CreateFile does, stores it as a
+// file of its entry and forgets the upload. An upload rejected for its type or the quota is
+// discarded, as sending it again would not help.
+func (h *LearningHandler) finishUpload(c *gin.Context, upload learningmodel.Upload, status int) {
+	content, err := h.learningHandler.OpenUpload(upload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer content.Close()
+	fileType, err := h.detectContentType(content, upload.FileName)
+	if errors.Is(err, errTypeNotAllowed) || errors.Is(err, errExtensionMismatch) {
+		h.discardUpload(upload.ID)
+	}
+	if err != nil {
+		fileTypeError(c, err)
+		return
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	// The quota may have been lowered since this upload was created, and the
+	// space it reserved is already counted as used
+	used, quota, ok := h.quotaUsage(c, upload.UserID)
+	if !ok {
+		return
+	}
+	if quota > 0 && used > quota {
+		h.discardUpload(upload.ID)
+		quotaExceeded(c, used-upload.Length, quota)
+		return
+	}
+	filePath, digest, size, err := h.learningHandler.StoreBlob(c, upload.UserID, content, fileType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	fileID, err := h.learningHandler.CreateFile(upload.EntryID, upload.GoalID, upload.UserID, upload.FileName, size, fileType, filePath, digest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	h.discardUpload(upload.ID)
+	c.Header("File-Id", strconv.FormatInt(fileID, 10))
+	c.Status(status)
+}
+
+// discardUpload deletes an upload that is finished with, logging a failure for expiry to retry
+func (h *LearningHandler) discardUpload(id string) {
+	err := h.learningHandler.DeleteUpload(id)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// ownUpload returns the upload in the URL if it belongs to the logged in user and has not expired
+func (h *LearningHandler) ownUpload(c *gin.Context) (learningmodel.Upload, bool) {
+	upload, err := h.learningHandler.GetUpload(c.Param("id"))
+	if err != nil || upload.UserID != c.GetInt("id") || upload.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Upload not found",
+		})
+		return upload, false
+	}
+	return upload, true
+}
+
+// uploadLock is the mutex of a resumable upload
+type uploadLock struct {
+	sync.Mutex
+	users int // Requests holding or waiting for the lock
+}
+
+// lockUpload locks the mutex of an upload and returns the function unlocking it.
+// The mutex is forgotten once no request holds or waits for it.
+func (h *LearningHandler) lockUpload(id string) func() {
+	h.uploadLocksMu.Lock()
+	if h.uploadLocks == nil {
+		h.uploadLocks = map[string]*uploadLock{}
+	}
+	lock, ok := h.uploadLocks[id]
+	if !ok {
+		lock = &uploadLock{}
+		h.uploadLocks[id] = lock
+	}
+	lock.users++
+	h.uploadLocksMu.Unlock()
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		h.uploadLocksMu.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(h.uploadLocks, id)
+		}
+		h.uploadLocksMu.Unlock()
+	}
+}
+
+// tusResumable checks a request is made with the tus version served, and marks the response with it
+func tusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error": fmt.Sprintf("Tus-Resumable must be %s", tusVersion),
+		})
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header, comma separated pairs of a key
+// and a base64 encoded value, which may be left out
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return metadata, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,226 @@
+package learningtransport
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tusRequest returns a tus request with the protocol version header set
+func tusRequest(method string, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	return req
+}
+
+// createTestUpload starts a resumable upload into an entry and returns the response
+func createTestUpload(r *gin.Engine, entryID int, fileName string, length int) *httptest.ResponseRecorder {
+	req := tusRequest("POST", "/uploads", nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	req.Header.Set("Upload-Metadata", "entryID "+base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(entryID)))+
+		",filename "+base64.StdEncoding.EncodeToString([]byte(fileName)))
+	return serve(r, req)
+}
+
+// patchTestUpload sends a chunk of an upload at offset and returns the response
+func patchTestUpload(r *gin.Engine, location string, offset int, chunk string) *httptest.ResponseRecorder {
+	req := tusRequest("PATCH", location, strings.NewReader(chunk))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	return serve(r, req)
+}
+
+// uploadOffset returns the status and offset of an upload
+func uploadOffset(r *gin.Engine, location string) (int, string) {
+	w := serve(r, tusRequest("HEAD", location, nil))
+	return w.Code, w.Header().Get("Upload-Offset")
+}
+
+func TestUploadResume(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	r := newTestRouter(h, userID)
+	content := "first half, second half"
+
+	w := createTestUpload(r, entryID, "notes.txt", len(content))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/uploads/") {
+		t.Fatalf("Location = %q", location)
+	}
+	if code, offset := uploadOffset(r, location); code != http.StatusOK || offset != "0" {
+		t.Fatalf("offset of a new upload = %d %s", code, offset)
+	}
+	w = patchTestUpload(r, location, 0, content[:11])
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("first chunk = %d %s: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body)
+	}
+
+	// A chunk that does not start at the offset is refused with the offset to resume from
+	w = patchTestUpload(r, location, 5, content[5:])
+	if w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("chunk at the wrong offset = %d %s, want 409 11", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	// Another user cannot see or write the upload
+	other := newTestRouter(h, createTestUser(t))
+	if code, _ := uploadOffset(other, location); code != http.StatusNotFound {
+		t.Errorf("offset for another user = %d, want 404", code)
+	}
+	if w := patchTestUpload(other, location, 11, content[11:]); w.Code != http.StatusNotFound {
+		t.Errorf("chunk from another user = %d, want 404", w.Code)
+	}
+
+	// The client resumes from the offset it asks for
+	code, offset := uploadOffset(r, location)
+	if code != http.StatusOK || offset != "11" {
+		t.Fatalf("offset after the first chunk = %d %s", code, offset)
+	}
+	w = patchTestUpload(r, location, 11, content[11:])
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("last chunk = %d: %s", w.Code, w.Body)
+	}
+	fileID, err := strconv.Atoi(w.Header().Get("File-Id"))
+	if err != nil {
+		t.Fatalf("File-Id = %q", w.Header().Get("File-Id"))
+	}
+	file, err := s.GetFileByID(fileID)
+	if err != nil || file.FileName != "notes.txt" || file.FileSize != int64(len(content)) {
+		t.Fatalf("file = %+v, %v", file, err)
+	}
+	stored, err := h.blobs.Get(context.Background(), file.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(stored)
+	stored.Close()
+	if err != nil || string(got) != content {
+		t.Errorf("stored content = %q, %v", got, err)
+	}
+	// The finished upload is gone, and so is its lock
+	if code, _ := uploadOffset(r, location); code != http.StatusNotFound {
+		t.Errorf("offset of a finished upload = %d, want 404", code)
+	}
+	if len(h.uploadLocks) != 0 {
+		t.Errorf("%d upload locks kept", len(h.uploadLocks))
+	}
+}
+
+func TestUploadRequiresTusVersion(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	req := httptest.NewRequest("POST", "/uploads", nil)
+	req.Header.Set("Upload-Length", "10")
+	req.Header.Set("Upload-Metadata", "entryID "+base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(entryID))))
+	w := serve(newTestRouter(h, userID), req)
+	if w.Code != http.StatusPreconditionFailed || w.Header().Get("Tus-Version") != tusVersion {
+		t.Errorf("create without Tus-Resumable = %d, Tus-Version %q", w.Code, w.Header().Get("Tus-Version"))
+	}
+}
+
+func TestUploadTermination(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	r := newTestRouter(h, userID)
+	location := createTestUpload(r, entryID, "notes.txt", 10).Header().Get("Location")
+	if w := patchTestUpload(r, location, 0, "12345"); w.Code != http.StatusNoContent {
+		t.Fatalf("chunk status = %d: %s", w.Code, w.Body)
+	}
+	// Another user cannot terminate it
+	if w := serve(newTestRouter(h, createTestUser(t)), tusRequest("DELETE", location, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("termination by another user = %d, want 404", w.Code)
+	}
+	if w := serve(r, tusRequest("DELETE", location, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("termination status = %d: %s", w.Code, w.Body)
+	}
+	if code, _ := uploadOffset(r, location); code != http.StatusNotFound {
+		t.Errorf("offset of a terminated upload = %d, want 404", code)
+	}
+	entries, err := os.ReadDir(s.UploadDir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("content of a terminated upload kept: %v, %v", entries, err)
+	}
+	// Requests for uploads that do not exist leave no lock behind
+	serve(r, tusRequest("DELETE", "/uploads/missing", nil))
+	patchTestUpload(r, "/uploads/missing", 0, "x")
+	if len(h.uploadLocks) != 0 {
+		t.Errorf("%d upload locks kept", len(h.uploadLocks))
+	}
+}
+
+func TestUploadExpiry(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	r := newTestRouter(h, userID)
+	location := createTestUpload(r, entryID, "notes.txt", 10).Header().Get("Location")
+	id := strings.TrimPrefix(location, "/uploads/")
+	if w := patchTestUpload(r, location, 0, "12345"); w.Code != http.StatusNoContent {
+		t.Fatalf("chunk status = %d: %s", w.Code, w.Body)
+	}
+	_, err := testDB.Exec(`UPDATE uploads SET expires_at=? WHERE id=?`, time.Now().Add(-time.Minute).UTC(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An expired upload cannot be resumed, and is deleted by the expiry job
+	if code, _ := uploadOffset(r, location); code != http.StatusNotFound {
+		t.Errorf("offset of an expired upload = %d, want 404", code)
+	}
+	if w := patchTestUpload(r, location, 5, "67890"); w.Code != http.StatusNotFound {
+		t.Errorf("chunk of an expired upload = %d, want 404", w.Code)
+	}
+	deleted, err := s.ExpireUploads()
+	if err != nil || deleted != 1 {
+		t.Fatalf("ExpireUploads = %d, %v, want 1", deleted, err)
+	}
+	entries, err := os.ReadDir(s.UploadDir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("content of an expired upload kept: %v, %v", entries, err)
+	}
+}
+
+func TestUploadQuotaCountsPendingUploads(t *testing.T) {
+	h, s := newTestHandler(t)
+	h.StorageQuota = 100
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	r := newTestRouter(h, userID)
+	first := createTestUpload(r, entryID, "first.txt", 80)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", first.Code, first.Body)
+	}
+	// The space the unfinished upload needs is taken
+	if w := createTestUpload(r, entryID, "second.txt", 30); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("second upload status = %d, want 413: %s", w.Code, w.Body)
+	}
+	w := serve(r, uploadRequest(t, "POST", "/files", map[string]string{
+		"entryID": strconv.Itoa(entryID),
+	}, "files", "notes.txt", strings.Repeat("a", 30)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("file upload status = %d, want 413: %s", w.Code, w.Body)
+	}
+	// Once finished, the upload only counts as the file it became
+	w = patchTestUpload(r, first.Header().Get("Location"), 0, strings.Repeat("b", 80))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("finishing status = %d: %s", w.Code, w.Body)
+	}
+	if used := storageUsed(t, s, userID); used != 80 {
+		t.Errorf("used = %d, want 80", used)
+	}
+	if w := createTestUpload(r, entryID, "second.txt", 20); w.Code != http.StatusCreated {
+		t.Errorf("upload within the quota status = %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,148 @@
+package learningtransport
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	learningmodel "github.com/khoaphungnguyen/learning-tracker/internal/learning/model"
+)
+
+// Handle the versions of a file, newest first
+func (h *LearningHandler) GetFileVersions(c *gin.Context) {
+	file, ok := h.ownFile(c)
+	if !ok {
+		return
+	}
+	versions, err := h.learningHandler.GetFileVersions(file.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, versions)
+}
+
+// Handle download of a version of a file
+func (h *LearningHandler) DownloadFileVersion(c *gin.Context) {
+	version, ok := h.ownFileVersion(c)
+	if !ok || !h.scanAllows(c, version.FileID, version.ScanStatus, version.ScanSignature) {
+		return
+	}
+	// A version never changes, so clients may keep it
+	h.sendContent(c, storedContent{
+		Key:         version.FilePath,
+		ContentType: version.FileType,
+		FileName:    version.FileName,
+		ETag:        version.SHA256,
+		Immutable:   true,
+		ModTime:     version.CreatedAt,
+	}, fmt.Sprintf("File#%d version %d content not found", version.FileID, version.Version))
+}
+
+// Handle restore of a version of a file, whose content becomes the newest version
+func (h *LearningHandler) RestoreFileVersion(c *gin.Context) {
+	userID := c.GetInt("id")
+	version, ok := h.ownFileVersion(c)
+	if !ok {
+		return
+	}
+	if version.Current {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Version %d is the current version", version.Version),
+		})
+		return
+	}
+	// The content of the version is already stored and counted, so restoring it adds nothing,
+	// but files do not change while the user is over their quota
+	used, quota, ok := h.quotaUsage(c, userID)
+	if !ok {
+		return
+	}
+	if quota > 0 && used > quota {
+		quotaExceeded(c, used, quota)
+		return
+	}
+	keep, ok := h.versionsKept(c, userID)
+	if !ok {
+		return
+	}
+	err := h.learningHandler.RestoreFileVersion(version.FileID, userID, version.Version, keep)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("File#%d is restored to version %d", version.FileID, version.Version),
+	})
+}
+
+// ownFile returns the file in the URL if it belongs to the logged in user
+func (h *LearningHandler) ownFile(c *gin.Context) (learningmodel.LearningFiles, bool) {
+	fileID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid file ID",
+		})
+		return learningmodel.LearningFiles{}, false
+	}
+	file, err := h.learningHandler.GetFileByID(fileID)
+	if err != nil || file.UserID != c.GetInt("id") {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("File#%d not found", fileID),
+		})
+		return file, false
+	}
+	return file, true
+}
+
+// ownFileVersion returns the version in the URL of a file of the logged in user
+func (h *LearningHandler) ownFileVersion(c *gin.Context) (learningmodel.FileVersion, bool) {
+	file, ok := h.ownFile(c)
+	if !ok {
+		return learningmodel.FileVersion{}, false
+	}
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid version",
+		})
+		return learningmodel.FileVersion{}, false
+	}
+	version, err := h.learningHandler.GetFileVersion(file.ID, number)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("File#%d version %d not found", file.ID, number),
+		})
+		return version, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return version, false
+	}
+	return version, true
+}
+
+// versionsKept returns how many versions of each file a user keeps.
+// The number set on the user wins over the default.
+func (h *LearningHandler) versionsKept(c *gin.Context, userID int) (int, bool) {
+	kept, err := h.learningHandler.GetFileVersionsKept(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return 0, false
+	}
+	if kept != nil {
+		return *kept, true
+	}
+	return h.FileVersionsKept, true
+}
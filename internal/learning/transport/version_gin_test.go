@@ -0,0 +1,225 @@
+package learningtransport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	learningbusiness "github.com/khoaphungnguyen/learning-tracker/internal/learning/business"
+	userstorage "github.com/khoaphungnguyen/learning-tracker/internal/users/storage"
+)
+
+// storageUsed returns the bytes a user's files and versions take
+func storageUsed(t *testing.T, s *learningbusiness.LearningService, userID int) int64 {
+	t.Helper()
+	used, _, err := s.GetStorageUsage(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return used
+}
+
+// updateTestFile replaces the content of a file and returns the response
+func updateTestFile(t *testing.T, h *LearningHandler, userID int, fileID int, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(newTestRouter(h, userID), uploadRequest(t, "PUT", "/files", map[string]string{
+		"id": strconv.Itoa(fileID),
+	}, "file", "notes.txt", content))
+}
+
+func TestStorageUsageCountsVersions(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	first := strings.Repeat("a", 100)
+	fileID := createTestFile(t, h, s, userID, entryID, first)
+	if used := storageUsed(t, s, userID); used != 100 {
+		t.Fatalf("used = %d, want 100", used)
+	}
+	// The replaced content is kept as a version
+	w := updateTestFile(t, h, userID, fileID, strings.Repeat("b", 50))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body)
+	}
+	if used := storageUsed(t, s, userID); used != 150 {
+		t.Errorf("used with a version kept = %d, want 150", used)
+	}
+	// Content already stored is not counted again
+	createTestFile(t, h, s, userID, entryID, first)
+	if used := storageUsed(t, s, userID); used != 150 {
+		t.Errorf("used with a duplicate file = %d, want 150", used)
+	}
+	// Versions past the limit no longer count once deleted
+	h.FileVersionsKept = 1
+	w = updateTestFile(t, h, userID, fileID, strings.Repeat("c", 10))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body)
+	}
+	if used := storageUsed(t, s, userID); used != 110 {
+		t.Errorf("used after versions are deleted = %d, want 110", used)
+	}
+}
+
+func TestUpdateFileQuotaCountsVersions(t *testing.T) {
+	h, s := newTestHandler(t)
+	h.StorageQuota = 150
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, strings.Repeat("a", 100))
+	// The old content is kept, so a smaller replacement still has to fit next to it
+	w := updateTestFile(t, h, userID, fileID, strings.Repeat("b", 60))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("update over quota status = %d, want 413: %s", w.Code, w.Body)
+	}
+	w = updateTestFile(t, h, userID, fileID, strings.Repeat("b", 50))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update within quota status = %d: %s", w.Code, w.Body)
+	}
+	if used := storageUsed(t, s, userID); used != 150 {
+		t.Errorf("used = %d, want 150", used)
+	}
+}
+
+func TestRestoreFileVersionQuota(t *testing.T) {
+	h, s := newTestHandler(t)
+	h.StorageQuota = 150
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, strings.Repeat("a", 100))
+	w := updateTestFile(t, h, userID, fileID, strings.Repeat("b", 50))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body)
+	}
+	restore := "/files/" + strconv.Itoa(fileID) + "/versions/1/restore"
+	// The restored content is already stored, so a user at their quota can restore it
+	w = serve(newTestRouter(h, userID), httptest.NewRequest("POST", restore, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore status = %d: %s", w.Code, w.Body)
+	}
+	if used := storageUsed(t, s, userID); used != 150 {
+		t.Errorf("used after restore = %d, want 150", used)
+	}
+	// Not once they are over it
+	h.StorageQuota = 120
+	w = serve(newTestRouter(h, userID), httptest.NewRequest("POST", restore, nil))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("restore over quota status = %d, want 413: %s", w.Code, w.Body)
+	}
+}
+
+func TestDeleteEntryFreesStorage(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	goalID, entryID := createTestEntry(t, s, userID)
+	_, otherEntry := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, strings.Repeat("a", 100))
+	w := updateTestFile(t, h, userID, fileID, strings.Repeat("b", 50))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body)
+	}
+	createTestFile(t, h, s, userID, otherEntry, strings.Repeat("c", 10))
+	r := newTestRouter(h, userID)
+
+	// Another user cannot delete the entry
+	w = serve(newTestRouter(h, createTestUser(t)), httptest.NewRequest("DELETE", "/entries/"+strconv.Itoa(entryID), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("delete by another user status = %d, want 404: %s", w.Code, w.Body)
+	}
+
+	// The files of a deleted entry and their versions no longer count
+	w = serve(r, httptest.NewRequest("DELETE", "/entries/"+strconv.Itoa(entryID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d: %s", w.Code, w.Body)
+	}
+	if used := storageUsed(t, s, userID); used != 10 {
+		t.Errorf("used after deleting the entry = %d, want 10", used)
+	}
+	if _, err := s.GetFileByID(fileID); err == nil {
+		t.Error("file of the deleted entry is still there")
+	}
+
+	// Nor do the files of a deleted goal's entries
+	w = serve(r, httptest.NewRequest("DELETE", "/goals/"+strconv.Itoa(goalID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete goal status = %d: %s", w.Code, w.Body)
+	}
+	if used := storageUsed(t, s, userID); used != 10 {
+		t.Errorf("used after deleting an empty goal = %d, want 10", used)
+	}
+	otherGoal, err := s.GetEntryByID(otherEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = serve(r, httptest.NewRequest("DELETE", "/goals/"+strconv.Itoa(otherGoal.GoalID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete goal status = %d: %s", w.Code, w.Body)
+	}
+	if used := storageUsed(t, s, userID); used != 0 {
+		t.Errorf("used after deleting every goal = %d, want 0", used)
+	}
+	if _, err := s.GetEntryByID(otherEntry); err == nil {
+		t.Error("entry of the deleted goal is still there")
+	}
+}
+
+func TestCreateFileBodyLimitWithoutQuota(t *testing.T) {
+	h, s := newTestHandler(t)
+	h.StorageQuota = 0
+	h.MaxFileSize = 10
+	userID := createTestUser(t)
+	_, entryID := createTestEntry(t, s, userID)
+	// Larger than the most files a request may carry, plus the form overhead
+	w := serve(newTestRouter(h, userID), uploadRequest(t, "POST", "/files", map[string]string{
+		"entryID": strconv.Itoa(entryID),
+	}, "files", "notes.txt", strings.Repeat("a", multipartOverhead+maxFilesPerUpload*10+1)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload status = %d, want 413: %s", w.Code, w.Body)
+	}
+}
+
+func TestStorageFiguresAgree(t *testing.T) {
+	h, s := newTestHandler(t)
+	userID := createTestUser(t)
+	goalID, entryID := createTestEntry(t, s, userID)
+	otherGoal, otherEntry := createTestEntry(t, s, userID)
+	fileID := createTestFile(t, h, s, userID, entryID, strings.Repeat("a", 100))
+	w := updateTestFile(t, h, userID, fileID, strings.Repeat("b", 50))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body)
+	}
+	// Content stored once for two goals counts in the goal that stored it first
+	createTestFile(t, h, s, userID, otherEntry, strings.Repeat("a", 100))
+	createTestFile(t, h, s, userID, otherEntry, strings.Repeat("c", 10))
+
+	used := storageUsed(t, s, userID)
+	if used != 160 {
+		t.Fatalf("used = %d, want 160", used)
+	}
+	goals, err := s.GetStorageByGoal(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int][2]int64{goalID: {1, 150}, otherGoal: {2, 10}}
+	var total int64
+	for _, goal := range goals {
+		if got := [2]int64{int64(goal.Files), goal.UsedBytes}; got != want[goal.GoalID] {
+			t.Errorf("goal %d has %d files of %d bytes, want %v", goal.GoalID, goal.Files, goal.UsedBytes, want[goal.GoalID])
+		}
+		total += goal.UsedBytes
+	}
+	if len(goals) != 2 || total != used {
+		t.Errorf("%d goals of %d bytes, want 2 adding up to %d", len(goals), total, used)
+	}
+
+	users, err := userstorage.NewUserStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer users.DB.Close()
+	stats, err := users.GetUserStats(userID)
+	if err != nil || stats.StorageBytes != used || stats.Files != 3 {
+		t.Errorf("admin stats = %+v, %v, want %d bytes in 3 files", stats, err, used)
+	}
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	Host     string // Host of the SMTP server
+	Port     string // Port of the SMTP server
+	Username string // Username for PLAIN auth, auth is skipped if empty
+	Password string // Password for PLAIN auth
+	From     string // Sender address
+}
+
+// Send sends an email through the SMTP server
+func (m *SMTPMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	msg := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+	err := smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{to}, []byte(msg))
+	if err != nil {
+		return fmt.Errorf("sending mail to %s: %w", to, err)
+	}
+	return nil
+}
+
+// LogMailer writes emails to the log instead of sending them, for development
+type LogMailer struct{}
+
+// Send logs the email
+func (LogMailer) Send(to string, subject string, body string) error {
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
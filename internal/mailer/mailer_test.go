@@ -0,0 +1,171 @@
+package mailer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpStub is a minimal SMTP server that records what it receives
+type smtpStub struct {
+	listener net.Listener
+
+	mu         sync.Mutex
+	rejectRcpt bool   // Answer RCPT TO with a permanent failure
+	auth       string // Decoded AUTH PLAIN credentials
+	from       string
+	to         []string
+	data       string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &smtpStub{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+// mailer returns an SMTPMailer pointed at the stub
+func (s *smtpStub) mailer() *SMTPMailer {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return &SMTPMailer{Host: host, Port: port, From: "tracker@example.com"}
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-stub")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH PLAIN "):
+			credentials, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			s.mu.Lock()
+			s.auth = string(credentials)
+			s.mu.Unlock()
+			reply("235 authenticated")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = line[len("MAIL FROM:"):]
+			s.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.mu.Lock()
+			if s.rejectRcpt {
+				s.mu.Unlock()
+				reply("550 no such user")
+				continue
+			}
+			s.to = append(s.to, line[len("RCPT TO:"):])
+			s.mu.Unlock()
+			reply("250 ok")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	stub := newSMTPStub(t)
+	err := stub.mailer().Send("user@example.com", "Verify your email address", "Open this link:\nhttp://localhost/verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.from != "<tracker@example.com>" {
+		t.Errorf("MAIL FROM = %q", stub.from)
+	}
+	if len(stub.to) != 1 || stub.to[0] != "<user@example.com>" {
+		t.Errorf("RCPT TO = %q", stub.to)
+	}
+	if stub.auth != "" {
+		t.Errorf("authenticated without a username: %q", stub.auth)
+	}
+	for _, want := range []string{
+		"From: tracker@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: Verify your email address\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"\r\n\r\nOpen this link:\r\nhttp://localhost/verify",
+	} {
+		if !strings.Contains(stub.data, want) {
+			t.Errorf("message is missing %q:\n%s", want, stub.data)
+		}
+	}
+}
+
+func TestSMTPMailerSendAuth(t *testing.T) {
+	stub := newSMTPStub(t)
+	m := stub.mailer()
+	m.Username = "tracker"
+	m.Password = "secret"
+	err := m.Send("user@example.com", "Reset your password", "body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.auth != "\x00tracker\x00secret" {
+		t.Errorf("AUTH PLAIN = %q", stub.auth)
+	}
+}
+
+func TestSMTPMailerSendRejected(t *testing.T) {
+	stub := newSMTPStub(t)
+	stub.mu.Lock()
+	stub.rejectRcpt = true
+	stub.mu.Unlock()
+	err := stub.mailer().Send("nobody@example.com", "Subject", "body")
+	if err == nil {
+		t.Fatal("expected an error for a rejected recipient")
+	}
+	if !strings.Contains(err.Error(), "nobody@example.com") {
+		t.Errorf("error does not name the recipient: %v", err)
+	}
+}
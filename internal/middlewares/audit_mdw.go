@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+	auditbusiness "github.com/khoaphungnguyen/learning-tracker/internal/audit/business"
+	auditmodel "github.com/khoaphungnguyen/learning-tracker/internal/audit/model"
+)
+
+// AuditMiddleware is a middleware that records every request it wraps in the audit log.
+// Handlers can add context to the event by setting "auditDetails" on the gin context.
+// It must run after AuthMiddleware.
+func AuditMiddleware(auditService *auditbusiness.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		// Record the event once the handler has produced its status
+		err := auditService.CreateEvent(auditmodel.AuditEvent{
+			ActorID:  c.GetInt("id"),
+			Action:   c.Request.Method + " " + c.FullPath(),
+			TargetID: c.Param("id"),
+			Status:   c.Writer.Status(),
+			Details:  c.GetString("auditDetails"),
+			IP:       c.ClientIP(),
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -1,15 +1,20 @@
 package middleware
 
 import (
-	"strconv"
+	"log"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	userbusiness "github.com/khoaphungnguyen/learning-tracker/internal/users/business"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
 )
 
-// AuthMiddleware is a middleware that validates token and authorizes users
-func AuthMiddleware(secretKey string) gin.HandlerFunc {
+// AuthMiddleware is a middleware that validates token and authorizes users.
+// It accepts both JWT access tokens and personal access tokens.
+// verification applies the email verification mode to the owner of a personal access token,
+// as they do not log in to get one; it returns whether their access is restricted, or false to refuse it.
+func AuthMiddleware(jwtWrapper auth.JwtWrapper, userService *userbusiness.UserService, verification func(usermodel.User) (unverified bool, allowed bool)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		// Get the Authorization header from the request
@@ -32,10 +37,10 @@ func AuthMiddleware(secretKey string) gin.HandlerFunc {
 			return
 		}
 
-		// Create a JwtWrapper with the secret key and issuer
-		jwtWrapper := auth.JwtWrapper{
-			SecretKey: secretKey,
-			Issuer:    "AuthService",
+		// Personal access tokens are looked up instead of being validated as JWTs
+		if auth.IsPAT(clientToken) {
+			authenticatePAT(c, userService, verification, clientToken)
+			return
 		}
 
 		// Validate the token
@@ -45,15 +50,102 @@ func AuthMiddleware(secretKey string) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		// Convert id to int
-		id, err := strconv.Atoi(claims.Audience)
+		// Get the user ID from the claims
+		id, err := claims.UserID()
 		if err != nil {
 			c.JSON(401, err.Error())
 			c.Abort()
 			return
 		}
+		// Tokens issued before sessions existed have none and stay valid until they expire
+		if claims.SessionID != 0 {
+			session, err := userService.GetSession(claims.SessionID)
+			if err != nil || session.UserID != id || session.RevokedAt != nil {
+				c.JSON(401, "Session has been revoked")
+				c.Abort()
+				return
+			}
+			err = userService.TouchSession(session.ID)
+			if err != nil {
+				log.Println(err)
+			}
+			c.Set("session", session.ID)
+		}
 		// Set the claims in the context
 		c.Set("id", id)
+		c.Set("role", claims.Role)
+		c.Set("unverified", claims.Unverified)
+		c.Next()
+	}
+}
+
+// authenticatePAT authorizes a request made with a personal access token
+func authenticatePAT(c *gin.Context, userService *userbusiness.UserService, verification func(usermodel.User) (bool, bool), clientToken string) {
+	token, err := userService.GetPersonalAccessToken(auth.HashOpaqueToken(clientToken))
+	if err != nil || token.IsExpired() {
+		c.JSON(401, "Invalid or expired personal access token")
+		c.Abort()
+		return
+	}
+	// Load the user so role changes and account restrictions apply immediately
+	user, err := userService.GetUser(token.UserID)
+	if err != nil || user.Disabled || user.IsLocked() {
+		c.JSON(401, "Account is not available")
+		c.Abort()
+		return
+	}
+	unverified, allowed := verification(user)
+	if !allowed {
+		c.JSON(403, "Email address not verified")
+		c.Abort()
+		return
+	}
+	err = userService.TouchPersonalAccessToken(token.ID)
+	if err != nil {
+		log.Println(err)
+	}
+	c.Set("id", user.ID)
+	c.Set("role", user.Role)
+	c.Set("scopes", token.Scopes)
+	c.Set("unverified", unverified)
+	c.Next()
+}
+
+// RequirePermission is a middleware that only lets through users whose role grants perm,
+// and for personal access tokens, whose scopes grant it as well.
+// It must run after AuthMiddleware.
+func RequirePermission(perm auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := auth.Role(c.GetString("role"))
+		if !role.HasPermission(perm) {
+			c.JSON(403, "Insufficient permissions")
+			c.Abort()
+			return
+		}
+		if scopes := c.GetStringSlice("scopes"); scopes != nil && !auth.ScopesAllow(scopes, perm) {
+			c.JSON(403, "Token scopes do not allow this")
+			c.Abort()
+			return
+		}
+		if c.GetBool("unverified") && !auth.AllowedUnverified(perm) {
+			c.JSON(403, "Email address not verified")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyPersonalTokens is a middleware that rejects requests made with a personal access token,
+// for account and admin routes that need an interactive login.
+// It must run after AuthMiddleware.
+func DenyPersonalTokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("scopes"); ok {
+			c.JSON(403, "Personal access tokens cannot be used here")
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
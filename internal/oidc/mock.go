@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockKeyID    = "mock"
+	mockCodeTTL  = time.Minute
+	mockTokenTTL = 5 * time.Minute
+)
+
+// MockProvider is a minimal identity provider for trying out OIDC logins locally.
+// It logs in whoever is named by the login_hint parameter, or asks for an email address,
+// and vouches for that email without any password.
+type MockProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	key   *rsa.PrivateKey
+	path  string // Path of the issuer URL, which the endpoints are under
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant is an issued authorization code waiting to be redeemed
+type mockGrant struct {
+	email         string
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+	expiresAt     time.Time
+}
+
+var mockLoginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body>
+<h1>Mock identity provider</h1>
+<form method="get">
+{{range $name, $values := .}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">{{end}}{{end}}
+<label>Email <input type="email" name="login_hint" required></label>
+<button type="submit">Log in</button>
+</form>
+</body></html>
+`))
+
+// NewMockProvider creates a mock identity provider with a fresh signing key
+func NewMockProvider(issuer string, clientID string, clientSecret string) (*MockProvider, error) {
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &MockProvider{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		path:         strings.TrimSuffix(issuerURL.Path, "/"),
+		codes:        make(map[string]mockGrant),
+	}, nil
+}
+
+// ServeHTTP serves the discovery document, signing keys, login page and token endpoint
+func (m *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, m.path) {
+	case "/.well-known/openid-configuration":
+		m.discovery(w)
+	case "/keys":
+		m.keys(w)
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockProvider) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                m.Issuer,
+		"authorization_endpoint":                m.Issuer + "/authorize",
+		"token_endpoint":                        m.Issuer + "/token",
+		"jwks_uri":                              m.Issuer + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *MockProvider) keys(w http.ResponseWriter) {
+	encoding := base64.RawURLEncoding
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": mockKeyID,
+			"n":   encoding.EncodeToString(m.key.N.Bytes()),
+			"e":   encoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" || query.Get("client_id") != m.ClientID ||
+		query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	email := query.Get("login_hint")
+	if email == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		mockLoginPage.Execute(w, query)
+		return
+	}
+	code := randomString()
+	m.mu.Lock()
+	for unused, grant := range m.codes {
+		if time.Now().After(grant.expiresAt) {
+			delete(m.codes, unused)
+		}
+	}
+	m.codes[code] = mockGrant{
+		email:         email,
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+		expiresAt:     time.Now().Add(mockCodeTTL),
+	}
+	m.mu.Unlock()
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (m *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		// Credentials in the Authorization header are form encoded (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != m.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(m.ClientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	m.mu.Lock()
+	grant, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || time.Now().After(grant.expiresAt) || grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.Issuer,
+		"sub":            grant.email,
+		"aud":            m.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(mockTokenTTL).Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.email,
+		"email_verified": true,
+		"name":           strings.Split(grant.email, "@")[0],
+	})
+	idToken.Header["kid"] = mockKeyID
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(mockTokenTTL.Seconds()),
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// randomString returns a random URL-safe string for codes and tokens
+func randomString() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
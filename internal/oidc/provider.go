@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrNonceMismatch is returned when an ID token was not issued for the login in progress
+var ErrNonceMismatch = errors.New("oidc: nonce does not match")
+
+// httpClient is used for all requests to identity providers
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Provider is an OpenID Connect identity provider users can log in with
+type Provider struct {
+	ID           string // Short name used in URLs
+	Name         string // Name shown to users
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	mu       sync.Mutex
+	config   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// Identity is the account an identity provider vouched for
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// discover fetches the provider metadata on first use,
+// so a provider that is down does not stop the server from starting
+func (p *Provider) discover() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.verifier != nil {
+		return nil
+	}
+	// The provider keeps this context to refresh its signing keys, so it must outlive the request
+	ctx := gooidc.ClientContext(context.Background(), httpClient)
+	provider, err := gooidc.NewProvider(ctx, p.Issuer)
+	if err != nil {
+		return err
+	}
+	p.config = oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{gooidc.ScopeOpenID, "email", "profile"},
+	}
+	p.verifier = provider.Verifier(&gooidc.Config{ClientID: p.ClientID})
+	return nil
+}
+
+// AuthCodeURL returns the URL of the provider's login page for an authorization code flow with PKCE.
+// loginHint is passed on to the provider to prefill the account, if set.
+func (p *Provider) AuthCodeURL(state string, nonce string, codeVerifier string, loginHint string) (string, error) {
+	err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	options := []oauth2.AuthCodeOption{gooidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)}
+	if loginHint != "" {
+		options = append(options, oauth2.SetAuthURLParam("login_hint", loginHint))
+	}
+	return p.config.AuthCodeURL(state, options...), nil
+}
+
+// Exchange redeems an authorization code and validates the ID token that comes with it
+func (p *Provider) Exchange(ctx context.Context, code string, nonce string, codeVerifier string) (Identity, error) {
+	var identity Identity
+	err := p.discover()
+	if err != nil {
+		return identity, err
+	}
+	ctx = gooidc.ClientContext(ctx, httpClient)
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return identity, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return identity, errors.New("oidc: token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return identity, err
+	}
+	if idToken.Nonce != nonce {
+		return identity, ErrNonceMismatch
+	}
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return identity, err
+	}
+	identity = Identity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}
+	return identity, nil
+}
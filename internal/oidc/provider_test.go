@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+const testRedirectURL = "http://tracker.test/auth/oidc/mock/callback"
+
+// newTestProvider serves a mock identity provider and returns a provider configured for it
+func newTestProvider(t *testing.T) (*MockProvider, *Provider) {
+	t.Helper()
+	var mock *MockProvider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	mock, err := NewMockProvider(server.URL, "learning-tracker", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mock, &Provider{
+		ID:           "mock",
+		Issuer:       mock.Issuer,
+		ClientID:     mock.ClientID,
+		ClientSecret: mock.ClientSecret,
+		RedirectURL:  testRedirectURL,
+	}
+}
+
+// authorize goes through the provider's login page and returns the authorization code
+func authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code")
+}
+
+func TestAuthCodeURLUsesPKCE(t *testing.T) {
+	_, provider := newTestProvider(t)
+	verifier := oauth2.GenerateVerifier()
+	authURL, err := provider.AuthCodeURL("state", "nonce", verifier, "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	challenge := sha256.Sum256([]byte(verifier))
+	want := map[string]string{
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"login_hint":            "user@example.com",
+		"code_challenge_method": "S256",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+	}
+	for name, value := range want {
+		if query.Get(name) != value {
+			t.Errorf("%s = %q, want %q", name, query.Get(name), value)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	_, provider := newTestProvider(t)
+	verifier := oauth2.GenerateVerifier()
+	authURL, err := provider.AuthCodeURL("state", "nonce", verifier, "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := provider.Exchange(context.Background(), authorize(t, authURL), "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "user@example.com" || identity.Email != "user@example.com" || !identity.EmailVerified {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	_, provider := newTestProvider(t)
+	authURL, err := provider.AuthCodeURL("state", "nonce", oauth2.GenerateVerifier(), "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Exchange(context.Background(), authorize(t, authURL), "nonce", oauth2.GenerateVerifier())
+	if err == nil {
+		t.Fatal("code redeemed with the wrong PKCE verifier")
+	}
+}
+
+func TestExchangeNonceMismatch(t *testing.T) {
+	_, provider := newTestProvider(t)
+	verifier := oauth2.GenerateVerifier()
+	authURL, err := provider.AuthCodeURL("state", "nonce", verifier, "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Exchange(context.Background(), authorize(t, authURL), "other nonce", verifier)
+	if !errors.Is(err, ErrNonceMismatch) {
+		t.Fatalf("err = %v, want ErrNonceMismatch", err)
+	}
+}
+
+func TestExchangeCodeOnce(t *testing.T) {
+	_, provider := newTestProvider(t)
+	verifier := oauth2.GenerateVerifier()
+	authURL, err := provider.AuthCodeURL("state", "nonce", verifier, "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := authorize(t, authURL)
+	_, err = provider.Exchange(context.Background(), code, "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Exchange(context.Background(), code, "nonce", verifier)
+	if err == nil {
+		t.Fatal("code redeemed twice")
+	}
+}
@@ -0,0 +1,187 @@
+package privacybusiness
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"time"
+
+	auditmodel "github.com/khoaphungnguyen/learning-tracker/internal/audit/model"
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+)
+
+// Export writes a zip archive of everything held about a user: JSON documents
+// of their profile, content, sessions and audit events, and their uploaded files.
+func (s *PrivacyService) Export(ctx context.Context, userID int, w io.Writer) error {
+	user, err := s.userService.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	goals, err := s.learningService.GetAllGoalsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	entries, err := s.learningService.GetAllEntriesByUserID(userID)
+	if err != nil {
+		return err
+	}
+	files, err := s.learningService.GetAllFilesByUserID(userID)
+	if err != nil {
+		return err
+	}
+	sessions, err := s.userService.ListSessions(userID)
+	if err != nil {
+		return err
+	}
+	identities, err := s.userService.ListIdentities(userID)
+	if err != nil {
+		return err
+	}
+	tokens, err := s.userService.ListPersonalAccessTokens(userID)
+	if err != nil {
+		return err
+	}
+	events, err := s.auditService.ListEventsByActor(userID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	documents := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"goals.json", goals},
+		{"entries.json", entries},
+		{"files.json", files},
+		{"sessions.json", sessions},
+		{"identities.json", identities},
+		{"access_tokens.json", tokens},
+		{"audit_events.json", events},
+	}
+	for _, document := range documents {
+		out, err := createEntry(archive, document.name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(document.data)
+		if err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		// Quarantined files are listed in files.json with their scan status, but not sent
+		if !s.learningService.ScanAllowsDownload(file.ScanStatus) {
+			continue
+		}
+		err = s.addFile(ctx, archive, fmt.Sprintf("attachments/%d_%s", file.ID, path.Base(file.FileName)), file.FilePath)
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// addFile copies a blob into the archive, skipping blobs that are missing from the store
+func (s *PrivacyService) addFile(ctx context.Context, archive *zip.Writer, name string, key string) error {
+	in, err := s.blobs.Get(ctx, key)
+	if errors.Is(err, blob.ErrNotFound) {
+		log.Printf("export: %s is missing", key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createEntry(archive, name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// createEntry adds a compressed file stamped with the current time to the archive
+func createEntry(archive *zip.Writer, name string) (io.Writer, error) {
+	return archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+}
+
+// Erase deletes a user with all their content, tokens and uploaded files, and removes
+// them from the audit log, leaving an anonymised event recording the erasure
+func (s *PrivacyService) Erase(ctx context.Context, userID int) error {
+	paths, err := s.learningService.PurgeUserContent(userID)
+	if err != nil {
+		return err
+	}
+	err = s.userService.DeleteUser(userID)
+	if err != nil {
+		return err
+	}
+	err = s.auditService.AnonymizeActor(userID)
+	if err != nil {
+		return err
+	}
+	// The rows are gone, so a blob left in the store is only logged.
+	// Blobs are kept under the user ID, which also catches ones no row points to.
+	leftovers, err := s.blobs.List(ctx, fmt.Sprintf("%d/", userID))
+	if err != nil {
+		log.Println(err)
+	}
+	keys := paths
+	for _, info := range leftovers {
+		keys = append(keys, info.Key)
+	}
+	for _, key := range keys {
+		err = s.blobs.Delete(ctx, key)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return s.auditService.CreateEvent(auditmodel.AuditEvent{
+		Action:   "ERASE account",
+		TargetID: strconv.Itoa(userID),
+		Status:   200,
+		Details:  fmt.Sprintf("files=%d", len(paths)),
+	})
+}
+
+// EraseDue erases the accounts whose grace period has ended
+func (s *PrivacyService) EraseDue() error {
+	ids, err := s.userService.ListDueErasures(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err = s.Erase(context.Background(), id)
+		if err != nil {
+			return fmt.Errorf("erasing user %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// RunErasures erases due accounts now and then at every interval, it does not return
+func (s *PrivacyService) RunErasures(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := s.EraseDue()
+		if err != nil {
+			log.Println(err)
+		}
+		<-ticker.C
+	}
+}
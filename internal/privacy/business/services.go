@@ -0,0 +1,20 @@
+package privacybusiness
+
+import (
+	auditbusiness "github.com/khoaphungnguyen/learning-tracker/internal/audit/business"
+	"github.com/khoaphungnguyen/learning-tracker/internal/blob"
+	learningbusiness "github.com/khoaphungnguyen/learning-tracker/internal/learning/business"
+	userbusiness "github.com/khoaphungnguyen/learning-tracker/internal/users/business"
+)
+
+// PrivacyService exports and erases everything held about a user across the other services
+type PrivacyService struct {
+	userService     *userbusiness.UserService
+	learningService *learningbusiness.LearningService
+	auditService    *auditbusiness.AuditService
+	blobs           blob.BlobStore
+}
+
+func NewPrivacyService(userService *userbusiness.UserService, learningService *learningbusiness.LearningService, auditService *auditbusiness.AuditService, blobs blob.BlobStore) *PrivacyService {
+	return &PrivacyService{userService: userService, learningService: learningService, auditService: auditService, blobs: blobs}
+}
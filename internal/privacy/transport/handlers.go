@@ -0,0 +1,11 @@
+package privacytransport
+
+import privacybusiness "github.com/khoaphungnguyen/learning-tracker/internal/privacy/business"
+
+type PrivacyHandler struct {
+	privacyHandler *privacybusiness.PrivacyService
+}
+
+func NewPrivacyHandler(privacyHandler *privacybusiness.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{privacyHandler: privacyHandler}
+}
@@ -0,0 +1,37 @@
+package privacytransport
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportData sends a zip archive of everything held about the logged in user
+func (h *PrivacyHandler) ExportData(c *gin.Context) {
+	userID := c.GetInt("id")
+	// Build the archive on disk first, so a failure can still be reported with an error status
+	archive, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Exporting Data",
+		})
+		c.Abort()
+		return
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	err = h.privacyHandler.Export(c, userID, archive)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Exporting Data",
+		})
+		c.Abort()
+		return
+	}
+	c.FileAttachment(archive.Name(), fmt.Sprintf("learning-tracker-export-%s.zip", time.Now().Format("2006-01-02")))
+}
@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Clamd scans content with ClamAV's clamd daemon over TCP, streaming it with the INSTREAM command.
+// clamd refuses content larger than its StreamMaxLength, 25MiB by default, which fails the scan.
+type Clamd struct {
+	// Address is the host:port clamd listens on
+	Address string
+	// Timeout is how long a scan may take, from connecting to the verdict
+	Timeout time.Duration
+	// ChunkSize is how many bytes are sent to clamd at a time
+	ChunkSize int
+}
+
+// NewClamd returns a scanner using the clamd listening at address
+func NewClamd(address string) *Clamd {
+	return &Clamd{
+		Address:   address,
+		Timeout:   2 * time.Minute,
+		ChunkSize: 64 << 10,
+	}
+}
+
+func (s *Clamd) Name() string {
+	return "clamd"
+}
+
+func (s *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Close the connection when the context ends, which interrupts a blocked read or write
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	sendErr := s.send(conn, r)
+	// clamd answers and hangs up as soon as the stream is too long, so a failed send
+	// may still have a reply explaining it
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		if sendErr != nil {
+			return Result{}, sendErr
+		}
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, fmt.Errorf("clamd: reading reply: %w", err)
+	}
+	return parseReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+// send streams content to clamd in chunks, each prefixed with its length,
+// and ends the stream with an empty chunk
+func (s *Clamd) send(conn net.Conn, r io.Reader) error {
+	_, err := conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return err
+	}
+	chunkSize := s.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 64 << 10
+	}
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			_, writeErr := conn.Write(buf[:4+n])
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseReply reads the verdict in a reply to INSTREAM, which is like "stream: OK",
+// "stream: Eicar-Signature FOUND" or "INSTREAM size limit exceeded. ERROR"
+func parseReply(reply string) (Result, error) {
+	verdict := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	case strings.HasSuffix(verdict, " ERROR"):
+		return Result{}, fmt.Errorf("%w: clamd: %s", ErrScanFailed, strings.TrimSuffix(verdict, " ERROR"))
+	}
+	return Result{}, fmt.Errorf("clamd: unexpected reply %q", reply)
+}
+
+// Ping checks clamd is reachable and answering
+func (s *Clamd) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	_, err = conn.Write([]byte("zPING\x00"))
+	if err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG\x00" {
+		return fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+	return nil
+}
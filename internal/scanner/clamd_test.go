@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply      string
+		want       Result
+		failed     bool
+		unexpected bool
+	}{
+		{reply: "stream: OK", want: Result{}},
+		{reply: "stream: Eicar-Test-Signature FOUND", want: Result{Infected: true, Signature: "Eicar-Test-Signature"}},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND\n", want: Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}},
+		{reply: "INSTREAM size limit exceeded. ERROR", failed: true},
+		{reply: "stream: Can't allocate memory ERROR", failed: true},
+		{reply: "UNKNOWN COMMAND", unexpected: true},
+		{reply: "", unexpected: true},
+	}
+	for _, test := range tests {
+		result, err := parseReply(test.reply)
+		switch {
+		case test.failed:
+			if !errors.Is(err, ErrScanFailed) {
+				t.Errorf("parseReply(%q) error = %v, want ErrScanFailed", test.reply, err)
+			}
+		case test.unexpected:
+			if err == nil || errors.Is(err, ErrScanFailed) {
+				t.Errorf("parseReply(%q) error = %v, want an error to retry", test.reply, err)
+			}
+		default:
+			if err != nil || result != test.want {
+				t.Errorf("parseReply(%q) = %+v, %v, want %+v", test.reply, result, err, test.want)
+			}
+		}
+	}
+}
+
+// serveClamd answers INSTREAM scans on a local port like clamd, finding the EICAR test string,
+// and returns its address
+func serveClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				command, err := r.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					return
+				}
+				var content bytes.Buffer
+				for {
+					var size uint32
+					err = binary.Read(r, binary.BigEndian, &size)
+					if err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					_, err = io.CopyN(&content, r, int64(size))
+					if err != nil {
+						return
+					}
+				}
+				reply := "stream: OK\x00"
+				if bytes.Contains(content.Bytes(), eicar) {
+					reply = "stream: Eicar-Test-Signature FOUND\x00"
+				}
+				conn.Write([]byte(reply))
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClamdScan(t *testing.T) {
+	clamd := NewClamd(serveClamd(t))
+	// Small chunks, so the test string is split between them
+	clamd.ChunkSize = 16
+	result, err := clamd.Scan(context.Background(), strings.NewReader("some notes"))
+	if err != nil || result.Infected {
+		t.Errorf("clean content: %+v, %v", result, err)
+	}
+	result, err = clamd.Scan(context.Background(), strings.NewReader("some notes "+string(eicar)))
+	if err != nil || !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Errorf("infected content: %+v, %v", result, err)
+	}
+}
+
+func TestClamdUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	_, err = NewClamd(address).Scan(context.Background(), strings.NewReader("some notes"))
+	// Retried later, unlike a scan that failed
+	if err == nil || errors.Is(err, ErrScanFailed) {
+		t.Errorf("err = %v, want an error to retry", err)
+	}
+}
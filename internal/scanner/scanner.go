@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrScanFailed is returned when a scanner could not tell whether content is infected, like when
+// it is larger than the scanner accepts. Scanning the same content again fails the same way.
+var ErrScanFailed = errors.New("scanner: scan failed")
+
+// Result is the verdict of a scan
+type Result struct {
+	Infected bool
+	// Signature names the malware found, empty if the content is clean
+	Signature string
+}
+
+// Scanner checks content for malware
+type Scanner interface {
+	// Name identifies the scanner in logs
+	Name() string
+	// Scan reads the whole content from r and returns the verdict. An error other than
+	// ErrScanFailed means the scanner could not be reached, and the scan can be retried.
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// eicar is the EICAR anti-virus test file, which every scanner reports as infected
+var eicar = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// EICAR is a fake scanner that finds nothing but the EICAR test string, for trying out
+// quarantine without a real scanner
+type EICAR struct{}
+
+func (EICAR) Name() string {
+	return "eicar"
+}
+
+func (EICAR) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	// Keep the end of the previous chunk, so a string split across two reads is found
+	buf := make([]byte, 32<<10)
+	kept := 0
+	for {
+		n, err := r.Read(buf[kept:])
+		window := buf[:kept+n]
+		if bytes.Contains(window, eicar) {
+			return Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+		}
+		if err == io.EOF {
+			return Result{}, nil
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		kept = min(len(window), len(eicar)-1)
+		copy(buf, window[len(window)-kept:])
+	}
+}
@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEICAR(t *testing.T) {
+	padding := strings.Repeat("x", 32<<10)
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"empty", "", false},
+		{"clean", "some notes", false},
+		{"test file", string(eicar), true},
+		{"inside content", "before " + string(eicar) + " after", true},
+		// The read buffer is 32KiB, so the string starts in one read and ends in the next
+		{"across reads", padding[:len(padding)-10] + string(eicar), true},
+		{"after a read", padding + string(eicar), true},
+		{"cut short", string(eicar[:len(eicar)-1]), false},
+	}
+	for _, test := range tests {
+		result, err := EICAR{}.Scan(context.Background(), strings.NewReader(test.content))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if result.Infected != test.want {
+			t.Errorf("%s: infected = %v, want %v", test.name, result.Infected, test.want)
+		}
+		if result.Infected && result.Signature == "" {
+			t.Errorf("%s: no signature", test.name)
+		}
+	}
+	// Readers may return a byte at a time
+	content := bytes.NewReader(append([]byte("some notes "), eicar...))
+	result, err := EICAR{}.Scan(context.Background(), iotest.OneByteReader(content))
+	if err != nil || !result.Infected {
+		t.Errorf("byte at a time: %+v, %v", result, err)
+	}
+}
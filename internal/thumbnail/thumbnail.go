@@ -0,0 +1,159 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnsupported is returned for content no thumbnail can be made of
+var ErrUnsupported = errors.New("thumbnail: unsupported type")
+
+// ErrTooLarge is returned for images with more pixels than the generator decodes
+var ErrTooLarge = errors.New("thumbnail: image too large")
+
+// ContentType is the type of the thumbnails made
+const ContentType = "image/jpeg"
+
+// Generator makes thumbnails of images, and of the first page of PDFs if a renderer is set
+type Generator struct {
+	// MaxPixels is the largest image decoded, in pixels, so a small file cannot
+	// expand into an image that exhausts memory
+	MaxPixels int
+	// PDFRenderer is the path of poppler's pdftoppm, PDFs are unsupported if empty
+	PDFRenderer string
+	// RenderTimeout is how long rendering a PDF page may take
+	RenderTimeout time.Duration
+}
+
+// NewGenerator returns a generator for images, which renders PDFs if pdftoppm is on the PATH
+func NewGenerator() *Generator {
+	renderer, _ := exec.LookPath("pdftoppm")
+	return &Generator{
+		MaxPixels:     50_000_000,
+		PDFRenderer:   renderer,
+		RenderTimeout: 30 * time.Second,
+	}
+}
+
+// Supported reports whether thumbnails can be made of content of a type
+func (g *Generator) Supported(contentType string) bool {
+	switch baseType(contentType) {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	case "application/pdf":
+		return g.PDFRenderer != ""
+	}
+	return false
+}
+
+// Decode returns the image of content of a type, the first frame of an animation
+// and the first page of a PDF
+func (g *Generator) Decode(ctx context.Context, content io.Reader, contentType string) (image.Image, error) {
+	if !g.Supported(contentType) {
+		return nil, ErrUnsupported
+	}
+	if baseType(contentType) == "application/pdf" {
+		return g.renderPDF(ctx, content)
+	}
+	return g.decodeImage(content)
+}
+
+// Resize scales an image down to fit in a square of size pixels, keeping its aspect ratio.
+// Smaller images are not scaled up. Transparent areas become white.
+func Resize(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(height*size/width, 1)
+		} else {
+			width, height = max(width*size/height, 1), size
+		}
+	}
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(thumb, thumb.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(thumb, thumb.Bounds(), img, bounds, xdraw.Over, nil)
+	return thumb
+}
+
+// Encode writes a thumbnail as a JPEG
+func Encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
+
+func (g *Generator) decodeImage(content io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if g.MaxPixels > 0 && config.Width*config.Height > g.MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// renderPDF renders the first page of a PDF with pdftoppm, large enough for the biggest thumbnail
+func (g *Generator) renderPDF(ctx context.Context, content io.Reader) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input.pdf")
+	file, err := os.Create(input)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if g.RenderTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.RenderTimeout)
+		defer cancel()
+	}
+	output := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, g.PDFRenderer, "-f", "1", "-l", "1", "-singlefile", "-png", "-scale-to", "1024", input, output)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("pdftoppm: %w: %s", err, bytes.TrimSpace(out))
+	}
+	page, err := os.Open(output + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+	return g.decodeImage(page)
+}
+
+// baseType returns a content type without its parameters
+func baseType(contentType string) string {
+	base, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(base))
+}
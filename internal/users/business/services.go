@@ -1,6 +1,10 @@
 package userbusiness
 
-import usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+import (
+	"time"
+
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+)
 
 func (s *UserService) CreateUser(email string, password string, salt []byte, name string) error {
 	return s.userStore.CreateUser(email, password, salt, name)
@@ -21,3 +25,167 @@ func (s *UserService) GetUser(id int) (usermodel.User, error) {
 func (s *UserService) GetUserByEmail(email string) (usermodel.User, error) {
 	return s.userStore.GetUserByEmail(email)
 }
+
+func (s *UserService) GetUserCredentials(id int) (usermodel.User, error) {
+	return s.userStore.GetUserCredentials(id)
+}
+
+func (s *UserService) SetEmailVerified(id int, email string) error {
+	return s.userStore.SetEmailVerified(id, email)
+}
+
+func (s *UserService) SetVerificationSent(id int, sentAt time.Time) error {
+	return s.userStore.SetVerificationSent(id, sentAt)
+}
+
+func (s *UserService) SetTOTPSecret(id int, secret string) error {
+	return s.userStore.SetTOTPSecret(id, secret)
+}
+
+func (s *UserService) EnableTOTP(id int, recoveryCodeHashes []string) error {
+	return s.userStore.EnableTOTP(id, recoveryCodeHashes)
+}
+
+func (s *UserService) DisableTOTP(id int) error {
+	return s.userStore.DisableTOTP(id)
+}
+
+func (s *UserService) UseTOTPStep(id int, step int64) error {
+	return s.userStore.UseTOTPStep(id, step)
+}
+
+func (s *UserService) ReplaceRecoveryCodes(id int, codeHashes []string) error {
+	return s.userStore.ReplaceRecoveryCodes(id, codeHashes)
+}
+
+func (s *UserService) UseRecoveryCode(id int, codeHash string) error {
+	return s.userStore.UseRecoveryCode(id, codeHash)
+}
+
+func (s *UserService) CreatePersonalAccessToken(userID int, name string, tokenHash string, scopes []string, expiresAt *time.Time) (int64, error) {
+	return s.userStore.CreatePersonalAccessToken(userID, name, tokenHash, scopes, expiresAt)
+}
+
+func (s *UserService) ListPersonalAccessTokens(userID int) ([]usermodel.PersonalAccessToken, error) {
+	return s.userStore.ListPersonalAccessTokens(userID)
+}
+
+func (s *UserService) GetPersonalAccessToken(tokenHash string) (usermodel.PersonalAccessToken, error) {
+	return s.userStore.GetPersonalAccessToken(tokenHash)
+}
+
+func (s *UserService) TouchPersonalAccessToken(id int) error {
+	return s.userStore.TouchPersonalAccessToken(id)
+}
+
+func (s *UserService) DeletePersonalAccessToken(id int, userID int) error {
+	return s.userStore.DeletePersonalAccessToken(id, userID)
+}
+
+func (s *UserService) CreateOIDCLogin(stateHash string, provider string, nonce string, codeVerifier string, linkUserID int, expiresAt time.Time) error {
+	return s.userStore.CreateOIDCLogin(stateHash, provider, nonce, codeVerifier, linkUserID, expiresAt)
+}
+
+func (s *UserService) ConsumeOIDCLogin(stateHash string) (usermodel.OIDCLogin, error) {
+	return s.userStore.ConsumeOIDCLogin(stateHash)
+}
+
+func (s *UserService) CreateIdentity(userID int, provider string, subject string, email string) error {
+	return s.userStore.CreateIdentity(userID, provider, subject, email)
+}
+
+func (s *UserService) GetIdentity(provider string, subject string) (usermodel.Identity, error) {
+	return s.userStore.GetIdentity(provider, subject)
+}
+
+func (s *UserService) ListIdentities(userID int) ([]usermodel.Identity, error) {
+	return s.userStore.ListIdentities(userID)
+}
+
+func (s *UserService) DeleteIdentity(id int, userID int) error {
+	return s.userStore.DeleteIdentity(id, userID)
+}
+
+func (s *UserService) CreateSession(userID int, userAgent string, ip string) (int64, error) {
+	return s.userStore.CreateSession(userID, userAgent, ip)
+}
+
+func (s *UserService) GetSession(id int) (usermodel.Session, error) {
+	return s.userStore.GetSession(id)
+}
+
+func (s *UserService) TouchSession(id int) error {
+	return s.userStore.TouchSession(id)
+}
+
+func (s *UserService) ListSessions(userID int) ([]usermodel.Session, error) {
+	return s.userStore.ListSessions(userID)
+}
+
+func (s *UserService) RevokeSession(id int, userID int) error {
+	return s.userStore.RevokeSession(id, userID)
+}
+
+func (s *UserService) RevokeOtherSessions(userID int, keepID int) error {
+	return s.userStore.RevokeOtherSessions(userID, keepID)
+}
+
+func (s *UserService) RecordLoginAttempt(email string, ip string, succeeded bool) error {
+	return s.userStore.RecordLoginAttempt(email, ip, succeeded)
+}
+
+func (s *UserService) ListRecentLoginAttempts(email string, ip string, since time.Time) ([]usermodel.LoginAttempt, error) {
+	return s.userStore.ListRecentLoginAttempts(email, ip, since)
+}
+
+func (s *UserService) ListFailedLogins(email string, ip string, limit int, offset int) ([]usermodel.LoginAttempt, error) {
+	return s.userStore.ListFailedLogins(email, ip, limit, offset)
+}
+
+func (s *UserService) ScheduleErasure(id int, at *time.Time) error {
+	return s.userStore.ScheduleErasure(id, at)
+}
+
+func (s *UserService) ListDueErasures(now time.Time) ([]int, error) {
+	return s.userStore.ListDueErasures(now)
+}
+
+func (s *UserService) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	return s.userStore.CreatePasswordReset(userID, tokenHash, expiresAt)
+}
+
+func (s *UserService) ConsumePasswordReset(tokenHash string) (int, error) {
+	return s.userStore.ConsumePasswordReset(tokenHash)
+}
+
+func (s *UserService) ListUsers(search string) ([]usermodel.User, error) {
+	return s.userStore.ListUsers(search)
+}
+
+func (s *UserService) UpdateUserRole(id int, role string) error {
+	return s.userStore.UpdateUserRole(id, role)
+}
+
+func (s *UserService) SetStorageQuota(id int, quota *int64) error {
+	return s.userStore.SetStorageQuota(id, quota)
+}
+
+func (s *UserService) SetFileVersionsKept(id int, kept *int) error {
+	return s.userStore.SetFileVersionsKept(id, kept)
+}
+
+func (s *UserService) SetUserDisabled(id int, disabled bool) error {
+	return s.userStore.SetUserDisabled(id, disabled)
+}
+
+func (s *UserService) SetUserLock(id int, until *time.Time) error {
+	return s.userStore.SetUserLock(id, until)
+}
+
+func (s *UserService) UpdatePassword(id int, password string, salt []byte) error {
+	return s.userStore.UpdatePassword(id, password, salt)
+}
+
+func (s *UserService) GetUserStats(id int) (usermodel.UserStats, error) {
+	return s.userStore.GetUserStats(id)
+}
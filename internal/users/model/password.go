@@ -0,0 +1,79 @@
+package usermodel
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2Params are the argon2id parameters passwords are hashed with
+type Argon2Params struct {
+	Memory     uint32 // Memory in KiB
+	Time       uint32 // Number of passes over the memory
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// LegacyArgon2Params are the parameters of hashes stored before they were encoded in PHC format
+var LegacyArgon2Params = Argon2Params{Memory: 64 * 1024, Time: 1, Threads: 4, SaltLength: 16, KeyLength: 32}
+
+// PasswordParams are the parameters new password hashes are created with.
+// Stored hashes with weaker parameters are replaced on the next login.
+var PasswordParams = LegacyArgon2Params
+
+var hashEncoding = base64.RawStdEncoding
+
+// encodeHash formats an argon2id hash in PHC string format,
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+func encodeHash(params Argon2Params, salt []byte, hash []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.Memory, params.Time, params.Threads, hashEncoding.EncodeToString(salt), hashEncoding.EncodeToString(hash))
+}
+
+// decodeHash parses a hash in PHC string format
+func decodeHash(encoded string) (params Argon2Params, salt []byte, hash []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		err = errors.New("password hash is not in argon2id PHC format")
+		return
+	}
+	var version int
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return
+	}
+	if version != argon2.Version {
+		err = fmt.Errorf("unsupported argon2 version %d", version)
+		return
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return
+	}
+	salt, err = hashEncoding.DecodeString(parts[4])
+	if err != nil {
+		return
+	}
+	hash, err = hashEncoding.DecodeString(parts[5])
+	if err != nil {
+		return
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(hash))
+	return
+}
+
+// IsEncodedHash reports whether a stored password is a hash in PHC string format
+func IsEncodedHash(password string) bool {
+	return strings.HasPrefix(password, "$argon2id$")
+}
+
+// EncodeLegacyHash converts a raw hash stored with its salt before hashes were
+// encoded in PHC format, so it can be checked like any other hash
+func EncodeLegacyHash(hash string, salt []byte) string {
+	return encodeHash(LegacyArgon2Params, salt, []byte(hash))
+}
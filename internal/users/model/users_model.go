@@ -2,6 +2,7 @@ package usermodel
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"errors"
 	"time"
 
@@ -10,37 +11,149 @@ import (
 )
 
 type User struct {
-	ID            int                            `json:"id"`
-	Email         string                         `json:"email" `
-	Password      string                         `json:"password" `
-	Salt          []byte                         `json:"salt"`
-	Name          string                         `json:"name"`
-	Role          string                         `json:"role"`
-	CreatedAt     time.Time                      `json:"createdAt"`
-	UpdatedAt     time.Time                      `json:"updatedAt"`
-	OwnedFiles    []learningmodels.LearningFiles `json:"ownedFiles"`
-	LearningGoals []learningmodels.LearningGoals `json:"learningGoals"`
-}
-
-// HashPassword takes a string as a parameter and encrypts it using argon2
+	ID                 int                            `json:"id"`
+	Email              string                         `json:"email" `
+	Password           string                         `json:"password" `
+	Salt               []byte                         `json:"salt"`
+	Name               string                         `json:"name"`
+	Role               string                         `json:"role"`
+	Disabled           bool                           `json:"disabled"`
+	LockedUntil        *time.Time                     `json:"lockedUntil"`
+	EmailVerified      bool                           `json:"emailVerified"`
+	VerificationSentAt *time.Time                     `json:"-"` // When a verification email was last sent
+	TOTPSecret         string                         `json:"-"`
+	TOTPEnabled        bool                           `json:"totpEnabled"`
+	EraseAfter         *time.Time                     `json:"eraseAfter"` // When the account is erased, if the user asked for it
+	CreatedAt          time.Time                      `json:"createdAt"`
+	UpdatedAt          time.Time                      `json:"updatedAt"`
+	OwnedFiles         []learningmodels.LearningFiles `json:"ownedFiles"`
+	LearningGoals      []learningmodels.LearningGoals `json:"learningGoals"`
+}
+
+// PasswordReset is a single-use token for resetting a forgotten password
+type PasswordReset struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// PersonalAccessToken is a long-lived token for scripts, only its hash is stored
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// IsExpired reports whether the token has expired
+func (token *PersonalAccessToken) IsExpired() bool {
+	return token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)
+}
+
+// Identity links a user to an account at an external identity provider
+type Identity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OIDCLogin is a login at an identity provider that has been started but not completed
+type OIDCLogin struct {
+	ID           int
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   int // User the identity is linked to, 0 for a login
+	ExpiresAt    time.Time
+}
+
+// Session is a login on a device, which its access and refresh tokens belong to
+type Session struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	Current    bool       `json:"current"` // Whether the session made the request
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+}
+
+// LoginAttempt is a password login, recorded to throttle guessing
+type LoginAttempt struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	Succeeded bool      `json:"succeeded"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserStats is the amount of content a user owns
+type UserStats struct {
+	UserID       int   `json:"userId"`
+	Goals        int   `json:"goals"`
+	Entries      int   `json:"entries"`
+	Files        int   `json:"files"`
+	StorageBytes int64 `json:"storageBytes"`
+}
+
+// IsLocked reports whether the account is currently locked
+func (user *User) IsLocked() bool {
+	return user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
+}
+
+// HashPassword takes a string as a parameter and encrypts it using argon2id with PasswordParams,
+// storing the hash in PHC string format
 func (user *User) HashPassword(password string) error {
+	params := PasswordParams
 	// Generate a Salt
-	salt := make([]byte, 16)
+	salt := make([]byte, params.SaltLength)
 	if _, err := rand.Read(salt); err != nil {
 		return err
 	}
 	// Generate Hash
-	hash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
-	user.Password = string(hash)
+	hash := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	user.Password = encodeHash(params, salt, hash)
 	user.Salt = salt
 	return nil
 }
 
 // CheckPassword takes a string as a parameter and compares it to the user's encrypted password
 func (user *User) CheckPassword(providedPassword string) error {
-	hash := argon2.IDKey([]byte(providedPassword), user.Salt, 1, 64*1024, 4, 32)
-	if user.Password != string(hash) {
+	encoded := user.Password
+	if !IsEncodedHash(encoded) {
+		encoded = EncodeLegacyHash(user.Password, user.Salt)
+	}
+	params, salt, hash, err := decodeHash(encoded)
+	if err != nil {
+		return err
+	}
+	provided := argon2.IDKey([]byte(providedPassword), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	if subtle.ConstantTimeCompare(hash, provided) != 1 {
 		return errors.New("wrong Password")
 	}
 	return nil
 }
+
+// NeedsRehash reports whether the password hash is weaker than one made with PasswordParams
+func (user *User) NeedsRehash() bool {
+	if !IsEncodedHash(user.Password) {
+		return true
+	}
+	params, _, _, err := decodeHash(user.Password)
+	if err != nil {
+		return true
+	}
+	return params.Memory < PasswordParams.Memory || params.Time < PasswordParams.Time ||
+		params.Threads < PasswordParams.Threads || params.SaltLength < PasswordParams.SaltLength ||
+		params.KeyLength < PasswordParams.KeyLength
+}
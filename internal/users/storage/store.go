@@ -2,6 +2,7 @@ package userstorage
 
 import (
 	"database/sql"
+	"time"
 
 	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
 	_ "github.com/mattn/go-sqlite3" // SQLi
@@ -17,6 +18,65 @@ type UserStore interface {
 	DeleteUser(id int) error
 	GetUser(id int) (usermodel.User, error)
 	GetUserByEmail(email string) (usermodel.User, error)
+	GetUserCredentials(id int) (usermodel.User, error)
+
+	// Email verification operations
+	SetEmailVerified(id int, email string) error
+	SetVerificationSent(id int, sentAt time.Time) error
+
+	// Two-factor authentication operations
+	SetTOTPSecret(id int, secret string) error
+	EnableTOTP(id int, recoveryCodeHashes []string) error
+	DisableTOTP(id int) error
+	UseTOTPStep(id int, step int64) error
+	ReplaceRecoveryCodes(id int, codeHashes []string) error
+	UseRecoveryCode(id int, codeHash string) error
+
+	// Personal access token operations
+	CreatePersonalAccessToken(userID int, name string, tokenHash string, scopes []string, expiresAt *time.Time) (int64, error)
+	ListPersonalAccessTokens(userID int) ([]usermodel.PersonalAccessToken, error)
+	GetPersonalAccessToken(tokenHash string) (usermodel.PersonalAccessToken, error)
+	TouchPersonalAccessToken(id int) error
+	DeletePersonalAccessToken(id int, userID int) error
+
+	// External identity operations
+	CreateOIDCLogin(stateHash string, provider string, nonce string, codeVerifier string, linkUserID int, expiresAt time.Time) error
+	ConsumeOIDCLogin(stateHash string) (usermodel.OIDCLogin, error)
+	CreateIdentity(userID int, provider string, subject string, email string) error
+	GetIdentity(provider string, subject string) (usermodel.Identity, error)
+	ListIdentities(userID int) ([]usermodel.Identity, error)
+	DeleteIdentity(id int, userID int) error
+
+	// Session operations
+	CreateSession(userID int, userAgent string, ip string) (int64, error)
+	GetSession(id int) (usermodel.Session, error)
+	TouchSession(id int) error
+	ListSessions(userID int) ([]usermodel.Session, error)
+	RevokeSession(id int, userID int) error
+	RevokeOtherSessions(userID int, keepID int) error
+
+	// Login throttling operations
+	RecordLoginAttempt(email string, ip string, succeeded bool) error
+	ListRecentLoginAttempts(email string, ip string, since time.Time) ([]usermodel.LoginAttempt, error)
+	ListFailedLogins(email string, ip string, limit int, offset int) ([]usermodel.LoginAttempt, error)
+
+	// Account erasure operations
+	ScheduleErasure(id int, at *time.Time) error
+	ListDueErasures(now time.Time) ([]int, error)
+
+	// Password reset operations
+	CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error
+	ConsumePasswordReset(tokenHash string) (int, error)
+
+	// Admin operations
+	ListUsers(search string) ([]usermodel.User, error)
+	UpdateUserRole(id int, role string) error
+	SetStorageQuota(id int, quota *int64) error
+	SetFileVersionsKept(id int, kept *int) error
+	SetUserDisabled(id int, disabled bool) error
+	SetUserLock(id int, until *time.Time) error
+	UpdatePassword(id int, password string, salt []byte) error
+	GetUserStats(id int) (usermodel.UserStats, error)
 }
 
 type userStore struct {
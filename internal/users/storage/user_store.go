@@ -1,6 +1,14 @@
 package userstorage
 
-import usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	learningstorage "github.com/khoaphungnguyen/learning-tracker/internal/learning/storage"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+)
 
 func (s *userStore) CreateTable() error {
 	// Create the users table
@@ -13,12 +21,78 @@ func (s *userStore) CreateTable() error {
 			name TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			role TEXT DEFAULT 'user'
+			role TEXT DEFAULT 'user',
+			disabled BOOLEAN DEFAULT 0,
+			locked_until DATETIME,
+			email_verified BOOLEAN DEFAULT 0,
+			verification_sent_at DATETIME,
+			totp_secret TEXT,
+			totp_enabled BOOLEAN DEFAULT 0,
+			totp_last_step INTEGER DEFAULT 0,
+			erase_after DATETIME,
+			storage_quota INTEGER,
+			file_versions_kept INTEGER
 		)
 	`)
 	if err != nil {
 		return err
 	}
+	// Columns added after the table was first created
+	_, err = s.addColumn("users", "disabled", "BOOLEAN DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("users", "locked_until", "DATETIME")
+	if err != nil {
+		return err
+	}
+	added, err := s.addColumn("users", "email_verified", "BOOLEAN DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	if added {
+		// Accounts created before email verification existed count as verified
+		_, err = s.DB.Exec(`UPDATE users SET email_verified=1`)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = s.addColumn("users", "verification_sent_at", "DATETIME")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("users", "totp_secret", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("users", "totp_enabled", "BOOLEAN DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("users", "totp_last_step", "INTEGER DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("users", "erase_after", "DATETIME")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("users", "storage_quota", "INTEGER")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("users", "file_versions_kept", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = s.encodeLegacyPasswords()
+	if err != nil {
+		return err
+	}
+	err = s.createEmailIndex()
+	if err != nil {
+		return err
+	}
 
 	// Create the learning_goals table
 	_, err = s.DB.Exec(`
@@ -64,7 +138,360 @@ func (s *userStore) CreateTable() error {
 			filetype TEXT,
 			filepath TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			sha256 TEXT,
+			goal_id INTEGER,
+			version INTEGER NOT NULL DEFAULT 1,
+			thumbnail_status TEXT NOT NULL DEFAULT 'pending',
+			text_status TEXT NOT NULL DEFAULT 'pending',
+			scan_status TEXT NOT NULL DEFAULT 'pending',
+			scan_signature TEXT,
+			scanned_at DATETIME,
+			FOREIGN KEY (entry_id) REFERENCES learning_entries(id),
+			FOREIGN KEY (goal_id) REFERENCES learning_goals(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	// File paths are keys in the blob store, which no longer include the uploads directory
+	_, err = s.DB.Exec(`UPDATE learning_files SET filepath=substr(filepath, 9) WHERE filepath LIKE 'uploads/%'`)
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("learning_files", "sha256", "TEXT")
+	if err != nil {
+		return err
+	}
+	added, err = s.addColumn("learning_files", "goal_id", "INTEGER")
+	if err != nil {
+		return err
+	}
+	if added {
+		_, err = s.DB.Exec(`
+			UPDATE learning_files SET goal_id=(SELECT goal_id FROM learning_entries WHERE learning_entries.id=learning_files.entry_id)
+		`)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create the attachment_blobs table, content-addressed blobs shared by a user's files
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS attachment_blobs (
+			blob_key TEXT NOT NULL PRIMARY KEY,
+			user_id INTEGER,
+			sha256 TEXT,
+			size INTEGER,
+			ref_count INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	// Keep the reference counts in step with every way a file row is added, moved or removed.
+	// Releasing a reference restarts the grace period before the blob is collected.
+	for _, trigger := range []string{`
+		CREATE TRIGGER IF NOT EXISTS learning_files_blob_insert AFTER INSERT ON learning_files BEGIN
+			UPDATE attachment_blobs SET ref_count=ref_count+1 WHERE blob_key=NEW.filepath;
+		END
+	`, `
+		CREATE TRIGGER IF NOT EXISTS learning_files_blob_update AFTER UPDATE OF filepath ON learning_files
+		WHEN OLD.filepath IS NOT NEW.filepath BEGIN
+			UPDATE attachment_blobs SET ref_count=ref_count-1, updated_at=CURRENT_TIMESTAMP WHERE blob_key=OLD.filepath;
+			UPDATE attachment_blobs SET ref_count=ref_count+1 WHERE blob_key=NEW.filepath;
+		END
+	`, `
+		CREATE TRIGGER IF NOT EXISTS learning_files_blob_delete AFTER DELETE ON learning_files BEGIN
+			UPDATE attachment_blobs SET ref_count=ref_count-1, updated_at=CURRENT_TIMESTAMP WHERE blob_key=OLD.filepath;
+		END
+	`} {
+		_, err = s.DB.Exec(trigger)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.addColumn("learning_files", "version", "INTEGER NOT NULL DEFAULT 1")
+	if err != nil {
+		return err
+	}
+	// Create the learning_file_versions table, every version of a file including the current one
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS learning_file_versions (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			file_id INTEGER,
+			user_id INTEGER,
+			version INTEGER,
+			filename TEXT,
+			filesize INTEGER,
+			filetype TEXT,
+			filepath TEXT,
+			sha256 TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			scan_status TEXT NOT NULL DEFAULT 'skipped',
+			scan_signature TEXT,
+			UNIQUE (file_id, version),
+			FOREIGN KEY (file_id) REFERENCES learning_files(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	// Versions hold references to blobs like files do
+	for _, trigger := range []string{`
+		CREATE TRIGGER IF NOT EXISTS learning_file_versions_blob_insert AFTER INSERT ON learning_file_versions BEGIN
+			UPDATE attachment_blobs SET ref_count=ref_count+1 WHERE blob_key=NEW.filepath;
+		END
+	`, `
+		CREATE TRIGGER IF NOT EXISTS learning_file_versions_blob_update AFTER UPDATE OF filepath ON learning_file_versions
+		WHEN OLD.filepath IS NOT NEW.filepath BEGIN
+			UPDATE attachment_blobs SET ref_count=ref_count-1, updated_at=CURRENT_TIMESTAMP WHERE blob_key=OLD.filepath;
+			UPDATE attachment_blobs SET ref_count=ref_count+1 WHERE blob_key=NEW.filepath;
+		END
+	`, `
+		CREATE TRIGGER IF NOT EXISTS learning_file_versions_blob_delete AFTER DELETE ON learning_file_versions BEGIN
+			UPDATE attachment_blobs SET ref_count=ref_count-1, updated_at=CURRENT_TIMESTAMP WHERE blob_key=OLD.filepath;
+		END
+	`} {
+		_, err = s.DB.Exec(trigger)
+		if err != nil {
+			return err
+		}
+	}
+	// Existing files are queued for thumbnails like new ones
+	_, err = s.addColumn("learning_files", "thumbnail_status", "TEXT NOT NULL DEFAULT 'pending'")
+	if err != nil {
+		return err
+	}
+	// Create the file_thumbnails table, thumbnails of a blob at each size kept as blobs themselves
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS file_thumbnails (
+			source_key TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			blob_key TEXT,
+			user_id INTEGER,
+			width INTEGER,
+			height INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (source_key, size),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	// Existing files are queued for text extraction like new ones
+	_, err = s.addColumn("learning_files", "text_status", "TEXT NOT NULL DEFAULT 'pending'")
+	if err != nil {
+		return err
+	}
+	// Create the file_texts table, the text extracted from the current content of each file
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS file_texts (
+			file_id INTEGER NOT NULL PRIMARY KEY,
+			user_id INTEGER,
+			source_key TEXT,
+			extractor TEXT,
+			content TEXT,
+			truncated BOOLEAN DEFAULT 0,
+			extracted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (file_id) REFERENCES learning_files(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	// Files are scanned for malware before they can be downloaded, existing ones included
+	_, err = s.addColumn("learning_files", "scan_status", "TEXT NOT NULL DEFAULT 'pending'")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("learning_files", "scan_signature", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("learning_files", "scanned_at", "DATETIME")
+	if err != nil {
+		return err
+	}
+	// Versions recorded before scanning are marked skipped, new ones take the status of their file
+	_, err = s.addColumn("learning_file_versions", "scan_status", "TEXT NOT NULL DEFAULT 'skipped'")
+	if err != nil {
+		return err
+	}
+	_, err = s.addColumn("learning_file_versions", "scan_signature", "TEXT")
+	if err != nil {
+		return err
+	}
+	// Create the file_links table, signed download links to a file shared with people without an account
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS file_links (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			file_id INTEGER,
+			user_id INTEGER,
+			single_use BOOLEAN DEFAULT 0,
+			downloads INTEGER NOT NULL DEFAULT 0,
+			last_downloaded_at DATETIME,
+			expires_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (file_id) REFERENCES learning_files(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	// Files uploaded before versions were kept start with their current content as the first version
+	_, err = s.DB.Exec(`
+		INSERT INTO learning_file_versions (file_id, user_id, version, filename, filesize, filetype, filepath, sha256, created_at)
+		SELECT id, user_id, version, filename, filesize, filetype, filepath, sha256, created_at FROM learning_files
+		WHERE id NOT IN (SELECT file_id FROM learning_file_versions)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create the password_resets table
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS password_resets (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			token_hash TEXT UNIQUE,
+			expires_at DATETIME,
+			used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create the mfa_recovery_codes table
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			code_hash TEXT,
+			used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create the personal_access_tokens table
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS personal_access_tokens (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			name TEXT,
+			token_hash TEXT UNIQUE,
+			scopes TEXT,
+			expires_at DATETIME,
+			last_used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create the user_identities table
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			provider TEXT,
+			subject TEXT,
+			email TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (provider, subject),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create the oidc_logins table
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS oidc_logins (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			state_hash TEXT UNIQUE,
+			provider TEXT,
+			nonce TEXT,
+			code_verifier TEXT,
+			link_user_id INTEGER DEFAULT 0,
+			expires_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create the login_attempts table
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS login_attempts (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			email TEXT,
+			ip TEXT,
+			succeeded BOOLEAN DEFAULT 0,
+			created_at DATETIME
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(`CREATE INDEX IF NOT EXISTS login_attempts_email ON login_attempts (email, created_at)`)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(`CREATE INDEX IF NOT EXISTS login_attempts_ip ON login_attempts (ip, created_at)`)
+	if err != nil {
+		return err
+	}
+
+	// Create the uploads table, resumable uploads not yet complete
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS uploads (
+			id TEXT NOT NULL PRIMARY KEY,
+			user_id INTEGER,
+			entry_id INTEGER,
+			goal_id INTEGER,
+			filename TEXT,
+			length INTEGER,
+			upload_offset INTEGER NOT NULL DEFAULT 0,
+			expires_at DATETIME,
+			created_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id),
 			FOREIGN KEY (entry_id) REFERENCES learning_entries(id),
+			FOREIGN KEY (goal_id) REFERENCES learning_goals(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create the sessions table
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			user_agent TEXT,
+			ip TEXT,
+			revoked_at DATETIME,
+			created_at DATETIME,
+			last_seen_at DATETIME,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)
 	`)
@@ -75,6 +502,78 @@ func (s *userStore) CreateTable() error {
 	return nil
 }
 
+// addColumn adds a column to an existing table, doing nothing if it is already there.
+// It reports whether the column was added.
+func (s *userStore) addColumn(table string, column string, definition string) (bool, error) {
+	_, err := s.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate column name") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// encodeLegacyPasswords converts password hashes stored as raw bytes next to their salt
+// into PHC string format, which carries the salt and parameters along with the hash
+func (s *userStore) encodeLegacyPasswords() error {
+	rows, err := s.DB.Query(`
+		SELECT id, password, salt FROM users WHERE password IS NOT NULL AND password NOT LIKE '$argon2id$%'
+	`)
+	if err != nil {
+		return err
+	}
+	var users []usermodel.User
+	for rows.Next() {
+		var user usermodel.User
+		err = rows.Scan(&user.ID, &user.Password, &user.Salt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+
+	for _, user := range users {
+		_, err = s.DB.Exec(`
+			UPDATE users SET password=? WHERE id=?
+		`, usermodel.EncodeLegacyHash(user.Password, user.Salt), user.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createEmailIndex makes emails unique ignoring case, as logins match them ignoring case.
+// Accounts created before it whose emails only differ in case have to be merged or renamed first.
+func (s *userStore) createEmailIndex() error {
+	rows, err := s.DB.Query(`
+		SELECT lower(email) FROM users WHERE email IS NOT NULL GROUP BY lower(email) HAVING COUNT(*) > 1
+	`)
+	if err != nil {
+		return err
+	}
+	var duplicates []string
+	for rows.Next() {
+		var email string
+		err = rows.Scan(&email)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		duplicates = append(duplicates, email)
+	}
+	rows.Close()
+	if len(duplicates) > 0 {
+		return fmt.Errorf("several users have each of these emails in different cases, rename them: %s", strings.Join(duplicates, ", "))
+	}
+	_, err = s.DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower ON users (lower(email))`)
+	return err
+}
+
 // User CRUD Methods
 // CreateUser create a user's details in the database
 func (s *userStore) CreateUser(email string, password string, salt []byte, name string) error {
@@ -92,32 +591,49 @@ func (s *userStore) CreateUser(email string, password string, salt []byte, name
 func (s *userStore) GetUser(id int) (usermodel.User, error) {
 	var user usermodel.User
 	err := s.DB.QueryRow(`
-		SELECT id, email, name, created_at, updated_at, role FROM users WHERE id=?
-	`, id).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt, &user.Role)
+		SELECT id, email, name, created_at, updated_at, role, disabled, locked_until, email_verified,
+			COALESCE(totp_secret, ''), totp_enabled, erase_after FROM users WHERE id=?
+	`, id).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt, &user.Role, &user.Disabled, &user.LockedUntil, &user.EmailVerified,
+		&user.TOTPSecret, &user.TOTPEnabled, &user.EraseAfter)
+
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
 
+// GetUserCredentials return a user's password hash and salt
+func (s *userStore) GetUserCredentials(id int) (usermodel.User, error) {
+	var user usermodel.User
+	err := s.DB.QueryRow(`
+		SELECT id, email, password, salt FROM users WHERE id=?
+	`, id).Scan(&user.ID, &user.Email, &user.Password, &user.Salt)
 	if err != nil {
 		return user, err
 	}
 	return user, nil
 }
 
-// GetUserByUserName return a user's details in the database
+// GetUserByEmail return a user's details in the database, the email is matched ignoring case
 func (s *userStore) GetUserByEmail(email string) (usermodel.User, error) {
 	var user usermodel.User
 	err := s.DB.QueryRow(`
-		SELECT id, password, salt FROM users WHERE email=?
-	`, email).Scan(&user.ID, &user.Password, &user.Salt)
+		SELECT id, email, password, salt, role, disabled, locked_until, email_verified, verification_sent_at,
+			totp_enabled FROM users WHERE lower(email)=lower(?) ORDER BY id
+	`, strings.TrimSpace(email)).Scan(&user.ID, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Disabled, &user.LockedUntil, &user.EmailVerified, &user.VerificationSentAt,
+		&user.TOTPEnabled)
 	if err != nil {
 		return user, err
 	}
 	return user, nil
 }
 
-// UpdateUser updates a user's details in the database
+// UpdateUser updates a user's details in the database.
+// Changing the email marks it as unverified again.
 func (s *userStore) UpdateUser(id int, email string, name string) error {
 	_, err := s.DB.Exec(`
-		UPDATE users SET email=?, name=?, updated_at=current_timestamp  WHERE id=?
-	`, email, name, id)
+		UPDATE users SET email_verified=(email_verified AND lower(email)=lower(?)), email=?, name=?, updated_at=current_timestamp WHERE id=?
+	`, email, email, name, id)
 
 	if err != nil {
 		return err
@@ -125,13 +641,731 @@ func (s *userStore) UpdateUser(id int, email string, name string) error {
 	return nil
 }
 
-// DeleteUser deletes a user by ID from the database
+// DeleteUser deletes a user by ID from the database, along with their tokens, sessions,
+// identities and login attempts. Content is deleted by the learning store.
 func (s *userStore) DeleteUser(id int) error {
-	_, err := s.DB.Exec(`
-		DELETE FROM users WHERE id=?;
-	`, id)
+	tx, err := s.DB.Begin()
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	var email string
+	err = tx.QueryRow(`
+		SELECT email FROM users WHERE id=?
+	`, id).Scan(&email)
+	if err != nil {
+		return err
+	}
+	// Everything the users domain keeps about the user goes with it
+	for _, query := range []string{
+		`DELETE FROM password_resets WHERE user_id=?`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id=?`,
+		`DELETE FROM personal_access_tokens WHERE user_id=?`,
+		`DELETE FROM user_identities WHERE user_id=?`,
+		`DELETE FROM oidc_logins WHERE link_user_id=?`,
+		`DELETE FROM sessions WHERE user_id=?`,
+		`DELETE FROM users WHERE id=?`,
+	} {
+		_, err = tx.Exec(query, id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		DELETE FROM login_attempts WHERE email=?
+	`, strings.ToLower(email))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListUsers returns the users whose email or name contains search, or all users if search is empty
+func (s *userStore) ListUsers(search string) ([]usermodel.User, error) {
+	var users []usermodel.User
+	pattern := "%" + search + "%"
+	rows, err := s.DB.Query(`
+		SELECT id, email, name, created_at, updated_at, role, disabled, locked_until, email_verified FROM users
+		WHERE email LIKE ? OR name LIKE ? ORDER BY id
+	`, pattern, pattern)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user usermodel.User
+		err = rows.Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt, &user.Role, &user.Disabled, &user.LockedUntil, &user.EmailVerified)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// UpdateUserRole changes the role of a user
+func (s *userStore) UpdateUserRole(id int, role string) error {
+	_, err := s.DB.Exec(`
+		UPDATE users SET role=?, updated_at=current_timestamp WHERE id=?
+	`, role, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetFileVersionsKept sets how many versions of each file a user keeps, nil for the default
+func (s *userStore) SetFileVersionsKept(id int, kept *int) error {
+	result, err := s.DB.Exec(`
+		UPDATE users SET file_versions_kept=?, updated_at=current_timestamp WHERE id=?
+	`, kept, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetStorageQuota sets the storage quota of a user in bytes, nil for the default of their role
+func (s *userStore) SetStorageQuota(id int, quota *int64) error {
+	result, err := s.DB.Exec(`
+		UPDATE users SET storage_quota=?, updated_at=current_timestamp WHERE id=?
+	`, quota, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetUserDisabled disables or re-enables a user account
+func (s *userStore) SetUserDisabled(id int, disabled bool) error {
+	_, err := s.DB.Exec(`
+		UPDATE users SET disabled=?, updated_at=current_timestamp WHERE id=?
+	`, disabled, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetUserLock locks a user account until the given time, or unlocks it if until is nil
+func (s *userStore) SetUserLock(id int, until *time.Time) error {
+	_, err := s.DB.Exec(`
+		UPDATE users SET locked_until=?, updated_at=current_timestamp WHERE id=?
+	`, until, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdatePassword replaces the password hash and salt of a user
+func (s *userStore) UpdatePassword(id int, password string, salt []byte) error {
+	_, err := s.DB.Exec(`
+		UPDATE users SET password=?, salt=?, updated_at=current_timestamp WHERE id=?
+	`, password, salt, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetUserStats returns how much content a user owns. The storage is counted like the user's
+// own storage usage, versions included.
+func (s *userStore) GetUserStats(id int) (usermodel.UserStats, error) {
+	stats := usermodel.UserStats{UserID: id}
+	err := s.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM learning_goals WHERE user_id=?1),
+			(SELECT COUNT(*) FROM learning_entries WHERE user_id=?1),
+			(SELECT COUNT(*) FROM learning_files WHERE user_id=?1),
+			(`+learningstorage.StorageUsedQuery+`)
+	`, id).Scan(&stats.Goals, &stats.Entries, &stats.Files, &stats.StorageBytes)
+	if err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// CreatePasswordReset stores the hash of a password reset token
+func (s *userStore) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (?, ?, ?)
+	`, userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConsumePasswordReset marks the reset token with the given hash as used, along with
+// every other outstanding token of its user, and returns the user ID.
+// sql.ErrNoRows is returned if the token does not exist, is expired or was already used.
+func (s *userStore) ConsumePasswordReset(tokenHash string) (int, error) {
+	var reset usermodel.PasswordReset
+	err := s.DB.QueryRow(`
+		SELECT id, user_id, expires_at, used_at FROM password_resets WHERE token_hash=?
+	`, tokenHash).Scan(&reset.ID, &reset.UserID, &reset.ExpiresAt, &reset.UsedAt)
+	if err != nil {
+		return 0, err
+	}
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return 0, sql.ErrNoRows
+	}
+	result, err := s.DB.Exec(`
+		UPDATE password_resets SET used_at=current_timestamp WHERE user_id=? AND used_at IS NULL
+	`, reset.UserID)
+	if err != nil {
+		return 0, err
+	}
+	// Another request consumed the token in the meantime
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, sql.ErrNoRows
+	}
+	return reset.UserID, nil
+}
+
+// SetEmailVerified marks the email of a user as verified, provided it has not changed since
+// the verification was requested. sql.ErrNoRows is returned if it has.
+func (s *userStore) SetEmailVerified(id int, email string) error {
+	result, err := s.DB.Exec(`
+		UPDATE users SET email_verified=1, updated_at=current_timestamp WHERE id=? AND lower(email)=lower(?)
+	`, id, email)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetVerificationSent records when a verification email was last sent to a user
+func (s *userStore) SetVerificationSent(id int, sentAt time.Time) error {
+	_, err := s.DB.Exec(`
+		UPDATE users SET verification_sent_at=? WHERE id=?
+	`, sentAt, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetTOTPSecret stores a new TOTP secret for a user, not enabled until EnableTOTP
+func (s *userStore) SetTOTPSecret(id int, secret string) error {
+	_, err := s.DB.Exec(`
+		UPDATE users SET totp_secret=?, totp_enabled=0, totp_last_step=0 WHERE id=?
+	`, secret, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication and replaces the user's recovery codes
+func (s *userStore) EnableTOTP(id int, recoveryCodeHashes []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_enabled=1, updated_at=current_timestamp WHERE id=?
+	`, id)
+	if err != nil {
+		return err
+	}
+	err = replaceRecoveryCodes(tx, id, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication and removes the secret and recovery codes
+func (s *userStore) DisableTOTP(id int) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_secret=NULL, totp_enabled=0, totp_last_step=0, updated_at=current_timestamp WHERE id=?
+	`, id)
+	if err != nil {
+		return err
+	}
+	err = replaceRecoveryCodes(tx, id, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of an accepted TOTP code.
+// sql.ErrNoRows is returned if a code of the same or a later step was already used.
+func (s *userStore) UseTOTPStep(id int, step int64) error {
+	result, err := s.DB.Exec(`
+		UPDATE users SET totp_last_step=? WHERE id=? AND totp_last_step < ?
+	`, step, id, step)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of a user
+func (s *userStore) ReplaceRecoveryCodes(id int, codeHashes []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(tx, id, codeHashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks a recovery code as used.
+// sql.ErrNoRows is returned if the user has no unused code with that hash.
+func (s *userStore) UseRecoveryCode(id int, codeHash string) error {
+	result, err := s.DB.Exec(`
+		UPDATE mfa_recovery_codes SET used_at=current_timestamp WHERE user_id=? AND code_hash=? AND used_at IS NULL
+	`, id, codeHash)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, id int, codeHashes []string) error {
+	_, err := tx.Exec(`
+		DELETE FROM mfa_recovery_codes WHERE user_id=?
+	`, id)
+	if err != nil {
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(`
+			INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)
+		`, id, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatePersonalAccessToken stores the hash of a new personal access token and returns its ID
+func (s *userStore) CreatePersonalAccessToken(userID int, name string, tokenHash string, scopes []string, expiresAt *time.Time) (int64, error) {
+	result, err := s.DB.Exec(`
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?)
+	`, userID, name, tokenHash, strings.Join(scopes, ","), expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	newID, _ := result.LastInsertId()
+	return newID, nil
+}
+
+// ListPersonalAccessTokens returns the personal access tokens of a user
+func (s *userStore) ListPersonalAccessTokens(userID int) ([]usermodel.PersonalAccessToken, error) {
+	var tokens []usermodel.PersonalAccessToken
+	rows, err := s.DB.Query(`
+		SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at FROM personal_access_tokens
+		WHERE user_id=? ORDER BY id
+	`, userID)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token usermodel.PersonalAccessToken
+		var scopes string
+		err = rows.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+		if err != nil {
+			return tokens, err
+		}
+		token.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// GetPersonalAccessToken returns the personal access token with the given hash
+func (s *userStore) GetPersonalAccessToken(tokenHash string) (usermodel.PersonalAccessToken, error) {
+	var token usermodel.PersonalAccessToken
+	var scopes string
+	err := s.DB.QueryRow(`
+		SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at FROM personal_access_tokens
+		WHERE token_hash=?
+	`, tokenHash).Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+	if err != nil {
+		return token, err
+	}
+	token.Scopes = strings.Split(scopes, ",")
+	return token, nil
+}
+
+// TouchPersonalAccessToken records that a personal access token was just used
+func (s *userStore) TouchPersonalAccessToken(id int) error {
+	_, err := s.DB.Exec(`
+		UPDATE personal_access_tokens SET last_used_at=current_timestamp WHERE id=?
+	`, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeletePersonalAccessToken revokes a personal access token of a user.
+// sql.ErrNoRows is returned if the user has no token with that ID.
+func (s *userStore) DeletePersonalAccessToken(id int, userID int) error {
+	result, err := s.DB.Exec(`
+		DELETE FROM personal_access_tokens WHERE id=? AND user_id=?
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateOIDCLogin stores a login started at an identity provider under the hash of its state
+func (s *userStore) CreateOIDCLogin(stateHash string, provider string, nonce string, codeVerifier string, linkUserID int, expiresAt time.Time) error {
+	// Logins that were never completed are not needed anymore
+	_, err := s.DB.Exec(`
+		DELETE FROM oidc_logins WHERE expires_at < ?
+	`, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(`
+		INSERT INTO oidc_logins (state_hash, provider, nonce, code_verifier, link_user_id, expires_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, stateHash, provider, nonce, codeVerifier, linkUserID, expiresAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConsumeOIDCLogin removes and returns the login with the given state hash.
+// sql.ErrNoRows is returned if it does not exist, is expired or was already consumed.
+func (s *userStore) ConsumeOIDCLogin(stateHash string) (usermodel.OIDCLogin, error) {
+	var login usermodel.OIDCLogin
+	err := s.DB.QueryRow(`
+		SELECT id, provider, nonce, code_verifier, link_user_id, expires_at FROM oidc_logins WHERE state_hash=?
+	`, stateHash).Scan(&login.ID, &login.Provider, &login.Nonce, &login.CodeVerifier, &login.LinkUserID, &login.ExpiresAt)
+	if err != nil {
+		return login, err
+	}
+	result, err := s.DB.Exec(`
+		DELETE FROM oidc_logins WHERE id=?
+	`, login.ID)
+	if err != nil {
+		return login, err
+	}
+	// Another request consumed the login in the meantime
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return login, err
+	}
+	if affected == 0 || time.Now().After(login.ExpiresAt) {
+		return login, sql.ErrNoRows
+	}
+	return login, nil
+}
+
+// CreateIdentity links an account at an identity provider to a user
+func (s *userStore) CreateIdentity(userID int, provider string, subject string, email string) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email) VALUES (?, ?, ?, ?)
+	`, userID, provider, subject, email)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetIdentity returns the identity of the given account at an identity provider
+func (s *userStore) GetIdentity(provider string, subject string) (usermodel.Identity, error) {
+	var identity usermodel.Identity
+	err := s.DB.QueryRow(`
+		SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE provider=? AND subject=?
+	`, provider, subject).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		return identity, err
+	}
+	return identity, nil
+}
+
+// ListIdentities returns the identities linked to a user
+func (s *userStore) ListIdentities(userID int) ([]usermodel.Identity, error) {
+	var identities []usermodel.Identity
+	rows, err := s.DB.Query(`
+		SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE user_id=? ORDER BY id
+	`, userID)
+	if err != nil {
+		return identities, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var identity usermodel.Identity
+		err = rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return identities, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, nil
+}
+
+// DeleteIdentity unlinks an identity from a user.
+// sql.ErrNoRows is returned if the user has no identity with that ID.
+func (s *userStore) DeleteIdentity(id int, userID int) error {
+	result, err := s.DB.Exec(`
+		DELETE FROM user_identities WHERE id=? AND user_id=?
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordLoginAttempt stores the outcome of a password login
+func (s *userStore) RecordLoginAttempt(email string, ip string, succeeded bool) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO login_attempts (email, ip, succeeded, created_at) VALUES (?, ?, ?, ?)
+	`, email, ip, succeeded, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListRecentLoginAttempts returns the login attempts for an email or from an IP since the given time, oldest first
+func (s *userStore) ListRecentLoginAttempts(email string, ip string, since time.Time) ([]usermodel.LoginAttempt, error) {
+	var attempts []usermodel.LoginAttempt
+	rows, err := s.DB.Query(`
+		SELECT id, email, ip, succeeded, created_at FROM login_attempts
+		WHERE (email=? OR ip=?) AND created_at > ? ORDER BY id
+	`, email, ip, since.UTC())
+	if err != nil {
+		return attempts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attempt usermodel.LoginAttempt
+		err = rows.Scan(&attempt.ID, &attempt.Email, &attempt.IP, &attempt.Succeeded, &attempt.CreatedAt)
+		if err != nil {
+			return attempts, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
+
+// ListFailedLogins returns failed login attempts, newest first, filtered by email and IP if they are not empty
+func (s *userStore) ListFailedLogins(email string, ip string, limit int, offset int) ([]usermodel.LoginAttempt, error) {
+	attempts := []usermodel.LoginAttempt{}
+	rows, err := s.DB.Query(`
+		SELECT id, email, ip, succeeded, created_at FROM login_attempts
+		WHERE succeeded=0 AND (?='' OR email=?) AND (?='' OR ip=?) ORDER BY id DESC LIMIT ? OFFSET ?
+	`, email, email, ip, ip, limit, offset)
+	if err != nil {
+		return attempts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attempt usermodel.LoginAttempt
+		err = rows.Scan(&attempt.ID, &attempt.Email, &attempt.IP, &attempt.Succeeded, &attempt.CreatedAt)
+		if err != nil {
+			return attempts, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
+
+// CreateSession stores a new session of a user and returns its ID
+func (s *userStore) CreateSession(userID int, userAgent string, ip string) (int64, error) {
+	now := time.Now().UTC()
+	result, err := s.DB.Exec(`
+		INSERT INTO sessions (user_id, user_agent, ip, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?)
+	`, userID, userAgent, ip, now, now)
+	if err != nil {
+		return 0, err
+	}
+	newID, _ := result.LastInsertId()
+	return newID, nil
+}
+
+// GetSession returns the session with the given ID, revoked or not
+func (s *userStore) GetSession(id int) (usermodel.Session, error) {
+	var session usermodel.Session
+	err := s.DB.QueryRow(`
+		SELECT id, user_id, user_agent, ip, revoked_at, created_at, last_seen_at FROM sessions WHERE id=?
+	`, id).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.RevokedAt, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return session, err
+	}
+	return session, nil
+}
+
+// TouchSession records that a session was just used.
+// It is only written once a minute to spare the database a write on every request.
+func (s *userStore) TouchSession(id int) error {
+	now := time.Now().UTC()
+	_, err := s.DB.Exec(`
+		UPDATE sessions SET last_seen_at=? WHERE id=? AND last_seen_at < ?
+	`, now, id, now.Add(-time.Minute))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListSessions returns the sessions of a user that have not been revoked, most recently used first
+func (s *userStore) ListSessions(userID int) ([]usermodel.Session, error) {
+	sessions := []usermodel.Session{}
+	rows, err := s.DB.Query(`
+		SELECT id, user_id, user_agent, ip, revoked_at, created_at, last_seen_at FROM sessions
+		WHERE user_id=? AND revoked_at IS NULL ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session usermodel.Session
+		err = rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.RevokedAt, &session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes a session of a user.
+// sql.ErrNoRows is returned if the user has no active session with that ID.
+func (s *userStore) RevokeSession(id int, userID int) error {
+	result, err := s.DB.Exec(`
+		UPDATE sessions SET revoked_at=? WHERE id=? AND user_id=? AND revoked_at IS NULL
+	`, time.Now().UTC(), id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of a user except keepID, or all of them if keepID is 0
+func (s *userStore) RevokeOtherSessions(userID int, keepID int) error {
+	_, err := s.DB.Exec(`
+		UPDATE sessions SET revoked_at=? WHERE user_id=? AND id!=? AND revoked_at IS NULL
+	`, time.Now().UTC(), userID, keepID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ScheduleErasure sets when a user's account is erased, or cancels the erasure if at is nil
+func (s *userStore) ScheduleErasure(id int, at *time.Time) error {
+	_, err := s.DB.Exec(`
+		UPDATE users SET erase_after=?, updated_at=current_timestamp WHERE id=?
+	`, at, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListDueErasures returns the IDs of users whose erasure is due at the given time
+func (s *userStore) ListDueErasures(now time.Time) ([]int, error) {
+	var ids []int
+	rows, err := s.DB.Query(`
+		SELECT id FROM users WHERE erase_after IS NOT NULL AND erase_after <= ?
+	`, now)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
 }
@@ -0,0 +1,377 @@
+package usertransport
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+)
+
+// lockedForever is stored as the lock expiry of accounts locked until an admin unlocks them
+var lockedForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// RolePayload change role body
+type RolePayload struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// DisabledPayload disable account body
+type DisabledPayload struct {
+	Disabled *bool `json:"disabled" binding:"required"`
+}
+
+// StorageQuotaPayload storage quota body
+type StorageQuotaPayload struct {
+	QuotaMB *int64 `json:"quotaMB"` // Quota in MiB, 0 for unlimited, null for the default of the user's role
+}
+
+// FileVersionsPayload file versions kept body
+type FileVersionsPayload struct {
+	Versions *int `json:"versions"` // Versions kept of each file, null for the default
+}
+
+// LockPayload lock account body
+type LockPayload struct {
+	Minutes int `json:"minutes"` // How long the account stays locked, 0 locks it until unlocked
+}
+
+// ListUsers returns all users, filtered by the q query parameter if given
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	users, err := h.userHandler.ListUsers(c.Query("q"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Listing Users",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, users)
+}
+
+// UpdateUserRole changes the role of a user and logs them out everywhere
+func (h *UserHandler) UpdateUserRole(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	var payload RolePayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil || !auth.ValidRole(payload.Role) {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Role",
+		})
+		c.Abort()
+		return
+	}
+	c.Set("auditDetails", "role="+payload.Role)
+	err = h.userHandler.UpdateUserRole(userID, payload.Role)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Updating Role",
+		})
+		c.Abort()
+		return
+	}
+	// Tokens carry the role, so the user logs in again to get one with the new role
+	if !h.logOutUser(c, userID) {
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Update",
+	})
+}
+
+// SetStorageQuota sets the storage quota of a user, or restores the default of their role
+func (h *UserHandler) SetStorageQuota(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	var payload StorageQuotaPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil || (payload.QuotaMB != nil && (*payload.QuotaMB < 0 || *payload.QuotaMB > 1<<40)) {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Quota",
+		})
+		c.Abort()
+		return
+	}
+	var quota *int64
+	if payload.QuotaMB != nil {
+		bytes := *payload.QuotaMB << 20
+		quota = &bytes
+		c.Set("auditDetails", "quotaMB="+strconv.FormatInt(*payload.QuotaMB, 10))
+	} else {
+		c.Set("auditDetails", "quotaMB=default")
+	}
+	err = h.userHandler.SetStorageQuota(userID, quota)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Updating Quota",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Update",
+	})
+}
+
+// SetFileVersionsKept sets how many versions of each file a user keeps, or restores the default
+func (h *UserHandler) SetFileVersionsKept(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	var payload FileVersionsPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil || (payload.Versions != nil && (*payload.Versions < 1 || *payload.Versions > 1000)) {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Versions",
+		})
+		c.Abort()
+		return
+	}
+	if payload.Versions != nil {
+		c.Set("auditDetails", "versions="+strconv.Itoa(*payload.Versions))
+	} else {
+		c.Set("auditDetails", "versions=default")
+	}
+	err = h.userHandler.SetFileVersionsKept(userID, payload.Versions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Updating Versions",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Update",
+	})
+}
+
+// SetUserDisabled disables or re-enables a user account, a disabled user is logged out everywhere
+func (h *UserHandler) SetUserDisabled(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	var payload DisabledPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	c.Set("auditDetails", "disabled="+strconv.FormatBool(*payload.Disabled))
+	err = h.userHandler.SetUserDisabled(userID, *payload.Disabled)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Updating User",
+		})
+		c.Abort()
+		return
+	}
+	if *payload.Disabled && !h.logOutUser(c, userID) {
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Update",
+	})
+}
+
+// LockUser locks a user account for a number of minutes or indefinitely and logs the user out everywhere
+func (h *UserHandler) LockUser(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	var payload LockPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil || payload.Minutes < 0 {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	until := lockedForever
+	if payload.Minutes > 0 {
+		until = time.Now().Add(time.Minute * time.Duration(payload.Minutes))
+	}
+	c.Set("auditDetails", "lockedUntil="+until.Format(time.RFC3339))
+	err = h.userHandler.SetUserLock(userID, &until)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Locking User",
+		})
+		c.Abort()
+		return
+	}
+	if !h.logOutUser(c, userID) {
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message":     "Successful Lock",
+		"lockedUntil": until,
+	})
+}
+
+// UnlockUser removes the lock from a user account
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	err := h.userHandler.SetUserLock(userID, nil)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Unlocking User",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Unlock",
+	})
+}
+
+// ResetUserPassword replaces the password of a user with a random temporary one
+func (h *UserHandler) ResetUserPassword(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	buf := make([]byte, 12)
+	_, err := rand.Read(buf)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating Password",
+		})
+		c.Abort()
+		return
+	}
+	password := base64.RawURLEncoding.EncodeToString(buf)
+	if !h.setPassword(c, userID, password, 0) {
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message":  "Successful Reset",
+		"password": password,
+	})
+}
+
+// GetUserStats returns the goal counts and storage usage of a user
+func (h *UserHandler) GetUserStats(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid User ID",
+		})
+		c.Abort()
+		return
+	}
+	stats, err := h.userHandler.GetUserStats(userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Loading Stats",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, stats)
+}
+
+// logOutUser revokes every session of a user so the tokens issued to them stop working at once,
+// writing the error response if it fails
+func (h *UserHandler) logOutUser(c *gin.Context, userID int) bool {
+	err := h.userHandler.RevokeOtherSessions(userID, 0)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Revoking Sessions",
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// targetUserID reads the user ID from the path and checks that it exists and
+// is not the admin making the request
+func (h *UserHandler) targetUserID(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid User ID",
+		})
+		c.Abort()
+		return 0, false
+	}
+	if userID == c.GetInt("id") {
+		c.JSON(400, gin.H{
+			"Error": "Cannot Modify Own Account",
+		})
+		c.Abort()
+		return 0, false
+	}
+	_, err = h.userHandler.GetUser(userID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"Error": "User Not Found",
+		})
+		c.Abort()
+		return 0, false
+	}
+	return userID, true
+}
+
+// ListFailedLogins returns failed login attempts, newest first, filtered by the email and ip
+// query parameters and paginated with limit and offset
+func (h *UserHandler) ListFailedLogins(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Limit",
+		})
+		c.Abort()
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Offset",
+		})
+		c.Abort()
+		return
+	}
+	email := c.Query("email")
+	if email != "" {
+		email = normalizeEmail(email)
+	}
+	attempts, err := h.userHandler.ListFailedLogins(email, c.Query("ip"), limit, offset)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Listing Login Attempts",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, attempts)
+}
@@ -1,14 +1,42 @@
 package usertransport
 
-import userbusiness "github.com/khoaphungnguyen/learning-tracker/internal/users/business"
+import (
+	"time"
+
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	"github.com/khoaphungnguyen/learning-tracker/internal/mailer"
+	"github.com/khoaphungnguyen/learning-tracker/internal/oidc"
+	userbusiness "github.com/khoaphungnguyen/learning-tracker/internal/users/business"
+)
 
 type UserHandler struct {
 	userHandler *userbusiness.UserService
-	JWTKey      string
-}
+	JWT         auth.JwtWrapper
+	Mailer      mailer.Mailer
+	BaseURL     string // Base URL of the frontend, used to build links sent by email
 
-func NewUserHandler(userHandler *userbusiness.UserService, JWTKey string) *UserHandler {
-	return &UserHandler{userHandler: userHandler, JWTKey: JWTKey}
-}
+	// EmailVerification is how unverified accounts are treated, one of
+	// VerificationOff, VerificationRestrict or VerificationBlock
+	EmailVerification string
+
+	// ErasureGrace is how long a deleted account is kept before its data is erased
+	ErasureGrace time.Duration
 
+	// OIDCProviders are the identity providers users can log in with
+	OIDCProviders []*oidc.Provider
 
+	// resendByEmail and resendByIP limit requests for new verification emails
+	resendByEmail *requestLimiter
+	resendByIP    *requestLimiter
+
+	// loginLocks serializes login attempts per email and client IP
+	loginLocks *keyLocks
+}
+
+func NewUserHandler(userHandler *userbusiness.UserService, JWT auth.JwtWrapper, Mailer mailer.Mailer, BaseURL string) *UserHandler {
+	return &UserHandler{userHandler: userHandler, JWT: JWT, Mailer: Mailer, BaseURL: BaseURL, EmailVerification: VerificationRestrict, ErasureGrace: 30 * 24 * time.Hour,
+		resendByEmail: newRequestLimiter(1, verificationResendInterval),
+		resendByIP:    newRequestLimiter(verificationIPLimit, verificationIPWindow),
+		loginLocks:    newKeyLocks(),
+	}
+}
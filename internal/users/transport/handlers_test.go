@@ -0,0 +1,103 @@
+package usertransport
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	"github.com/khoaphungnguyen/learning-tracker/internal/mailer"
+	userbusiness "github.com/khoaphungnguyen/learning-tracker/internal/users/business"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+	userstorage "github.com/khoaphungnguyen/learning-tracker/internal/users/storage"
+)
+
+var (
+	testStore userstorage.UserStore
+	testDB    *sql.DB
+)
+
+// TestMain runs the tests against a fresh database, which the store opens under the working directory
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dir, err := os.MkdirTemp("", "usertransport")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "migrations"), 0o755)
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := userstorage.NewUserStore()
+	if err == nil {
+		err = store.CreateTable()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	testStore, testDB = store, store.DB
+	code := m.Run()
+	store.DB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestHandler returns a handler on the test database, with emails written to the log
+func newTestHandler() *UserHandler {
+	jwt := auth.JwtWrapper{
+		SecretKey:         "secret",
+		Issuer:            "AuthService",
+		ExpirationMinutes: 30,
+		ExpirationHours:   12,
+	}
+	h := NewUserHandler(userbusiness.NewUserService(testStore), jwt, mailer.LogMailer{}, "http://app.test")
+	h.EmailVerification = VerificationOff
+	return h
+}
+
+// createTestUser registers a user with a password and returns them
+func createTestUser(t *testing.T, email string, password string) usermodel.User {
+	t.Helper()
+	var user usermodel.User
+	err := user.HashPassword(password)
+	if err == nil {
+		err = testStore.CreateUser(email, user.Password, user.Salt, "Test")
+	}
+	if err == nil {
+		user, err = testStore.GetUserByEmail(email)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// clearLoginAttempts forgets earlier login attempts, as every test request comes from the same IP
+func clearLoginAttempts(t *testing.T) {
+	t.Helper()
+	_, err := testDB.Exec(`DELETE FROM login_attempts`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sentMail is an email sent through a testMailer
+type sentMail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// testMailer hands the emails sent to the test, which are sent in the background
+type testMailer chan sentMail
+
+func (m testMailer) Send(to string, subject string, body string) error {
+	m <- sentMail{To: to, Subject: subject, Body: body}
+	return nil
+}
@@ -0,0 +1,395 @@
+package usertransport
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	totpIssuer           = "Learning Tracker" // Issuer shown in authenticator apps
+	mfaChallengeTTL      = 5 * time.Minute    // Time to enter the second factor after the password
+	mfaChallengeAttempts = 3                  // Wrong codes a challenge takes before the password is needed again
+	recoveryCodeCount    = 10                 // Number of recovery codes generated at a time
+)
+
+// MFACodePayload second factor body, a TOTP code or a recovery code
+type MFACodePayload struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFALoginPayload second login step body
+type MFALoginPayload struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFAChallengeResponse login response for users with two-factor authentication
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+}
+
+// TOTPSetupResponse enrollment response
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qrCode"` // PNG of the URI as a data URL
+}
+
+// RecoveryCodesResponse recovery codes response, the only time the codes are shown
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// mfaChallenge responds with a short-lived token for the second login step
+func (h *UserHandler) mfaChallenge(c *gin.Context, user usermodel.User) {
+	mfaToken, err := h.JWT.MFAChallengeToken(user.ID, mfaChallengeTTL)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Signing Token",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+// VerifyMFA completes a login with the second factor.
+// Wrong codes count towards the login throttle and lockout like wrong passwords.
+func (h *UserHandler) VerifyMFA(c *gin.Context) {
+	var payload MFALoginPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	claims, err := h.JWT.ValidateMFAChallengeToken(payload.MFAToken)
+	if err != nil {
+		c.JSON(401, gin.H{
+			"Error": "Invalid Or Expired Token",
+		})
+		c.Abort()
+		return
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		c.JSON(401, gin.H{
+			"Error": "Invalid Or Expired Token",
+		})
+		c.Abort()
+		return
+	}
+	user, err := h.userHandler.GetUser(userID)
+	if err != nil || !user.TOTPEnabled || claims.IssuedAt == nil {
+		c.JSON(401, gin.H{
+			"Error": "Invalid Or Expired Token",
+		})
+		c.Abort()
+		return
+	}
+	email := normalizeEmail(user.Email)
+	defer h.lockLogin(c, email)()
+	failures, ok := h.checkLoginThrottle(c, email)
+	if !ok {
+		return
+	}
+	misses, err := h.challengeMisses(c, email, claims.IssuedAt.Time)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Checking Login Attempts",
+		})
+		c.Abort()
+		return
+	}
+	if misses >= mfaChallengeAttempts {
+		c.JSON(401, gin.H{
+			"Error": "Invalid Or Expired Token",
+		})
+		c.Abort()
+		return
+	}
+	// Checked before the code, so a locked account does not tell whether a code was right
+	if user.Disabled {
+		c.JSON(403, gin.H{
+			"Error": "Account Disabled",
+		})
+		c.Abort()
+		return
+	}
+	if user.IsLocked() {
+		c.JSON(423, gin.H{
+			"Error": "Account Locked",
+		})
+		c.Abort()
+		return
+	}
+	if !h.checkSecondFactor(user, payload.Code) {
+		h.recordLoginFailure(c, email, failures, &user)
+		c.JSON(401, gin.H{
+			"Error": "Invalid Code",
+		})
+		c.Abort()
+		return
+	}
+	h.loginSucceeded(c, email)
+	h.issueTokens(c, user)
+}
+
+// challengeMisses returns how many logins of the email failed since an MFA challenge was issued
+func (h *UserHandler) challengeMisses(c *gin.Context, email string, issuedAt time.Time) (int, error) {
+	attempts, err := h.userHandler.ListRecentLoginAttempts(email, c.ClientIP(), issuedAt)
+	if err != nil {
+		return 0, err
+	}
+	misses := 0
+	for _, attempt := range attempts {
+		if attempt.Email == email && !attempt.Succeeded {
+			misses++
+		}
+	}
+	return misses, nil
+}
+
+// SetupTOTP starts enrollment by generating a new secret, which is enabled by EnableTOTP
+func (h *UserHandler) SetupTOTP(c *gin.Context) {
+	userID := c.GetInt("id")
+	user, err := h.userHandler.GetUser(userID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"Error": "User Not Found",
+		})
+		c.Abort()
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(409, gin.H{
+			"Error": "Two-Factor Authentication Already Enabled",
+		})
+		c.Abort()
+		return
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating Secret",
+		})
+		c.Abort()
+		return
+	}
+	uri := auth.TOTPURI(totpIssuer, user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating QR Code",
+		})
+		c.Abort()
+		return
+	}
+	err = h.userHandler.SetTOTPSecret(userID, secret)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Saving Secret",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, TOTPSetupResponse{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// EnableTOTP confirms enrollment with a code from the authenticator app and returns recovery codes
+func (h *UserHandler) EnableTOTP(c *gin.Context) {
+	userID := c.GetInt("id")
+	var payload MFACodePayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	user, err := h.userHandler.GetUser(userID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"Error": "User Not Found",
+		})
+		c.Abort()
+		return
+	}
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		c.JSON(409, gin.H{
+			"Error": "No Pending Enrollment",
+		})
+		c.Abort()
+		return
+	}
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, payload.Code, time.Now())
+	if !ok || h.userHandler.UseTOTPStep(userID, step) != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Code",
+		})
+		c.Abort()
+		return
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating Recovery Codes",
+		})
+		c.Abort()
+		return
+	}
+	err = h.userHandler.EnableTOTP(userID, hashes)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Enabling Two-Factor Authentication",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns off two-factor authentication after checking a TOTP or recovery code
+func (h *UserHandler) DisableTOTP(c *gin.Context) {
+	user, ok := h.confirmSecondFactor(c)
+	if !ok {
+		return
+	}
+	err := h.userHandler.DisableTOTP(user.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Disabling Two-Factor Authentication",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Disable",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a TOTP or recovery code
+func (h *UserHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := h.confirmSecondFactor(c)
+	if !ok {
+		return
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating Recovery Codes",
+		})
+		c.Abort()
+		return
+	}
+	err = h.userHandler.ReplaceRecoveryCodes(user.ID, hashes)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Saving Recovery Codes",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// confirmSecondFactor loads the logged in user and checks the code in the request body
+// against their second factor, writing the error response if it fails
+func (h *UserHandler) confirmSecondFactor(c *gin.Context) (usermodel.User, bool) {
+	userID := c.GetInt("id")
+	var payload MFACodePayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return usermodel.User{}, false
+	}
+	user, err := h.userHandler.GetUser(userID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"Error": "User Not Found",
+		})
+		c.Abort()
+		return user, false
+	}
+	if !user.TOTPEnabled {
+		c.JSON(409, gin.H{
+			"Error": "Two-Factor Authentication Not Enabled",
+		})
+		c.Abort()
+		return user, false
+	}
+	if !h.checkSecondFactor(user, payload.Code) {
+		c.JSON(401, gin.H{
+			"Error": "Invalid Code",
+		})
+		c.Abort()
+		return user, false
+	}
+	return user, true
+}
+
+// checkSecondFactor accepts a TOTP code that has not been used yet, or an unused recovery code
+func (h *UserHandler) checkSecondFactor(user usermodel.User, code string) bool {
+	code = strings.TrimSpace(code)
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		return h.userHandler.UseTOTPStep(user.ID, step) == nil
+	}
+	return h.userHandler.UseRecoveryCode(user.ID, auth.HashOpaqueToken(normalizeRecoveryCode(code))) == nil
+}
+
+// generateRecoveryCodes returns new recovery codes formatted as xxxxx-xxxxx and their hashes
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		_, err = rand.Read(buf)
+		if err != nil {
+			return
+		}
+		code := strings.ToLower(encoding.EncodeToString(buf))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, auth.HashOpaqueToken(code))
+	}
+	return
+}
+
+// normalizeRecoveryCode strips the formatting users may type along with a recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
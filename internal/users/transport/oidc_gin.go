@@ -0,0 +1,364 @@
+package usertransport
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	"github.com/khoaphungnguyen/learning-tracker/internal/oidc"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcLoginTTL    = 10 * time.Minute // Time to complete a login at the identity provider
+	oidcStateCookie = "oidc_state"     // Cookie binding a login to the browser that started it
+	oidcCookiePath  = "/auth/oidc"
+)
+
+// OIDCProviderResponse identity provider users can log in with
+type OIDCProviderResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ListOIDCProviders lists the identity providers users can log in with
+func (h *UserHandler) ListOIDCProviders(c *gin.Context) {
+	providers := []OIDCProviderResponse{}
+	for _, provider := range h.OIDCProviders {
+		providers = append(providers, OIDCProviderResponse{ID: provider.ID, Name: provider.Name})
+	}
+	c.JSON(200, providers)
+}
+
+// OIDCLogin redirects to the login page of an identity provider
+func (h *UserHandler) OIDCLogin(c *gin.Context) {
+	url, ok := h.startOIDCLogin(c, 0)
+	if !ok {
+		return
+	}
+	c.Redirect(302, url)
+}
+
+// LinkIdentity starts a login at an identity provider that links the identity to the logged in user.
+// The client has to send the user to the returned URL.
+func (h *UserHandler) LinkIdentity(c *gin.Context) {
+	url, ok := h.startOIDCLogin(c, c.GetInt("id"))
+	if !ok {
+		return
+	}
+	c.JSON(200, gin.H{
+		"url": url,
+	})
+}
+
+// OIDCCallback completes a login at an identity provider.
+// Unknown identities get a new account, unless their email is already registered.
+func (h *UserHandler) OIDCCallback(c *gin.Context) {
+	provider := h.oidcProvider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(404, gin.H{
+			"Error": "Provider Not Found",
+		})
+		c.Abort()
+		return
+	}
+	if c.Query("error") != "" {
+		c.JSON(401, gin.H{
+			"Error": "Login Refused By Provider",
+		})
+		c.Abort()
+		return
+	}
+	state := c.Query("state")
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		c.JSON(400, gin.H{
+			"Error": "Invalid State",
+		})
+		c.Abort()
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", c.Request.TLS != nil, true)
+	login, err := h.userHandler.ConsumeOIDCLogin(auth.HashOpaqueToken(state))
+	if err != nil || login.Provider != provider.ID {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Or Expired State",
+		})
+		c.Abort()
+		return
+	}
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), login.Nonce, login.CodeVerifier)
+	if err != nil {
+		log.Println(err)
+		c.JSON(401, gin.H{
+			"Error": "Invalid Identity Token",
+		})
+		c.Abort()
+		return
+	}
+	if login.LinkUserID != 0 {
+		h.linkIdentity(c, provider, identity, login.LinkUserID)
+		return
+	}
+	user, ok := h.oidcUser(c, provider, identity)
+	if !ok {
+		return
+	}
+	if user.Disabled {
+		c.JSON(403, gin.H{
+			"Error": "Account Disabled",
+		})
+		c.Abort()
+		return
+	}
+	if user.IsLocked() {
+		c.JSON(423, gin.H{
+			"Error": "Account Locked",
+		})
+		c.Abort()
+		return
+	}
+	if user.TOTPEnabled {
+		h.mfaChallenge(c, user)
+		return
+	}
+	h.issueTokens(c, user)
+}
+
+// ListIdentities lists the identities linked to the logged in user
+func (h *UserHandler) ListIdentities(c *gin.Context) {
+	userID := c.GetInt("id")
+	identities, err := h.userHandler.ListIdentities(userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Listing Identities",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, identities)
+}
+
+// UnlinkIdentity unlinks an identity from the logged in user
+func (h *UserHandler) UnlinkIdentity(c *gin.Context) {
+	userID := c.GetInt("id")
+	identityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Identity ID",
+		})
+		c.Abort()
+		return
+	}
+	err = h.userHandler.DeleteIdentity(identityID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{
+			"Error": "Identity Not Found",
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Unlinking Identity",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Unlink",
+	})
+}
+
+// startOIDCLogin stores a new login for the provider in the URL and returns the provider's login page.
+// linkUserID is the user to link the identity to, or 0 to log in with it.
+func (h *UserHandler) startOIDCLogin(c *gin.Context, linkUserID int) (string, bool) {
+	provider := h.oidcProvider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(404, gin.H{
+			"Error": "Provider Not Found",
+		})
+		c.Abort()
+		return "", false
+	}
+	state, stateHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating State",
+		})
+		c.Abort()
+		return "", false
+	}
+	nonce, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating State",
+		})
+		c.Abort()
+		return "", false
+	}
+	codeVerifier := oauth2.GenerateVerifier()
+	url, err := provider.AuthCodeURL(state, nonce, codeVerifier, c.Query("login_hint"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(502, gin.H{
+			"Error": "Provider Unavailable",
+		})
+		c.Abort()
+		return "", false
+	}
+	err = h.userHandler.CreateOIDCLogin(stateHash, provider.ID, nonce, codeVerifier, linkUserID, time.Now().Add(oidcLoginTTL))
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Creating Login",
+		})
+		c.Abort()
+		return "", false
+	}
+	// Lax so the cookie comes along when the provider redirects back
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcLoginTTL.Seconds()), oidcCookiePath, "", c.Request.TLS != nil, true)
+	return url, true
+}
+
+// oidcUser returns the user an identity is linked to, creating an account for new identities
+func (h *UserHandler) oidcUser(c *gin.Context, provider *oidc.Provider, identity oidc.Identity) (usermodel.User, bool) {
+	linked, err := h.userHandler.GetIdentity(provider.ID, identity.Subject)
+	if err == nil {
+		user, err := h.userHandler.GetUser(linked.UserID)
+		if err != nil {
+			c.JSON(404, gin.H{
+				"Error": "User Not Found",
+			})
+			c.Abort()
+			return user, false
+		}
+		return user, true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Finding Identity",
+		})
+		c.Abort()
+		return usermodel.User{}, false
+	}
+	if identity.Email == "" {
+		c.JSON(400, gin.H{
+			"Error": "Provider Did Not Share An Email",
+		})
+		c.Abort()
+		return usermodel.User{}, false
+	}
+	// Taking over an account needs its password, so existing users link the identity themselves
+	_, err = h.userHandler.GetUserByEmail(identity.Email)
+	if err == nil {
+		c.JSON(409, gin.H{
+			"Error": "Email Already Registered, Log In And Link The Identity",
+		})
+		c.Abort()
+		return usermodel.User{}, false
+	}
+	return h.provisionUser(c, provider, identity)
+}
+
+// provisionUser creates an account for a new identity.
+// The account gets a random password, which the user can replace with a password reset.
+func (h *UserHandler) provisionUser(c *gin.Context, provider *oidc.Provider, identity oidc.Identity) (usermodel.User, bool) {
+	var user usermodel.User
+	password, _, err := auth.GenerateOpaqueToken()
+	if err == nil {
+		err = user.HashPassword(password)
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Hashing Password",
+		})
+		c.Abort()
+		return user, false
+	}
+	name := identity.Name
+	if name == "" {
+		name = strings.Split(identity.Email, "@")[0]
+	}
+	err = h.userHandler.CreateUser(normalizeEmail(identity.Email), user.Password, user.Salt, name)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Creating User",
+		})
+		c.Abort()
+		return user, false
+	}
+	user, err = h.userHandler.GetUserByEmail(identity.Email)
+	if err == nil && identity.EmailVerified {
+		err = h.userHandler.SetEmailVerified(user.ID, user.Email)
+		user.EmailVerified = true
+	}
+	if err == nil {
+		err = h.userHandler.CreateIdentity(user.ID, provider.ID, identity.Subject, identity.Email)
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Creating User",
+		})
+		c.Abort()
+		return user, false
+	}
+	return user, true
+}
+
+// linkIdentity links an identity to a user who started a login from their account
+func (h *UserHandler) linkIdentity(c *gin.Context, provider *oidc.Provider, identity oidc.Identity, userID int) {
+	linked, err := h.userHandler.GetIdentity(provider.ID, identity.Subject)
+	if err == nil {
+		if linked.UserID != userID {
+			c.JSON(409, gin.H{
+				"Error": "Identity Linked To Another Account",
+			})
+			c.Abort()
+			return
+		}
+		c.JSON(200, gin.H{
+			"Message": "Identity Already Linked",
+		})
+		return
+	}
+	err = h.userHandler.CreateIdentity(userID, provider.ID, identity.Subject, identity.Email)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Linking Identity",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Link",
+	})
+}
+
+// oidcProvider returns the identity provider with the given ID, or nil
+func (h *UserHandler) oidcProvider(id string) *oidc.Provider {
+	for _, provider := range h.OIDCProviders {
+		if provider.ID == id {
+			return provider
+		}
+	}
+	return nil
+}
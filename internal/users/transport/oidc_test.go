@@ -0,0 +1,195 @@
+package usertransport
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	"github.com/khoaphungnguyen/learning-tracker/internal/oidc"
+)
+
+// newOIDCTestRouter serves the OIDC login routes of a handler set up with a mock identity provider
+func newOIDCTestRouter(t *testing.T) (*UserHandler, *gin.Engine) {
+	t.Helper()
+	var mock *oidc.MockProvider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	mock, err := oidc.NewMockProvider(server.URL, "learning-tracker", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler()
+	h.OIDCProviders = []*oidc.Provider{{
+		ID:           "mock",
+		Name:         "Mock Provider",
+		Issuer:       mock.Issuer,
+		ClientID:     mock.ClientID,
+		ClientSecret: mock.ClientSecret,
+		RedirectURL:  "http://tracker.test/auth/oidc/mock/callback",
+	}}
+	r := gin.New()
+	r.GET("/auth/oidc/:provider/login", h.OIDCLogin)
+	r.GET("/auth/oidc/:provider/callback", h.OIDCCallback)
+	return h, r
+}
+
+// startOIDCLogin logs in at the mock provider as email and returns the callback request the
+// browser is sent back with, along with the state of the login
+func startOIDCLogin(t *testing.T, r *gin.Engine, email string) (*http.Request, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/mock/login?login_hint="+url.QueryEscape(email), nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body)
+	}
+	var stateCookie *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("login set no state cookie")
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d", resp.StatusCode)
+	}
+	callback := httptest.NewRequest("GET", resp.Header.Get("Location"), nil)
+	callback.AddCookie(stateCookie)
+	return callback, stateCookie.Value
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCLoginProvisionsAccount(t *testing.T) {
+	h, r := newOIDCTestRouter(t)
+	callback, _ := startOIDCLogin(t, r, "oidc-new@example.com")
+	w := serve(r, callback)
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d: %s", w.Code, w.Body)
+	}
+	var tokens LoginResponse
+	err := json.Unmarshal(w.Body.Bytes(), &tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := h.JWT.ValidateToken(tokens.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := testStore.GetUserByEmail("oidc-new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := claims.UserID(); id != user.ID {
+		t.Errorf("token is for user %d, want %d", id, user.ID)
+	}
+	if !user.EmailVerified {
+		t.Error("email vouched for by the provider is not verified")
+	}
+	identities, err := testStore.ListIdentities(user.ID)
+	if err != nil || len(identities) != 1 || identities[0].Provider != "mock" {
+		t.Fatalf("identities = %+v, %v", identities, err)
+	}
+
+	// Logging in again finds the linked account
+	callback, _ = startOIDCLogin(t, r, "oidc-new@example.com")
+	w = serve(r, callback)
+	if w.Code != http.StatusOK {
+		t.Fatalf("second callback status = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestOIDCLoginExistingEmail(t *testing.T) {
+	_, r := newOIDCTestRouter(t)
+	createTestUser(t, "oidc-taken@example.com", "password1")
+	callback, _ := startOIDCLogin(t, r, "oidc-taken@example.com")
+	w := serve(r, callback)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("callback status = %d, want 409: %s", w.Code, w.Body)
+	}
+	user, err := testStore.GetUserByEmail("oidc-taken@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := testStore.ListIdentities(user.ID)
+	if err != nil || len(identities) != 0 {
+		t.Fatalf("identity linked to an existing account: %+v, %v", identities, err)
+	}
+}
+
+func TestOIDCCallbackStateReuse(t *testing.T) {
+	_, r := newOIDCTestRouter(t)
+	callback, _ := startOIDCLogin(t, r, "oidc-replay@example.com")
+	replay := callback.Clone(callback.Context())
+	w := serve(r, callback)
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d: %s", w.Code, w.Body)
+	}
+	w = serve(r, replay)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed callback status = %d, want 400: %s", w.Code, w.Body)
+	}
+}
+
+func TestOIDCCallbackStateMismatch(t *testing.T) {
+	_, r := newOIDCTestRouter(t)
+	callback, _ := startOIDCLogin(t, r, "oidc-csrf@example.com")
+	// A callback started in another browser does not carry the state cookie
+	other := httptest.NewRequest("GET", callback.URL.String(), nil)
+	other.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "someone else's state"})
+	w := serve(r, other)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("callback status = %d, want 400: %s", w.Code, w.Body)
+	}
+}
+
+func TestOIDCCallbackNonceMismatch(t *testing.T) {
+	_, r := newOIDCTestRouter(t)
+	callback, state := startOIDCLogin(t, r, "oidc-nonce@example.com")
+	// The ID token is for another login than the one stored for the state
+	_, err := testDB.Exec(`UPDATE oidc_logins SET nonce='other' WHERE state_hash=?`, auth.HashOpaqueToken(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(r, callback)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("callback status = %d, want 401: %s", w.Code, w.Body)
+	}
+	if _, err := testStore.GetUserByEmail("oidc-nonce@example.com"); err == nil {
+		t.Error("account created for a token with the wrong nonce")
+	}
+}
+
+func TestOIDCCallbackPKCE(t *testing.T) {
+	_, r := newOIDCTestRouter(t)
+	callback, state := startOIDCLogin(t, r, "oidc-pkce@example.com")
+	// A code intercepted on the way back cannot be redeemed without the verifier
+	_, err := testDB.Exec(`UPDATE oidc_logins SET code_verifier='stolen-code-without-the-verifier-xxxxxxxxxxx' WHERE state_hash=?`,
+		auth.HashOpaqueToken(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(r, callback)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("callback status = %d, want 401: %s", w.Code, w.Body)
+	}
+}
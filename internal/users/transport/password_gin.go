@@ -0,0 +1,176 @@
+package usertransport
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+)
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = time.Hour
+
+// ChangePasswordPayload change password body
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8"`
+}
+
+// ForgotPasswordPayload forgotten password body
+type ForgotPasswordPayload struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ResetPasswordPayload reset password body
+type ResetPasswordPayload struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required,min=8"`
+}
+
+// ChangePassword changes the password of the logged in user after checking the current one
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userID := c.GetInt("id")
+	var payload ChangePasswordPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	user, err := h.userHandler.GetUserCredentials(userID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"Error": "User Not Found",
+		})
+		c.Abort()
+		return
+	}
+	err = user.CheckPassword(payload.CurrentPassword)
+	if err != nil {
+		c.JSON(401, gin.H{
+			"Error": "Invalid User Credentials",
+		})
+		c.Abort()
+		return
+	}
+	if !h.setPassword(c, userID, payload.NewPassword, c.GetInt("session")) {
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Password Change",
+	})
+}
+
+// ForgotPassword emails a single-use password reset link.
+// The response is the same whether or not the email is registered.
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var payload ForgotPasswordPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	response := gin.H{
+		"Message": "If the email is registered, a reset link has been sent",
+	}
+	user, err := h.userHandler.GetUserByEmail(payload.Email)
+	if err != nil {
+		c.JSON(200, response)
+		return
+	}
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating Token",
+		})
+		c.Abort()
+		return
+	}
+	err = h.userHandler.CreatePasswordReset(user.ID, tokenHash, time.Now().Add(passwordResetTTL))
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Creating Reset",
+		})
+		c.Abort()
+		return
+	}
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.BaseURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Someone asked to reset the password of your Learning Tracker account.\n\n"+
+		"Open this link within %d minutes to choose a new password:\n%s\n\n"+
+		"If it wasn't you, ignore this email.", int(passwordResetTTL.Minutes()), link)
+	// Send in the background so the response time does not reveal registered emails
+	go func() {
+		err := h.Mailer.Send(user.Email, "Reset your password", body)
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+	c.JSON(200, response)
+}
+
+// ResetPassword sets a new password using a token from a reset link
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var payload ResetPasswordPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	userID, err := h.userHandler.ConsumePasswordReset(auth.HashOpaqueToken(payload.Token))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Or Expired Token",
+		})
+		c.Abort()
+		return
+	}
+	if !h.setPassword(c, userID, payload.NewPassword, 0) {
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Password Reset",
+	})
+}
+
+// setPassword hashes and stores a new password and logs out every session except keepSessionID,
+// writing the error response if it fails
+func (h *UserHandler) setPassword(c *gin.Context, userID int, password string, keepSessionID int) bool {
+	var user usermodel.User
+	err := user.HashPassword(password)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Hashing Password",
+		})
+		c.Abort()
+		return false
+	}
+	err = h.userHandler.UpdatePassword(userID, user.Password, user.Salt)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Updating Password",
+		})
+		c.Abort()
+		return false
+	}
+	err = h.userHandler.RevokeOtherSessions(userID, keepSessionID)
+	if err != nil {
+		log.Println(err)
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package usertransport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateProfileVerifiesNewEmail(t *testing.T) {
+	h := newTestHandler()
+	mails := make(testMailer, 4)
+	h.Mailer = mails
+	user := createTestUser(t, "profile-old@example.com", "password1")
+	err := testStore.SetEmailVerified(user.ID, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.PUT("/profile", func(c *gin.Context) {
+		c.Set("id", user.ID)
+	}, h.UpdateProfile)
+	update := func(body string) {
+		t.Helper()
+		w := serve(r, httptest.NewRequest("PUT", "/profile", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("update status = %d: %s", w.Code, w.Body)
+		}
+	}
+
+	// Renaming keeps the address verified and sends nothing
+	update(`{"email":"profile-old@example.com","name":"Renamed"}`)
+	select {
+	case mail := <-mails:
+		t.Fatalf("rename sent %+v", mail)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	update(`{"email":"profile-new@example.com","name":"Renamed"}`)
+	select {
+	case mail := <-mails:
+		if mail.To != "profile-new@example.com" || !strings.Contains(mail.Body, "/verify-email?token=") {
+			t.Errorf("sent %+v, want a verification link to the new address", mail)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no verification sent to the new address")
+	}
+	updated, err := testStore.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.EmailVerified {
+		t.Error("new address is verified without a link")
+	}
+}
@@ -0,0 +1,84 @@
+package usertransport
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSessions lists the active sessions of the logged in user
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	userID := c.GetInt("id")
+	sessions, err := h.userHandler.ListSessions(userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Listing Sessions",
+		})
+		c.Abort()
+		return
+	}
+	current := c.GetInt("session")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	c.JSON(200, sessions)
+}
+
+// RevokeSession logs out one session of the logged in user
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	userID := c.GetInt("id")
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Session ID",
+		})
+		c.Abort()
+		return
+	}
+	err = h.userHandler.RevokeSession(sessionID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{
+			"Error": "Session Not Found",
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Revoking Session",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Revoke",
+	})
+}
+
+// RevokeOtherSessions logs out every session of the logged in user except the one making the request
+func (h *UserHandler) RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetInt("id")
+	err := h.userHandler.RevokeOtherSessions(userID, c.GetInt("session"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Revoking Sessions",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Revoke",
+	})
+}
+
+// sessionActive reports whether a session of the user exists and has not been revoked
+func (h *UserHandler) sessionActive(sessionID int, userID int) bool {
+	session, err := h.userHandler.GetSession(sessionID)
+	return err == nil && session.UserID == userID && session.RevokedAt == nil
+}
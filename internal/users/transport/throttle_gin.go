@@ -0,0 +1,248 @@
+package usertransport
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+)
+
+// Login throttling. Each failure past the free ones doubles the wait before the next attempt.
+const (
+	loginWindow         = 15 * time.Minute // Failures older than this are forgotten
+	accountFreeFailures = 3                // Failures for an email before it has to wait
+	ipFreeFailures      = 10               // Failures from an IP before it has to wait
+	loginBaseDelay      = time.Second      // Wait after the first failure past the free ones
+	loginMaxDelay       = 5 * time.Minute  // Longest wait between attempts
+	lockoutFailures     = 10               // Failures in a row that lock the account
+	lockoutDuration     = 15 * time.Minute // How long such a lock lasts
+)
+
+var (
+	timingUser     usermodel.User
+	timingUserOnce sync.Once
+)
+
+// normalizeEmail returns the email used to count login failures
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// keyLocks holds a mutex for each key in use, such as an email, and forgets it once it is unlocked
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	users int // Requests holding or waiting for the lock
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{locks: map[string]*keyLock{}}
+}
+
+// lock locks a key and returns the function unlocking it
+func (l *keyLocks) lock(key string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		l.locks[key] = lock
+	}
+	lock.users++
+	l.mu.Unlock()
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// lockLogin serializes the logins of an email and of the client IP, so that concurrent attempts
+// cannot all pass the throttle before any of their failures is recorded. It returns the function
+// unlocking them, to call once the outcome of the attempt is recorded.
+func (h *UserHandler) lockLogin(c *gin.Context, email string) func() {
+	// Always locked in this order, so two logins never wait for each other
+	unlockEmail := h.loginLocks.lock("email:" + email)
+	unlockIP := h.loginLocks.lock("ip:" + c.ClientIP())
+	return func() {
+		unlockIP()
+		unlockEmail()
+	}
+}
+
+// checkLoginThrottle returns the number of failures in a row for the email,
+// or responds with 429 if the email or client IP has to wait before trying again
+func (h *UserHandler) checkLoginThrottle(c *gin.Context, email string) (int, bool) {
+	ip := c.ClientIP()
+	attempts, err := h.userHandler.ListRecentLoginAttempts(email, ip, time.Now().Add(-loginWindow))
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Checking Login Attempts",
+		})
+		c.Abort()
+		return 0, false
+	}
+	var accountFailures, ipFailures int
+	var lastAccountFailure, lastIPFailure time.Time
+	for _, attempt := range attempts {
+		if attempt.Email == email {
+			if attempt.Succeeded {
+				accountFailures = 0
+			} else {
+				accountFailures++
+				lastAccountFailure = attempt.CreatedAt
+			}
+		}
+		if attempt.IP == ip && !attempt.Succeeded {
+			ipFailures++
+			lastIPFailure = attempt.CreatedAt
+		}
+	}
+	retryAt := lastAccountFailure.Add(loginBackoff(accountFailures, accountFreeFailures))
+	if ipRetryAt := lastIPFailure.Add(loginBackoff(ipFailures, ipFreeFailures)); ipRetryAt.After(retryAt) {
+		retryAt = ipRetryAt
+	}
+	if wait := time.Until(retryAt); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(429, gin.H{
+			"Error": "Too Many Login Attempts",
+		})
+		c.Abort()
+		return accountFailures, false
+	}
+	return accountFailures, true
+}
+
+// loginBackoff returns how long to wait after the given number of failures
+func loginBackoff(failures int, free int) time.Duration {
+	if failures < free {
+		return 0
+	}
+	delay := loginBaseDelay
+	for i := free; i < failures && delay < loginMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > loginMaxDelay {
+		delay = loginMaxDelay
+	}
+	return delay
+}
+
+// loginFailed records a failed login and responds with the same error whether or not the email is registered.
+// user is nil for unknown emails.
+func (h *UserHandler) loginFailed(c *gin.Context, email string, failures int, user *usermodel.User) {
+	h.recordLoginFailure(c, email, failures, user)
+	c.JSON(401, gin.H{
+		"Error": "Invalid Email Or Password",
+	})
+	c.Abort()
+}
+
+// recordLoginFailure records a wrong password or second factor, which counts towards the login throttle.
+// user is nil for unknown emails. Accounts are locked after too many failures in a row.
+func (h *UserHandler) recordLoginFailure(c *gin.Context, email string, failures int, user *usermodel.User) {
+	err := h.userHandler.RecordLoginAttempt(email, c.ClientIP(), false)
+	if err != nil {
+		log.Println(err)
+	}
+	if user != nil && failures+1 >= lockoutFailures {
+		lockedUntil := time.Now().Add(lockoutDuration)
+		// Keep longer locks set by an admin
+		if user.LockedUntil == nil || user.LockedUntil.Before(lockedUntil) {
+			err = h.userHandler.SetUserLock(user.ID, &lockedUntil)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// loginSucceeded records a successful login, which clears the failures in a row of the email
+func (h *UserHandler) loginSucceeded(c *gin.Context, email string) {
+	err := h.userHandler.RecordLoginAttempt(email, c.ClientIP(), true)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// checkTimingPassword hashes a password like a real login does,
+// so unknown emails take as long to reject as wrong passwords
+func checkTimingPassword(password string) {
+	timingUserOnce.Do(func() {
+		err := timingUser.HashPassword("timing")
+		if err != nil {
+			log.Println(err)
+		}
+	})
+	timingUser.CheckPassword(password)
+}
+
+// limiterSweepKeys is how many keys a requestLimiter holds before it forgets the ones with no recent requests
+const limiterSweepKeys = 10000
+
+// requestLimiter allows a number of requests per key, such as an email or a client IP, in a sliding window.
+// It is kept in memory, so limits start over when the server restarts.
+type requestLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu       sync.Mutex
+	requests map[string][]time.Time // Times of the recent requests of each key, oldest first
+}
+
+func newRequestLimiter(limit int, window time.Duration) *requestLimiter {
+	return &requestLimiter{limit: limit, window: window, requests: map[string][]time.Time{}}
+}
+
+// wait returns how long a key has to wait before its next request is allowed
+func (l *requestLimiter) wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	recent := l.recent(key, now)
+	if len(recent) < l.limit {
+		return 0
+	}
+	return recent[len(recent)-l.limit].Add(l.window).Sub(now)
+}
+
+// add records a request of a key
+func (l *requestLimiter) add(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if len(l.requests) >= limiterSweepKeys {
+		for other := range l.requests {
+			l.recent(other, now)
+		}
+	}
+	l.requests[key] = append(l.recent(key, now), now)
+}
+
+// recent forgets the requests of a key that are out of the window and returns the others
+func (l *requestLimiter) recent(key string, now time.Time) []time.Time {
+	times := l.requests[key]
+	for len(times) > 0 && now.Sub(times[0]) >= l.window {
+		times = times[1:]
+	}
+	if len(times) == 0 {
+		delete(l.requests, key)
+		return nil
+	}
+	l.requests[key] = times
+	return times
+}
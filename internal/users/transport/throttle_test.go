@@ -0,0 +1,49 @@
+package usertransport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	l := newRequestLimiter(2, time.Minute)
+	for i := 0; i < 2; i++ {
+		if wait := l.wait("a"); wait != 0 {
+			t.Fatalf("request %d has to wait %v", i+1, wait)
+		}
+		l.add("a")
+	}
+	if wait := l.wait("a"); wait <= 0 || wait > time.Minute {
+		t.Errorf("third request waits %v, want up to a minute", wait)
+	}
+	if wait := l.wait("b"); wait != 0 {
+		t.Errorf("other key has to wait %v", wait)
+	}
+	// Requests out of the window are forgotten
+	l.requests["a"] = []time.Time{time.Now().Add(-2 * time.Minute), time.Now().Add(-time.Second)}
+	if wait := l.wait("a"); wait != 0 {
+		t.Errorf("request after the window waits %v", wait)
+	}
+	if len(l.requests["a"]) != 1 {
+		t.Errorf("kept %d requests, want 1", len(l.requests["a"]))
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, loginBaseDelay},
+		{4, 2 * loginBaseDelay},
+		{6, 8 * loginBaseDelay},
+		{50, loginMaxDelay},
+	}
+	for _, test := range tests {
+		if got := loginBackoff(test.failures, accountFreeFailures); got != test.want {
+			t.Errorf("loginBackoff(%d) = %v, want %v", test.failures, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package usertransport
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+)
+
+// maxPersonalTokenDays is the longest lifetime a personal access token can be given
+const maxPersonalTokenDays = 365
+
+// CreateTokenPayload create personal access token body
+type CreateTokenPayload struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays"` // 0 creates a token that never expires
+}
+
+// CreateTokenResponse create personal access token response, the only time the token is shown
+type CreateTokenResponse struct {
+	ID        int64      `json:"id"`
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreatePersonalToken creates a personal access token for the logged in user
+func (h *UserHandler) CreatePersonalToken(c *gin.Context) {
+	userID := c.GetInt("id")
+	if c.GetBool("unverified") {
+		c.JSON(403, gin.H{
+			"Error": "Email Not Verified",
+		})
+		c.Abort()
+		return
+	}
+	var payload CreateTokenPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil || payload.ExpiresInDays < 0 || payload.ExpiresInDays > maxPersonalTokenDays {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	for _, scope := range payload.Scopes {
+		if !auth.ValidScope(scope) {
+			c.JSON(400, gin.H{
+				"Error": "Invalid Scope " + scope,
+			})
+			c.Abort()
+			return
+		}
+	}
+	var expiresAt *time.Time
+	if payload.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, payload.ExpiresInDays)
+		expiresAt = &expiry
+	}
+	token, tokenHash, err := auth.GeneratePAT()
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Generating Token",
+		})
+		c.Abort()
+		return
+	}
+	newID, err := h.userHandler.CreatePersonalAccessToken(userID, payload.Name, tokenHash, payload.Scopes, expiresAt)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Creating Token",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(201, CreateTokenResponse{
+		ID:        newID,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// ListPersonalTokens lists the personal access tokens of the logged in user
+func (h *UserHandler) ListPersonalTokens(c *gin.Context) {
+	userID := c.GetInt("id")
+	tokens, err := h.userHandler.ListPersonalAccessTokens(userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Listing Tokens",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, tokens)
+}
+
+// DeletePersonalToken revokes a personal access token of the logged in user
+func (h *UserHandler) DeletePersonalToken(c *gin.Context) {
+	userID := c.GetInt("id")
+	tokenID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Token ID",
+		})
+		c.Abort()
+		return
+	}
+	err = h.userHandler.DeletePersonalAccessToken(tokenID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{
+			"Error": "Token Not Found",
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Deleting Token",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Delete",
+	})
+}
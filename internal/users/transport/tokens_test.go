@@ -0,0 +1,62 @@
+package usertransport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
+	middleware "github.com/khoaphungnguyen/learning-tracker/internal/middlewares"
+)
+
+func TestPersonalTokenEmailVerification(t *testing.T) {
+	h := newTestHandler()
+	user := createTestUser(t, "pat-unverified@example.com", "password1")
+	token, tokenHash, err := auth.GeneratePAT()
+	if err == nil {
+		_, err = h.userHandler.CreatePersonalAccessToken(user.ID, "test", tokenHash, []string{auth.ScopeGoalsWrite}, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	authMiddleware := middleware.AuthMiddleware(h.JWT, h.userHandler, h.VerificationStatus)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/read", authMiddleware, middleware.RequirePermission(auth.PermGoalsRead), ok)
+	r.POST("/write", authMiddleware, middleware.RequirePermission(auth.PermGoalsWrite), ok)
+	request := func(method string, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return serve(r, req).Code
+	}
+
+	tests := []struct {
+		mode  string
+		read  int
+		write int
+	}{
+		{VerificationOff, http.StatusOK, http.StatusOK},
+		{VerificationRestrict, http.StatusOK, http.StatusForbidden},
+		{VerificationBlock, http.StatusForbidden, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		h.EmailVerification = tt.mode
+		if code := request("GET", "/read"); code != tt.read {
+			t.Errorf("%s: read status = %d, want %d", tt.mode, code, tt.read)
+		}
+		if code := request("POST", "/write"); code != tt.write {
+			t.Errorf("%s: write status = %d, want %d", tt.mode, code, tt.write)
+		}
+	}
+
+	// Once verified, the token has full access again
+	err = testStore.SetEmailVerified(user.ID, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.EmailVerification = VerificationBlock
+	if code := request("POST", "/write"); code != http.StatusOK {
+		t.Errorf("verified write status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -1,12 +1,12 @@
 package usertransport
 
 import (
+	"fmt"
 	"log"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/khoaphungnguyen/learning-tracker/internal/auth"
 	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
 )
 
@@ -33,6 +33,8 @@ func (h *UserHandler) Signup(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	// Emails are stored the way logins look them up
+	user.Email = normalizeEmail(user.Email)
 	err = user.HashPassword(user.Password)
 	if err != nil {
 		log.Println(err.Error())
@@ -51,6 +53,14 @@ func (h *UserHandler) Signup(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	// The account exists now, so a failed email only means the user has to ask for a resend
+	created, err := h.userHandler.GetUserByEmail(user.Email)
+	if err == nil {
+		err = h.sendVerification(created)
+	}
+	if err != nil {
+		log.Println(err)
+	}
 	c.JSON(200, gin.H{
 		"Message": "Successful Register",
 	})
@@ -68,30 +78,67 @@ func (h *UserHandler) Login(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	user, err := h.userHandler.GetUserByEmail(payload.Email)
+	email := normalizeEmail(payload.Email)
+	defer h.lockLogin(c, email)()
+	failures, ok := h.checkLoginThrottle(c, email)
+	if !ok {
+		return
+	}
+	user, err := h.userHandler.GetUserByEmail(email)
 	if err != nil {
-		c.JSON(401, gin.H{
-			"Error": "Invalid Username",
-		})
-		c.Abort()
+		checkTimingPassword(payload.Password)
+		h.loginFailed(c, email, failures, nil)
+		return
+	}
+	// Disabled and locked accounts fail like a wrong password without checking it,
+	// so the response tells nothing about the account or whether the password was right
+	if user.Disabled || user.IsLocked() {
+		checkTimingPassword(payload.Password)
+		h.loginFailed(c, email, failures, nil)
 		return
 	}
 	err = user.CheckPassword(payload.Password)
+	if err != nil {
+		h.loginFailed(c, email, failures, &user)
+		return
+	}
+	// Upgrade hashes made with weaker parameters while the password is at hand
+	if user.NeedsRehash() {
+		var rehashed usermodel.User
+		err = rehashed.HashPassword(payload.Password)
+		if err == nil {
+			err = h.userHandler.UpdatePassword(user.ID, rehashed.Password, rehashed.Salt)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	// Users with two-factor authentication get a challenge instead of tokens. The login only
+	// counts as successful once the second factor is given, so failures keep adding up until then.
+	if user.TOTPEnabled {
+		h.mfaChallenge(c, user)
+		return
+	}
+	h.loginSucceeded(c, email)
+	h.issueTokens(c, user)
+}
+
+// issueTokens responds with a new access and refresh token for a user who has fully authenticated
+func (h *UserHandler) issueTokens(c *gin.Context, user usermodel.User) {
+	unverified, ok := h.checkVerified(c, user)
+	if !ok {
+		return
+	}
+	sessionID, err := h.userHandler.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		log.Println(err)
-		c.JSON(401, gin.H{
-			"Error": "Invalid User Credentials",
+		c.JSON(500, gin.H{
+			"Error": "Error Creating Session",
 		})
 		c.Abort()
 		return
 	}
-	jwtWrapper := auth.JwtWrapper{
-		SecretKey:         h.JWTKey,
-		Issuer:            "AuthService",
-		ExpirationMinutes: 30,
-		ExpirationHours:   12,
-	}
-	signedToken, err := jwtWrapper.GenerateToken(user.ID)
+	signedToken, err := h.JWT.GenerateToken(user.ID, user.Role, unverified, int(sessionID))
 	if err != nil {
 		log.Println(err)
 		c.JSON(500, gin.H{
@@ -100,7 +147,7 @@ func (h *UserHandler) Login(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	signedRefreshToken, err := jwtWrapper.RefreshToken(user.ID)
+	signedRefreshToken, err := h.JWT.RefreshToken(user.ID, int(sessionID))
 	if err != nil {
 		log.Println(err)
 		c.JSON(500, gin.H{
@@ -142,6 +189,15 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	user.Email = normalizeEmail(user.Email)
+	previous, err := h.userHandler.GetUser(userID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"Error": "User Not Found",
+		})
+		c.Abort()
+		return
+	}
 	err = h.userHandler.UpdateUser(userID, user.Email, user.Name)
 	if err != nil {
 		log.Println(err)
@@ -151,15 +207,35 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	// A new address is unverified until the user proves they own it, like on signup
+	if !strings.EqualFold(user.Email, previous.Email) {
+		updated, err := h.userHandler.GetUser(userID)
+		if err == nil && !updated.EmailVerified {
+			err = h.sendVerification(updated)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
 	c.JSON(200, gin.H{
 		"Message": "Successful Update",
 	})
 }
 
+// DeleteProfile schedules the erasure of the logged in user's account and data after the grace period,
+// during which the user can still log in and cancel it
 func (h *UserHandler) DeleteProfile(c *gin.Context) {
 	userID := c.GetInt("id")
-
-	err := h.userHandler.DeleteUser(userID)
+	user, err := h.userHandler.GetUser(userID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"Error": "User Not Found",
+		})
+		c.Abort()
+		return
+	}
+	eraseAfter := time.Now().Add(h.ErasureGrace)
+	err = h.userHandler.ScheduleErasure(userID, &eraseAfter)
 	if err != nil {
 		log.Println(err)
 		c.JSON(500, gin.H{
@@ -168,8 +244,40 @@ func (h *UserHandler) DeleteProfile(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	// Other devices are logged out right away
+	err = h.userHandler.RevokeOtherSessions(userID, c.GetInt("session"))
+	if err != nil {
+		log.Println(err)
+	}
+	body := fmt.Sprintf("Your Learning Tracker account and all its data will be erased on %s.\n\n"+
+		"If you change your mind, log in before then and cancel the erasure from your profile.",
+		eraseAfter.Format("January 2, 2006"))
+	go func() {
+		err := h.Mailer.Send(user.Email, "Your account will be erased", body)
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+	c.JSON(200, gin.H{
+		"Message":    "Successful Delete",
+		"eraseAfter": eraseAfter,
+	})
+}
+
+// CancelErasure cancels the scheduled erasure of the logged in user's account
+func (h *UserHandler) CancelErasure(c *gin.Context) {
+	userID := c.GetInt("id")
+	err := h.userHandler.ScheduleErasure(userID, nil)
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{
+			"Error": "Error Cancelling Erasure",
+		})
+		c.Abort()
+		return
+	}
 	c.JSON(200, gin.H{
-		"Message": "Successful Delete",
+		"Message": "Successful Cancel",
 	})
 }
 
@@ -183,13 +291,7 @@ func (h *UserHandler) RenewAccessToken(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	jwtWrapper := auth.JwtWrapper{
-		SecretKey:         h.JWTKey,
-		Issuer:            "AuthService",
-		ExpirationMinutes: 30,
-		ExpirationHours:   12,
-	}
-	claims, err := jwtWrapper.ValidateToken(token)
+	claims, err := h.JWT.ValidateRefreshToken(token)
 	if err != nil {
 		c.JSON(401, gin.H{
 			"Error": "Invalid Token",
@@ -197,15 +299,31 @@ func (h *UserHandler) RenewAccessToken(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	if claims.ExpiresAt < time.Now().Add(time.Minute*30).Unix() {
+	if claims.ExpiresAt.Before(time.Now().Add(time.Minute * 30)) {
 		c.JSON(401, gin.H{
 			"Error": "Token is expired",
 		})
 		c.Abort()
 		return
 	}
-	// convert id to int
-	userID, err := strconv.Atoi(claims.Audience)
+	// Get the user ID from the claims
+	userID, err := claims.UserID()
+	if err != nil {
+		c.JSON(401, gin.H{
+			"Error": "Invalid Token",
+		})
+		c.Abort()
+		return
+	}
+	if claims.SessionID != 0 && !h.sessionActive(claims.SessionID, userID) {
+		c.JSON(401, gin.H{
+			"Error": "Session Revoked",
+		})
+		c.Abort()
+		return
+	}
+	// Load the user so the new token carries their current role
+	user, err := h.userHandler.GetUser(userID)
 	if err != nil {
 		c.JSON(401, gin.H{
 			"Error": "Invalid Token",
@@ -213,7 +331,25 @@ func (h *UserHandler) RenewAccessToken(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	signedToken, err := jwtWrapper.GenerateToken(userID)
+	if user.Disabled {
+		c.JSON(403, gin.H{
+			"Error": "Account Disabled",
+		})
+		c.Abort()
+		return
+	}
+	if user.IsLocked() {
+		c.JSON(423, gin.H{
+			"Error": "Account Locked",
+		})
+		c.Abort()
+		return
+	}
+	unverified, ok := h.checkVerified(c, user)
+	if !ok {
+		return
+	}
+	signedToken, err := h.JWT.GenerateToken(userID, user.Role, unverified, claims.SessionID)
 	if err != nil {
 		log.Println(err)
 		c.JSON(500, gin.H{
@@ -0,0 +1,149 @@
+package usertransport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newLoginTestRouter() (*UserHandler, *gin.Engine) {
+	h := newTestHandler()
+	r := gin.New()
+	r.POST("/auth/login", h.Login)
+	return h, r
+}
+
+func login(r *gin.Engine, email string, password string) *httptest.ResponseRecorder {
+	body := `{"email":"` + email + `","password":"` + password + `"}`
+	return serve(r, httptest.NewRequest("POST", "/auth/login", strings.NewReader(body)))
+}
+
+func TestLoginUnavailableAccountsFailUniformly(t *testing.T) {
+	_, r := newLoginTestRouter()
+	locked := createTestUser(t, "login-locked@example.com", "password1")
+	until := time.Now().Add(time.Hour)
+	err := testStore.SetUserLock(locked.ID, &until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled := createTestUser(t, "login-disabled@example.com", "password1")
+	err = testStore.SetUserDisabled(disabled.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := login(r, "login-unknown@example.com", "password1")
+	for _, email := range []string{"login-locked@example.com", "login-disabled@example.com"} {
+		for _, password := range []string{"password1", "wrong-password"} {
+			clearLoginAttempts(t)
+			w := login(r, email, password)
+			if w.Code != unknown.Code || w.Body.String() != unknown.Body.String() {
+				t.Errorf("%s with %s: %d %s, want %d %s", email, password, w.Code, w.Body, unknown.Code, unknown.Body)
+			}
+		}
+	}
+	if unknown.Code != http.StatusUnauthorized {
+		t.Errorf("unknown email status = %d, want 401", unknown.Code)
+	}
+}
+
+func TestLoginNormalizesEmail(t *testing.T) {
+	clearLoginAttempts(t)
+	_, r := newLoginTestRouter()
+	createTestUser(t, "Login-Mixed@Example.com", "password1")
+	w := login(r, "  login-mixed@EXAMPLE.com ", "password1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body)
+	}
+	// Failures under any spelling of the email count towards the same throttle
+	for _, email := range []string{"LOGIN-MIXED@example.com", "login-mixed@example.com", "Login-Mixed@Example.com"} {
+		if w := login(r, email, "wrong-password"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password status = %d: %s", w.Code, w.Body)
+		}
+	}
+	w = login(r, "login-mixed@example.com", "password1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login after %d failures status = %d, want 429", accountFreeFailures, w.Code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	clearLoginAttempts(t)
+	_, r := newLoginTestRouter()
+	user := createTestUser(t, "login-lockout@example.com", "password1")
+	for i := 0; i < lockoutFailures; i++ {
+		// Skip the backoff between attempts
+		_, err := testDB.Exec(`UPDATE login_attempts SET created_at=?`, time.Now().Add(-loginMaxDelay).UTC())
+		if err != nil {
+			t.Fatal(err)
+		}
+		login(r, "login-lockout@example.com", "wrong-password")
+	}
+	user, err := testStore.GetUserByEmail(user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsLocked() {
+		t.Fatalf("account not locked after %d failures", lockoutFailures)
+	}
+}
+
+func TestConcurrentLoginsAreThrottled(t *testing.T) {
+	clearLoginAttempts(t)
+	_, r := newLoginTestRouter()
+	createTestUser(t, "login-concurrent@example.com", "password1")
+	attempts := 2 * accountFreeFailures
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- login(r, "login-concurrent@example.com", "wrong-password").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	failures := 0
+	for code := range codes {
+		if code == http.StatusUnauthorized {
+			failures++
+		}
+	}
+	// The attempts past the free ones are throttled, however many arrive at once
+	if failures != accountFreeFailures {
+		t.Errorf("%d of %d concurrent attempts checked the password, want %d", failures, attempts, accountFreeFailures)
+	}
+}
+
+func TestSignupNormalizesEmail(t *testing.T) {
+	h := newTestHandler()
+	r := gin.New()
+	r.POST("/auth/signup", h.Signup)
+	signup := func(email string) int {
+		body := `{"email":"` + email + `","password":"password1","name":"Test"}`
+		return serve(r, httptest.NewRequest("POST", "/auth/signup", strings.NewReader(body))).Code
+	}
+	if code := signup(" Signup-Case@Example.com "); code != http.StatusOK {
+		t.Fatalf("signup status = %d", code)
+	}
+	user, err := testStore.GetUserByEmail("signup-case@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "signup-case@example.com" {
+		t.Errorf("stored email = %q, want it normalized", user.Email)
+	}
+	// The same address in another case is the same account
+	if code := signup("signup-case@example.com"); code == http.StatusOK {
+		t.Error("second signup with the same email succeeded")
+	}
+	err = testStore.CreateUser("SIGNUP-CASE@example.com", "", nil, "Test")
+	if err == nil {
+		t.Error("store accepted the same email in another case")
+	}
+}
@@ -0,0 +1,155 @@
+package usertransport
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	usermodel "github.com/khoaphungnguyen/learning-tracker/internal/users/model"
+)
+
+// Email verification modes
+const (
+	VerificationOff      = "off"      // Unverified users have full access
+	VerificationRestrict = "restrict" // Unverified users can log in with read-only access
+	VerificationBlock    = "block"    // Unverified users cannot log in
+)
+
+const (
+	verificationTTL            = 24 * time.Hour // How long a verification link stays valid
+	verificationResendInterval = time.Minute    // Minimum time between two verification emails
+	verificationIPLimit        = 10             // Resend requests allowed from one IP per verificationIPWindow
+	verificationIPWindow       = time.Hour
+)
+
+// ResendVerificationPayload resend verification body
+type ResendVerificationPayload struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// VerifyEmail marks an email as verified using the token from a verification link
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	claims, err := h.JWT.ValidateEmailVerificationToken(c.Query("token"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Or Expired Token",
+		})
+		c.Abort()
+		return
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Or Expired Token",
+		})
+		c.Abort()
+		return
+	}
+	err = h.userHandler.SetEmailVerified(userID, claims.Email)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Or Expired Token",
+		})
+		c.Abort()
+		return
+	}
+	c.JSON(200, gin.H{
+		"Message": "Successful Verification",
+	})
+}
+
+// ResendVerification sends a new verification email, at most once per verificationResendInterval.
+// Requests are limited per email and per IP whether or not the email is registered, and the
+// response is the same either way.
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	var payload ResendVerificationPayload
+	err := c.ShouldBindJSON(&payload)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"Error": "Invalid Inputs",
+		})
+		c.Abort()
+		return
+	}
+	email := normalizeEmail(payload.Email)
+	ip := c.ClientIP()
+	if wait := max(h.resendByEmail.wait(email), h.resendByIP.wait(ip)); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(429, gin.H{
+			"Error": "Too Many Requests",
+		})
+		c.Abort()
+		return
+	}
+	h.resendByEmail.add(email)
+	h.resendByIP.add(ip)
+	response := gin.H{
+		"Message": "If the email is registered and unverified, a verification link has been sent",
+	}
+	user, err := h.userHandler.GetUserByEmail(email)
+	if err != nil || user.EmailVerified {
+		c.JSON(200, response)
+		return
+	}
+	// A link sent at signup or by another server counts too
+	if user.VerificationSentAt != nil && time.Since(*user.VerificationSentAt) < verificationResendInterval {
+		c.JSON(200, response)
+		return
+	}
+	err = h.sendVerification(user)
+	if err != nil {
+		log.Println(err)
+	}
+	c.JSON(200, response)
+}
+
+// sendVerification emails a verification link to the user
+func (h *UserHandler) sendVerification(user usermodel.User) error {
+	token, err := h.JWT.EmailVerificationToken(user.ID, user.Email, verificationTTL)
+	if err != nil {
+		return err
+	}
+	err = h.userHandler.SetVerificationSent(user.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.BaseURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Welcome to Learning Tracker!\n\n"+
+		"Open this link within %d hours to verify your email address:\n%s", int(verificationTTL.Hours()), link)
+	go func() {
+		err := h.Mailer.Send(user.Email, "Verify your email address", body)
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+	return nil
+}
+
+// checkVerified applies the email verification mode when issuing an access token.
+// It returns whether the token must be marked unverified, or false if the login is refused.
+func (h *UserHandler) checkVerified(c *gin.Context, user usermodel.User) (unverified bool, ok bool) {
+	unverified, ok = h.VerificationStatus(user)
+	if !ok {
+		c.JSON(403, gin.H{
+			"Error": "Email Not Verified",
+		})
+		c.Abort()
+	}
+	return unverified, ok
+}
+
+// VerificationStatus applies the email verification mode to a user.
+// It returns whether their access must be restricted, or false if they cannot have access at all.
+func (h *UserHandler) VerificationStatus(user usermodel.User) (unverified bool, allowed bool) {
+	if user.EmailVerified || h.EmailVerification == VerificationOff {
+		return false, true
+	}
+	if h.EmailVerification == VerificationBlock {
+		return false, false
+	}
+	return true, true
+}